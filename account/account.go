@@ -0,0 +1,158 @@
+package account
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// ExportHandler returns everything we store about the user. Small histories are streamed right away, large ones, or
+// any export requested with async=true, are generated in the background and can be fetched through
+// ExportStatusHandler and ExportDownloadHandler.
+func ExportHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		format := ctx.DefaultQuery("format", models.ExportFormatJSON)
+		if format != models.ExportFormatJSON && format != models.ExportFormatZIP {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": errUnknownFormat.Error()})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		count, err := stores.Locations.CountLocations(userId)
+		if err != nil {
+			sugar.Errorw("Error counting locations", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		if ctx.Query("async") == "true" || count > constants.SyncExportLocationLimit {
+			export, err := StartExport(stores, userId, format, sugar)
+			if err != nil {
+				sugar.Errorw("Error starting data export", "error", err)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+				return
+			}
+			sugar.Infow("Started data export in the background", "export_id", export.ID, "locations", count)
+			ctx.JSON(http.StatusAccepted, gin.H{
+				"export":     export,
+				"status_url": "/account/exports/" + export.ID,
+			})
+			return
+		}
+
+		data, err := CollectPersonalData(stores, userId)
+		if err != nil {
+			sugar.Errorw("Error collecting personal data", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.Header("Content-Type", contentType(format))
+		ctx.Header("Content-Disposition", `attachment; filename="`+exportFileName(data.GeneratedAt, format)+`"`)
+		ctx.Status(http.StatusOK)
+		// The status has been sent with the first byte, errors from here on can only be logged
+		if err := WriteExport(ctx.Writer, stores, data, format); err != nil {
+			sugar.Errorw("Error writing data export", "error", err)
+			return
+		}
+		sugar.Infow("Successfully exported personal data", "locations", count)
+	}
+}
+
+func ExportStatusHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		export, ok := exportFromRequest(ctx, stores)
+		if !ok {
+			return
+		}
+
+		response := gin.H{"export": export}
+		if export.Status == models.ExportReady {
+			response["download_url"] = "/account/exports/" + export.ID + "/download"
+		}
+		sugar.Infow("Successfully retrieved data export", "export_id", export.ID, "status", export.Status)
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func ExportDownloadHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		export, ok := exportFromRequest(ctx, stores)
+		if !ok {
+			return
+		}
+
+		if export.Status != models.ExportReady {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "export is " + export.Status})
+			return
+		}
+		ctx.Header("Content-Type", contentType(export.Format))
+		ctx.FileAttachment(export.FilePath, exportFileName(export.CreatedAt, export.Format))
+	}
+}
+
+// exportFromRequest loads the export in the path, which must belong to the user. It writes the error response itself.
+func exportFromRequest(ctx *gin.Context, stores *store.Stores) (models.DataExport, bool) {
+	sugar, err := utils.SugarFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+		return models.DataExport{}, false
+	}
+
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		sugar.Errorw("Error retrieving user ID from context", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+		return models.DataExport{}, false
+	}
+
+	export, err := stores.DataExports.GetDataExport(userId, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+			return models.DataExport{}, false
+		}
+		sugar.Errorw("Error retrieving data export", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+		return models.DataExport{}, false
+	}
+	if time.Now().After(export.ExpiresAt) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return models.DataExport{}, false
+	}
+	return export, true
+}
+
+func contentType(format string) string {
+	if format == models.ExportFormatZIP {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+func exportFileName(createdAt time.Time, format string) string {
+	return "distance-tracker-export-" + createdAt.UTC().Format("2006-01-02") + "." + format
+}
@@ -0,0 +1,281 @@
+package account
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/tracks"
+	"DistanceTrackerServer/utils"
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	exportBatchSize       = 1000
+	exportCleanupInterval = time.Hour
+)
+
+var (
+	userIdFromContext = utils.UserIdFromContext
+	errUnknownFormat  = errors.New("format must be json or zip")
+)
+
+// CollectPersonalData gathers everything we store about the user except the location history, which is streamed
+// by WriteExport
+func CollectPersonalData(stores *store.Stores, userId int) (models.PersonalDataExport, error) {
+	account, err := stores.Users.GetAccount(userId)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve account: %w", err)
+	}
+	data := models.PersonalDataExport{GeneratedAt: time.Now().UTC(), Account: account}
+
+	linkCode, err := stores.LinkCodes.GetUserLinkCode(userId)
+	if err == nil {
+		data.LinkCode = &linkCode
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve link code: %w", err)
+	}
+
+	data.PartnerLinks, err = stores.Users.PartnerLinks(userId)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve link history: %w", err)
+	}
+
+	data.LinkRequests, err = stores.LinkRequests.LinkRequestsForUser(userId)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve link requests: %w", err)
+	}
+
+	data.Circles, err = stores.Circles.CirclesForUser(userId)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve circles: %w", err)
+	}
+
+	data.RejectedRequests, err = stores.Bans.RejectedRequestsForEmail(account.Email)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve rejected requests: %w", err)
+	}
+
+	data.AuditLog, err = stores.Audit.AuditEventsForUser(userId)
+	if err != nil {
+		return models.PersonalDataExport{}, fmt.Errorf("failed to retrieve audit log: %w", err)
+	}
+	return data, nil
+}
+
+// eachLocation calls fn for every location of the user, oldest first, without loading the whole history at once
+func eachLocation(locations store.LocationStore, userId int, fn func(location models.LocationFromDB) error) error {
+	afterId := 0
+	for {
+		page, err := locations.LocationsAfter(userId, afterId, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, location := range page {
+			if err := fn(location); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportBatchSize {
+			return nil
+		}
+		afterId = page[len(page)-1].ID
+	}
+}
+
+// WriteExport writes the personal data together with the full location history, including invalid points, as a JSON
+// document or as a ZIP archive that additionally contains the locations as CSV and GPX
+func WriteExport(w io.Writer, stores *store.Stores, data models.PersonalDataExport, format string) error {
+	switch format {
+	case models.ExportFormatJSON:
+		return writeJSON(w, stores.Locations, data)
+	case models.ExportFormatZIP:
+		return writeZIP(w, stores.Locations, data)
+	}
+	return errUnknownFormat
+}
+
+func writeJSON(w io.Writer, locations store.LocationStore, data models.PersonalDataExport) error {
+	envelope, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode personal data: %w", err)
+	}
+
+	// The locations are spliced into the envelope object as they are read
+	buffered := bufio.NewWriter(w)
+	_, _ = buffered.Write(envelope[:len(envelope)-1])
+	_, _ = buffered.WriteString(`,"locations":[`)
+	first := true
+	err = eachLocation(locations, data.Account.ID, func(location models.LocationFromDB) error {
+		encoded, err := json.Marshal(location)
+		if err != nil {
+			return fmt.Errorf("failed to encode location: %w", err)
+		}
+		if !first {
+			_ = buffered.WriteByte(',')
+		}
+		first = false
+		_, err = buffered.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = buffered.WriteString("]}\n")
+	return buffered.Flush()
+}
+
+func writeZIP(w io.Writer, locations store.LocationStore, data models.PersonalDataExport) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("account.json")
+	if err != nil {
+		return fmt.Errorf("failed to add account.json: %w", err)
+	}
+	if err = writeJSON(file, locations, data); err != nil {
+		return err
+	}
+
+	file, err = archive.Create("locations.csv")
+	if err != nil {
+		return fmt.Errorf("failed to add locations.csv: %w", err)
+	}
+	csvWriter, err := tracks.NewCSVWriter(file)
+	if err != nil {
+		return err
+	}
+	if err = writeTrack(csvWriter, locations, data.Account.ID, true); err != nil {
+		return err
+	}
+
+	// GPX has no notion of rejected points, so only the valid track is included
+	file, err = archive.Create("locations.gpx")
+	if err != nil {
+		return fmt.Errorf("failed to add locations.gpx: %w", err)
+	}
+	gpxWriter, err := tracks.NewGPXWriter(file, "Location history of "+data.Account.FirstName)
+	if err != nil {
+		return err
+	}
+	if err = writeTrack(gpxWriter, locations, data.Account.ID, false); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeTrack(writer tracks.Writer, locations store.LocationStore, userId int, includeInvalid bool) error {
+	err := eachLocation(locations, userId, func(location models.LocationFromDB) error {
+		if !location.IsValid && !includeInvalid {
+			return nil
+		}
+		return writer.WriteLocation(location)
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// StartExport registers an export and generates it in the background. The file can be downloaded until it expires.
+func StartExport(stores *store.Stores, userId int, format string, sugar *zap.SugaredLogger) (models.DataExport, error) {
+	if format != models.ExportFormatJSON && format != models.ExportFormatZIP {
+		return models.DataExport{}, errUnknownFormat
+	}
+
+	export := models.DataExport{
+		ID:        uuid.New().String(),
+		UserID:    userId,
+		Format:    format,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(constants.ExportLifetime),
+	}
+	if err := stores.DataExports.CreateDataExport(export); err != nil {
+		return models.DataExport{}, err
+	}
+
+	go generateExport(stores, export, sugar)
+	return export, nil
+}
+
+func generateExport(stores *store.Stores, export models.DataExport, sugar *zap.SugaredLogger) {
+	status, filePath, message := models.ExportReady, exportPath(export), ""
+	if err := writeExportFile(stores, export, filePath); err != nil {
+		sugar.Errorw("Failed to generate data export", zap.String("export_id", export.ID), zap.Error(err))
+		removeFile(filePath, sugar)
+		status, filePath, message = models.ExportFailed, "", "the export could not be generated, please try again"
+	}
+
+	if err := stores.DataExports.FinishDataExport(export.ID, status, filePath, message); err != nil {
+		sugar.Warnw("Failed to finish data export", zap.String("export_id", export.ID), zap.Error(err))
+		if filePath != "" {
+			removeFile(filePath, sugar)
+		}
+		return
+	}
+	sugar.Infow("Data export finished", zap.String("export_id", export.ID), zap.String("status", status))
+}
+
+func writeExportFile(stores *store.Stores, export models.DataExport, path string) error {
+	data, err := CollectPersonalData(stores, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(constants.ExportDir, 0700); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	err = WriteExport(file, stores, data, export.Format)
+	if closeErr := file.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to close export file: %w", closeErr))
+	}
+	return err
+}
+
+func exportPath(export models.DataExport) string {
+	return filepath.Join(constants.ExportDir, export.ID+"."+export.Format)
+}
+
+func removeFile(path string, sugar *zap.SugaredLogger) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		sugar.Warnw("Failed to remove data export file", zap.String("path", path), zap.Error(err))
+	}
+}
+
+// RemoveExportFiles deletes the files of the exports, e.g. once they expired or the account was deleted
+func RemoveExportFiles(exports []models.DataExport, sugar *zap.SugaredLogger) {
+	for _, export := range exports {
+		if export.FilePath != "" {
+			removeFile(export.FilePath, sugar)
+		}
+	}
+}
+
+// StartExportCleanup periodically deletes expired exports together with their files
+func StartExportCleanup(stores *store.Stores, sugar *zap.SugaredLogger) {
+	go func() {
+		for {
+			exports, err := stores.DataExports.DeleteExpiredDataExports()
+			if err != nil {
+				sugar.Errorw("Failed to delete expired data exports", zap.Error(err))
+			} else {
+				RemoveExportFiles(exports, sugar)
+			}
+			time.Sleep(exportCleanupInterval)
+		}
+	}()
+}
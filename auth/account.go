@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"DistanceTrackerServer/account"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	removeExportFiles = account.RemoveExportFiles
+)
+
+// DeleteAccount permanently deletes the authenticated user after checking their password. The partner is unlinked,
+// the location history and any data exports are deleted, only an audit record without personal data is kept.
+func DeleteAccount(ctx *gin.Context, stores *store.Stores, password string) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(stores.Users, claims.UserID(), password); err != nil {
+		return err
+	}
+
+	// The export files outlive the rows, so remember them before the account is gone
+	exports, err := stores.DataExports.ListDataExports(claims.UserID())
+	if err != nil {
+		return err
+	}
+
+	details := ""
+	if partnerId, err := stores.Users.GetPartnerId(claims.UserID()); err == nil {
+		details = fmt.Sprintf("unlinked partner %d", partnerId)
+	}
+
+	err = stores.Users.DeleteUser(claims.UserID(), models.AuditEvent{
+		Event:     models.AuditAccountDeleted,
+		Details:   details,
+		IPAddress: ctx.ClientIP(),
+	})
+	if err != nil {
+		return err
+	}
+
+	removeExportFiles(exports, sugar)
+	sugar.Infow("Account deleted", zap.Int("user_id", claims.UserID()))
+	clearTokenCookies(ctx)
+	return nil
+}
@@ -1,111 +1,315 @@
 package auth
 
 import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/mailer"
 	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
 	"DistanceTrackerServer/utils"
-	"database/sql"
 	"errors"
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"time"
 
 	"fmt"
-	"github.com/gin-gonic/gin"
 )
 
 var (
-	getUserIdByEmail = utils.GetUserIdByEmail
+	errNoPartner           = errors.New("no partner linked")
+	errLinkToSelf          = errors.New("you cannot link with your own link code")
+	errLinkRequestNotFound = errors.New("link request not found")
+	errLinkRequestExpired  = errors.New("link request expired")
+	errLinkConflict        = errors.New("the link changed at the same time, please try again")
+	errNoLinkCodeGiven     = errors.New("either pair_uuid or pair_code is required")
+	errLinkCodeNotFound    = errors.New("unknown link code")
+	errLinkCodeExpired     = errors.New("link code expired")
+	errNoLinkCode          = errors.New("no valid link code, please create a new one")
+	errInvalidLinkCode     = errors.New("invalid link code")
 )
 
-func LinkAccounts(ctx *gin.Context, link models.AccountLink, orgEmail string) error {
-	dbConn, err := utils.DBConnFromContext(ctx)
+// LinkAccounts redeems the link code of another user. This only creates a link request, the accounts are linked once
+// the owner of the code accepts it, so a leaked code alone does not reveal anyone's location. The code can only be
+// redeemed once. It returns the ID of the request.
+func LinkAccounts(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, link models.AccountLink, initiatorUserID int) (int, error) {
+	sugar, err := sugarFromContext(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// First we find the initiator user ID from the email
-	initiatorUserID, err := getUserIdByEmail(dbConn, orgEmail)
+	if link.PairUUID == uuid.Nil {
+		if link.PairCode == "" {
+			return 0, errNoLinkCodeGiven
+		}
+		link.PairCode, err = utils.NormalizeShortCode(link.PairCode)
+		if err != nil {
+			return 0, errInvalidLinkCode
+		}
+	}
+
+	request, err := stores.LinkRequests.RedeemLinkCode(link, initiatorUserID, constants.LinkCodeLifetime, constants.LinkRequestLifetime)
 	if err != nil {
-		return fmt.Errorf("failed to get initiator user ID: %w", err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return 0, errLinkCodeNotFound
+		case errors.Is(err, store.ErrExpired):
+			return 0, errLinkCodeExpired
+		case errors.Is(err, store.ErrOwnLinkCode):
+			return 0, errLinkToSelf
+		}
+		return 0, fmt.Errorf("failed to redeem link code: %w", err)
 	}
+	requestId, linkUserID := request.ID, request.OwnerID
 
-	// Now we find the account to link to
-	var linkUserID int
-	var creationTime time.Time
-	err = dbConn.QueryRow("SELECT user_id, created_at FROM link_code WHERE code = ?", link.PairUUID).Scan(&linkUserID, &creationTime)
+	err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    initiatorUserID,
+		Event:     models.AuditLinkRequested,
+		Details:   fmt.Sprintf("link request %d to user %d", requestId, linkUserID),
+		IPAddress: ctx.ClientIP(),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to find link code: %w", err)
+		sugar.Warnw("Failed to record link request", zap.Error(err))
 	}
 
-	// Check if the link code is expired (valid for 15 minutes)
-	if time.Since(creationTime) > 15*time.Minute {
-		// If the link code is expired, we delete it from the database
-		_, err = dbConn.Exec("DELETE FROM link_code WHERE code = ?", link.PairUUID)
-		return fmt.Errorf("link code expired")
+	requester, err := stores.Users.GetUserInformation(initiatorUserID)
+	if err != nil {
+		sugar.Warnw("Failed to load requester for link request notification", zap.Error(err))
+		return requestId, nil
+	}
+	owner, err := stores.Users.GetUserInformation(linkUserID)
+	if err != nil {
+		sugar.Warnw("Failed to load owner for link request notification", zap.Error(err))
+		return requestId, nil
 	}
+	go sendMail(mail, sugar, mailer.Message{
+		To:      owner.Email,
+		Subject: "New Distance Tracker link request",
+		Body: fmt.Sprintf("Hi %s,\n\n%s (%s) used your link code and wants to link accounts with you. Open the app "+
+			"to accept or reject the request, it expires in %d hours.\n\nIf you did not share your link code with "+
+			"them, reject the request. Your location is only shared once you accept.",
+			owner.FirstName, requester.FirstName, requester.Email, int(constants.LinkRequestLifetime.Hours())),
+	})
+	return requestId, nil
+}
 
-	// First we remove any links either account has to any other account
-	_, err = dbConn.Exec("DELETE FROM link_code WHERE user_id = ? OR user_id = ?", initiatorUserID, linkUserID)
+// ListLinkRequests returns the pending requests the authenticated user received, together with who sent them, and
+// the ones they sent
+func ListLinkRequests(ctx *gin.Context, stores *store.Stores) ([]models.LinkRequest, []models.LinkRequest, error) {
+	claims, err := claimsFromContext(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to remove existing links: %w", err)
+		return nil, nil, err
 	}
 
-	// Next we link the accounts
-	_, err1 := dbConn.Exec("UPDATE users SET linked_account = ? WHERE id = ?", initiatorUserID, linkUserID)
-	_, err2 := dbConn.Exec("UPDATE users SET linked_account = ? WHERE id = ?", linkUserID, initiatorUserID)
-	if err1 != nil || err2 != nil {
-		return fmt.Errorf("failed to link accounts: %w | %w", err1, err2)
+	requests, err := stores.LinkRequests.PendingLinkRequests(claims.UserID())
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	incoming := []models.LinkRequest{}
+	outgoing := []models.LinkRequest{}
+	for _, request := range requests {
+		if request.RequesterID == claims.UserID() {
+			outgoing = append(outgoing, request)
+			continue
+		}
+		requester, err := stores.Users.GetUserInformation(request.RequesterID)
+		if err != nil {
+			return nil, nil, err
+		}
+		request.Requester = &requester
+		incoming = append(incoming, request)
+	}
+	return incoming, outgoing, nil
 }
 
-func CreateUuidLink(ctx *gin.Context, orgEmail string) (models.AccountLink, error) {
-
-	pairUUID := uuid.New()
-	dbConn, err := utils.DBConnFromContext(ctx)
+// AnswerLinkRequest accepts or rejects a request the authenticated user received. Accepting links both accounts.
+func AnswerLinkRequest(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, requestId int, accept bool) error {
+	sugar, err := sugarFromContext(ctx)
 	if err != nil {
-		return models.AccountLink{}, err
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
 	}
 
-	// First we find the initiator user ID from the email
-	initiatorUserID, err := getUserIdByEmail(dbConn, orgEmail)
+	var request models.LinkRequest
+	var formerPartners map[int]int
+	event := models.AuditLinkRequestRejected
+	if accept {
+		event = models.AuditLinkRequestAccepted
+		request, formerPartners, err = stores.LinkRequests.AcceptLinkRequest(requestId, claims.UserID())
+	} else {
+		request, err = stores.LinkRequests.RejectLinkRequest(requestId, claims.UserID())
+	}
 	if err != nil {
-		return models.AccountLink{}, fmt.Errorf("failed to get initiator user ID: %w", err)
+		if errors.Is(err, store.ErrNotFound) {
+			return errLinkRequestNotFound
+		}
+		if errors.Is(err, store.ErrExpired) {
+			return errLinkRequestExpired
+		}
+		if errors.Is(err, store.ErrConflict) {
+			return errLinkConflict
+		}
+		return err
 	}
 
-	// Delete any existing link code for the initiator user
-	_, err = dbConn.Exec("DELETE FROM link_code WHERE user_id = ?", initiatorUserID)
+	err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    claims.UserID(),
+		Event:     event,
+		Details:   fmt.Sprintf("link request %d from user %d", request.ID, request.RequesterID),
+		IPAddress: ctx.ClientIP(),
+	})
 	if err != nil {
-		return models.AccountLink{}, fmt.Errorf("failed to delete existing link code: %w", err)
+		sugar.Warnw("Failed to record link request answer", zap.Error(err))
 	}
+	sugar.Infow("Link request answered", zap.Int("request_id", request.ID), zap.Bool("accepted", accept))
 
-	// Remove any existing linked accounts for the initiator user, or the potential link user
-	// This ensures that the initiator user can only have one link code at a time
-	var existingLinkUserID int
-	err = dbConn.QueryRow("SELECT linked_account FROM users WHERE id = ? AND linked_account IS NOT NULL", initiatorUserID).Scan(&existingLinkUserID)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return models.AccountLink{}, fmt.Errorf("failed to get existing linked account: %w", err)
+	// Accepting ends the pairings both of them were in before, their former partners are told like on an unlink
+	for userId, formerPartnerId := range formerPartners {
+		err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+			UserID:    userId,
+			Event:     models.AuditPartnerUnlinked,
+			Details:   fmt.Sprintf("unlinked partner %d by accepting link request %d", formerPartnerId, request.ID),
+			IPAddress: ctx.ClientIP(),
+		})
+		if err != nil {
+			sugar.Warnw("Failed to record unlinking", zap.Error(err))
+		}
+		notifyUnlinkedPartner(stores, mail, sugar, userId, formerPartnerId,
+			"linked their Distance Tracker account with someone else, so it is no longer linked with yours.")
+	}
+
+	owner, err := stores.Users.GetUserInformation(request.OwnerID)
+	if err != nil {
+		sugar.Warnw("Failed to load owner for link request notification", zap.Error(err))
+		return nil
+	}
+	requester, err := stores.Users.GetUserInformation(request.RequesterID)
+	if err != nil {
+		sugar.Warnw("Failed to load requester for link request notification", zap.Error(err))
+		return nil
+	}
+	message := mailer.Message{
+		To:      requester.Email,
+		Subject: "Your Distance Tracker link request was declined",
+		Body:    "Hi " + requester.FirstName + ",\n\n" + owner.FirstName + " declined your request to link accounts.",
+	}
+	if accept {
+		message.Subject = "Your Distance Tracker link request was accepted"
+		message.Body = "Hi " + requester.FirstName + ",\n\n" + owner.FirstName + " accepted your request, your " +
+			"accounts are now linked."
 	}
+	go sendMail(mail, sugar, message)
+	return nil
+}
+
+// CreateUuidLink replaces the link code of the user with a new one, which can be redeemed by its UUID or the short
+// code until the returned expiry. The current pairing of the user stays, accepting a request of the new code ends it.
+func CreateUuidLink(stores *store.Stores, initiatorUserID int) (models.AccountLink, time.Time, error) {
+	pairUUID := uuid.New()
+
+	// Short codes are random, so they rarely collide with an existing one. If they do we simply try another.
+	for attempt := 0; attempt < shortLinkCodeAttempts; attempt++ {
+		shortCode, err := utils.GenerateShortCode()
+		if err != nil {
+			return models.AccountLink{}, time.Time{}, err
+		}
 
-	if existingLinkUserID != 0 {
-		_, err = dbConn.Exec("UPDATE users SET linked_account = NULL WHERE id = ?", existingLinkUserID)
+		createdAt, err := stores.LinkCodes.ReplaceLinkCode(initiatorUserID, pairUUID, shortCode)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
 		if err != nil {
-			return models.AccountLink{}, fmt.Errorf("failed to remove existing linked account: %w", err)
+			return models.AccountLink{}, time.Time{}, err
+		}
+
+		link := models.AccountLink{
+			PairUUID: pairUUID,
+			PairCode: utils.FormatShortCode(shortCode),
+		}
+		// RedeemLinkCode measures the lifetime from the stored creation time, so the expiry is reported the same way
+		return link, createdAt.Add(constants.LinkCodeLifetime).UTC(), nil
+	}
+	return models.AccountLink{}, time.Time{}, errLinkConflict
+}
+
+// LinkCodeDeepLink returns the deep link for the current link code of the user, which is what its QR code encodes
+func LinkCodeDeepLink(stores *store.Stores, userId int) (string, error) {
+	linkCode, err := stores.LinkCodes.GetUserLinkCode(userId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "", errNoLinkCode
 		}
+		return "", err
 	}
-	_, err = dbConn.Exec("UPDATE users SET linked_account = NULL WHERE id = ?", initiatorUserID)
+	if time.Since(linkCode.CreatedAt) > constants.LinkCodeLifetime {
+		return "", errNoLinkCode
+	}
+	return linkCodeDeepLink(models.AccountLink{
+		PairUUID: linkCode.Code,
+		PairCode: utils.FormatShortCode(linkCode.ShortCode),
+	}), nil
+}
+
+// UnlinkAccounts ends the pairing of the authenticated user and lets the partner know by mail
+func UnlinkAccounts(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer) error {
+	sugar, err := sugarFromContext(ctx)
 	if err != nil {
-		return models.AccountLink{}, fmt.Errorf("failed to remove existing linked account: %w", err)
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
 	}
 
-	_, err = dbConn.Exec("INSERT INTO link_code (user_id, code) VALUES (?, ?)", initiatorUserID, pairUUID)
+	partnerId, err := stores.Users.UnlinkPartner(claims.UserID(), claims.UserID(), models.LinkEndUnlinked)
 	if err != nil {
-		return models.AccountLink{}, fmt.Errorf("failed to insert new link code: %w", err)
+		if errors.Is(err, store.ErrNoPartner) {
+			return errNoPartner
+		}
+		if errors.Is(err, store.ErrConflict) {
+			return errLinkConflict
+		}
+		return err
 	}
 
-	link := models.AccountLink{
-		PairUUID: pairUUID,
+	err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    claims.UserID(),
+		Event:     models.AuditPartnerUnlinked,
+		Details:   fmt.Sprintf("unlinked partner %d", partnerId),
+		IPAddress: ctx.ClientIP(),
+	})
+	if err != nil {
+		sugar.Warnw("Failed to record unlinking", zap.Error(err))
 	}
+	sugar.Infow("Accounts unlinked", zap.Int("user_id", claims.UserID()), zap.Int("partner_id", partnerId))
+
+	notifyUnlinkedPartner(stores, mail, sugar, claims.UserID(), partnerId,
+		"unlinked their Distance Tracker account from yours.")
+	return nil
+}
 
-	return link, nil
+// notifyUnlinkedPartner lets the former partner know that the user ended their pairing, what says what the user did
+// and follows their first name
+func notifyUnlinkedPartner(stores *store.Stores, mail mailer.Mailer, sugar *zap.SugaredLogger, userId int,
+	partnerId int, what string) {
+	userInfo, err := stores.Users.GetUserInformation(userId)
+	if err != nil {
+		sugar.Warnw("Failed to load user for unlink notification", zap.Error(err))
+		return
+	}
+	partnerInfo, err := stores.Users.GetUserInformation(partnerId)
+	if err != nil {
+		sugar.Warnw("Failed to load partner for unlink notification", zap.Error(err))
+		return
+	}
+	go sendMail(mail, sugar, mailer.Message{
+		To:      partnerInfo.Email,
+		Subject: "Your Distance Tracker accounts were unlinked",
+		Body: "Hi " + partnerInfo.FirstName + ",\n\n" + userInfo.FirstName + " " + what + " You no longer share " +
+			"your distance with each other.\n\nYou can link with someone again at any time by creating a new link " +
+			"code in the app.",
+	})
 }
@@ -0,0 +1,450 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/database"
+	"DistanceTrackerServer/mailer"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testMailer keeps every mail instead of sending it
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *testMailer) Send(message mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// serve runs the handler for a request of the user, as if the authentication middleware had let it through
+func serve(t *testing.T, handler gin.HandlerFunc, method string, route string, target string, userId int, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	engine := gin.New()
+	engine.Handle(method, route, func(ctx *gin.Context) {
+		ctx.Set("sugar", zap.NewNop().Sugar())
+		ctx.Set("claims", &models.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(userId)}})
+	}, handler)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, &payload)
+	request.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func createUser(t *testing.T, stores *store.Stores, name string) int {
+	t.Helper()
+	userId, err := stores.Users.CreateUser(strings.ToLower(name)+"@example.com", name, []byte("hash"))
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", name, err)
+	}
+	return userId
+}
+
+func requestLink(t *testing.T, stores *store.Stores, requesterId int, link models.AccountLink) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, AccountLinkHandler(stores, &testMailer{}), http.MethodPost, "/account-link", "/account-link",
+		requesterId, link)
+}
+
+func answerRequest(t *testing.T, stores *store.Stores, ownerId int, requestId int, accept bool) *httptest.ResponseRecorder {
+	t.Helper()
+	action := "reject"
+	if accept {
+		action = "accept"
+	}
+	return serve(t, LinkRequestAnswerHandler(stores, &testMailer{}, accept), http.MethodPost,
+		"/link-requests/:id/"+action, "/link-requests/"+strconv.Itoa(requestId)+"/"+action, ownerId, nil)
+}
+
+func requestIdFrom(t *testing.T, recorder *httptest.ResponseRecorder) int {
+	t.Helper()
+	var response struct {
+		RequestID int `json:"request_id"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.RequestID == 0 {
+		t.Fatalf("expected a link request ID in %q", recorder.Body.String())
+	}
+	return response.RequestID
+}
+
+func TestLinkRequestIsAcceptedByCodeOwner(t *testing.T) {
+	stores := store.NewMemoryStores()
+	owner := createUser(t, stores, "Alice")
+	requester := createUser(t, stores, "Bob")
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+
+	recorder := requestLink(t, stores, requester, models.AccountLink{PairCode: link.PairCode})
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, recorder.Code, recorder.Body.String())
+	}
+	requestId := requestIdFrom(t, recorder)
+
+	// Redeeming the code alone must not link anyone
+	if _, err := stores.Users.GetPartnerId(requester); !errors.Is(err, store.ErrNoPartner) {
+		t.Fatalf("expected the requester to be unlinked before the owner accepted, got %v", err)
+	}
+
+	// Only the owner of the code can answer the request
+	recorder = answerRequest(t, stores, requester, requestId, true)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for the requester, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	recorder = answerRequest(t, stores, owner, requestId, true)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	for userId, partnerId := range map[int]int{owner: requester, requester: owner} {
+		linked, err := stores.Users.GetPartnerId(userId)
+		if err != nil || linked != partnerId {
+			t.Errorf("expected user %d to be linked with %d, got %d (%v)", userId, partnerId, linked, err)
+		}
+	}
+}
+
+func TestRejectedLinkRequestDoesNotLink(t *testing.T) {
+	stores := store.NewMemoryStores()
+	owner := createUser(t, stores, "Alice")
+	requester := createUser(t, stores, "Bob")
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+
+	requestId := requestIdFrom(t, requestLink(t, stores, requester, models.AccountLink{PairUUID: link.PairUUID}))
+	recorder := answerRequest(t, stores, owner, requestId, false)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if _, err := stores.Users.GetPartnerId(owner); !errors.Is(err, store.ErrNoPartner) {
+		t.Errorf("expected the owner to stay unlinked, got %v", err)
+	}
+
+	// An answered request cannot be answered again
+	recorder = answerRequest(t, stores, owner, requestId, true)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestLinkCodeCanOnlyBeRedeemedOnce(t *testing.T) {
+	stores := store.NewMemoryStores()
+	owner := createUser(t, stores, "Alice")
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+
+	recorder := requestLink(t, stores, createUser(t, stores, "Bob"), link)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, recorder.Code, recorder.Body.String())
+	}
+	recorder = requestLink(t, stores, createUser(t, stores, "Carol"), link)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a used code, got %d: %s", http.StatusNotFound, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAccountLinkHandlerRejectsOwnCode(t *testing.T) {
+	stores := store.NewMemoryStores()
+	owner := createUser(t, stores, "Alice")
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+
+	recorder := requestLink(t, stores, owner, link)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	}
+}
+
+// waitForMail waits for the asynchronously sent mail to the address
+func waitForMail(t *testing.T, mail *testMailer, to string) mailer.Message {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mail.mu.Lock()
+		for _, message := range mail.messages {
+			if message.To == to {
+				mail.mu.Unlock()
+				return message
+			}
+		}
+		mail.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected a mail to %s", to)
+	return mailer.Message{}
+}
+
+func TestAcceptingLinkRequestNotifiesDisplacedPartner(t *testing.T) {
+	stores := store.NewMemoryStores()
+	owner := createUser(t, stores, "Alice")
+	requester := createUser(t, stores, "Bob")
+	formerPartner := createUser(t, stores, "Carol")
+	if err := stores.Users.LinkUsers(requester, formerPartner); err != nil {
+		t.Fatalf("failed to link users: %v", err)
+	}
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+	requestId := requestIdFrom(t, requestLink(t, stores, requester, models.AccountLink{PairCode: link.PairCode}))
+
+	mail := &testMailer{}
+	recorder := serve(t, LinkRequestAnswerHandler(stores, mail, true), http.MethodPost, "/link-requests/:id/accept",
+		"/link-requests/"+strconv.Itoa(requestId)+"/accept", owner, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	if _, err := stores.Users.GetPartnerId(formerPartner); !errors.Is(err, store.ErrNoPartner) {
+		t.Errorf("expected the former partner to be unlinked, got %v", err)
+	}
+	message := waitForMail(t, mail, "carol@example.com")
+	if message.Subject != "Your Distance Tracker accounts were unlinked" || !strings.Contains(message.Body, "Bob") {
+		t.Errorf("expected an unlink notification naming Bob, got %q: %q", message.Subject, message.Body)
+	}
+
+	events, err := stores.Audit.AuditEventsForUser(requester)
+	if err != nil {
+		t.Fatalf("failed to read audit events: %v", err)
+	}
+	found := false
+	for _, event := range events {
+		found = found || event.Event == models.AuditPartnerUnlinked
+	}
+	if !found {
+		t.Errorf("expected the ended pairing in the audit log of the requester, got %v", events)
+	}
+}
+
+// newSQLStores returns stores on a fresh, fully migrated SQLite database, for tests that need real transactions
+func newSQLStores(t *testing.T) (*store.Stores, *sql.DB) {
+	t.Helper()
+	dbConn, err := sql.Open(database.SQLiteDriver, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = dbConn.Close()
+	})
+	if _, err := database.MigrateUp(dbConn, database.SQLite{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return store.NewSQLStores(dbConn, database.SQLite{}), dbConn
+}
+
+// inParallel runs the request for every user at the same time and returns the responses in the order of the users
+func inParallel(users []int, request func(userId int) *httptest.ResponseRecorder) []*httptest.ResponseRecorder {
+	recorders := make([]*httptest.ResponseRecorder, len(users))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, userId := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			recorders[i] = request(userId)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return recorders
+}
+
+func TestConcurrentRedemptionsOfOneLinkCode(t *testing.T) {
+	stores, _ := newSQLStores(t)
+	owner := createUser(t, stores, "Owner")
+	link, _, err := CreateUuidLink(stores, owner)
+	if err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+
+	requesters := make([]int, 16)
+	for i := range requesters {
+		requesters[i] = createUser(t, stores, "Requester"+strconv.Itoa(i))
+	}
+	recorders := inParallel(requesters, func(userId int) *httptest.ResponseRecorder {
+		return requestLink(t, stores, userId, models.AccountLink{PairUUID: link.PairUUID})
+	})
+
+	redeemed := 0
+	for i, recorder := range recorders {
+		switch recorder.Code {
+		case http.StatusAccepted:
+			redeemed++
+		case http.StatusNotFound:
+		default:
+			t.Errorf("requester %d: expected status %d or %d, got %d: %s", i, http.StatusAccepted,
+				http.StatusNotFound, recorder.Code, recorder.Body.String())
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("expected the code to be redeemed exactly once, it was redeemed %d times", redeemed)
+	}
+	requests, err := stores.LinkRequests.PendingLinkRequests(owner)
+	if err != nil || len(requests) != 1 {
+		t.Errorf("expected exactly one pending link request, got %d (%v)", len(requests), err)
+	}
+}
+
+func TestConcurrentlyAcceptedRequestsKeepPairingsConsistent(t *testing.T) {
+	stores, dbConn := newSQLStores(t)
+	requester := createUser(t, stores, "Requester")
+
+	// The requester redeems the codes of every owner, who then all accept at the same time
+	owners := make([]int, 16)
+	requestIds := map[int]int{}
+	for i := range owners {
+		owners[i] = createUser(t, stores, "Owner"+strconv.Itoa(i))
+		link, _, err := CreateUuidLink(stores, owners[i])
+		if err != nil {
+			t.Fatalf("failed to create link code: %v", err)
+		}
+		recorder := requestLink(t, stores, requester, models.AccountLink{PairUUID: link.PairUUID})
+		if recorder.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, recorder.Code, recorder.Body.String())
+		}
+		requestIds[owners[i]] = requestIdFrom(t, recorder)
+	}
+	recorders := inParallel(owners, func(ownerId int) *httptest.ResponseRecorder {
+		return answerRequest(t, stores, ownerId, requestIds[ownerId], true)
+	})
+
+	accepted := 0
+	for i, recorder := range recorders {
+		switch recorder.Code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusConflict:
+		default:
+			t.Errorf("owner %d: expected status %d or %d, got %d: %s", i, http.StatusOK, http.StatusConflict,
+				recorder.Code, recorder.Body.String())
+		}
+	}
+	if accepted == 0 {
+		t.Error("expected at least one accepted request")
+	}
+
+	// Whoever won, the requester ends up with exactly one partner who points back, and nobody else points at them
+	var pointingAtRequester int
+	err := dbConn.QueryRow("SELECT COUNT(*) FROM users WHERE linked_account = ?", requester).Scan(&pointingAtRequester)
+	if err != nil {
+		t.Fatalf("failed to count partners: %v", err)
+	}
+	if pointingAtRequester != 1 {
+		t.Errorf("expected exactly one user linked with the requester, got %d", pointingAtRequester)
+	}
+	var oneSided int
+	err = dbConn.QueryRow(`SELECT COUNT(*) FROM users WHERE linked_account IS NOT NULL AND NOT EXISTS (
+		SELECT 1 FROM users AS partner WHERE partner.id = users.linked_account AND partner.linked_account = users.id
+	)`).Scan(&oneSided)
+	if err != nil {
+		t.Fatalf("failed to count one-sided links: %v", err)
+	}
+	if oneSided != 0 {
+		t.Errorf("expected every link to be mutual, %d users point at someone who does not point back", oneSided)
+	}
+	partnerId, err := stores.Users.GetPartnerId(requester)
+	if err != nil {
+		t.Fatalf("expected the requester to be linked: %v", err)
+	}
+	links, err := stores.Users.PartnerLinks(requester)
+	if err != nil {
+		t.Fatalf("failed to read partner links: %v", err)
+	}
+	open := 0
+	for _, link := range links {
+		if link.EndedAt == nil {
+			open++
+			if link.PartnerID != partnerId {
+				t.Errorf("expected the open pairing to be with %d, got %d", partnerId, link.PartnerID)
+			}
+		}
+	}
+	if open != 1 || len(links) != accepted {
+		t.Errorf("expected %d pairings of which one is open, got %d with %d open", accepted, len(links), open)
+	}
+}
+
+func TestCreatingLinkCodeKeepsPairing(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+	bob := createUser(t, stores, "Bob")
+	if err := stores.Users.LinkUsers(alice, bob); err != nil {
+		t.Fatalf("failed to link users: %v", err)
+	}
+
+	if _, _, err := CreateUuidLink(stores, alice); err != nil {
+		t.Fatalf("failed to create link code: %v", err)
+	}
+	if partnerId, err := stores.Users.GetPartnerId(alice); err != nil || partnerId != bob {
+		t.Errorf("expected alice to stay linked with bob, got %d (%v)", partnerId, err)
+	}
+	links, err := stores.Users.PartnerLinks(alice)
+	if err != nil || len(links) != 1 || links[0].EndedAt != nil {
+		t.Errorf("expected the pairing to stay open, got %+v (%v)", links, err)
+	}
+}
+
+func TestLinkCodeExpiryFollowsStoredCreationTime(t *testing.T) {
+	stores, _ := newSQLStores(t)
+	alice := createUser(t, stores, "Alice")
+
+	recorder := serve(t, AccountLinkCreationHandler(stores), http.MethodPost, "/link", "/link", alice, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	// The database truncates its timestamps to seconds, an expiry taken from the clock of the server would not match
+	linkCode, err := stores.LinkCodes.GetUserLinkCode(alice)
+	if err != nil {
+		t.Fatalf("failed to find link code: %v", err)
+	}
+	if expected := linkCode.CreatedAt.Add(constants.LinkCodeLifetime); !response.ExpiresAt.Equal(expected) {
+		t.Errorf("expected the code to expire at %v, got %v", expected, response.ExpiresAt)
+	}
+}
@@ -1,138 +1,844 @@
 package auth
 
 import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/mailer"
 	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/qrcode"
+	"DistanceTrackerServer/store"
 	"DistanceTrackerServer/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 )
 
+// linkCodeQRScale is the size of a QR code module in pixels
+const linkCodeQRScale = 8
+
 var (
 	validateRegistration = ValidateRegistration
 	register             = Register
 	linkAccounts         = LinkAccounts
 	linkAccountCreation  = CreateUuidLink
+	linkCodeDeepLinkFor  = LinkCodeDeepLink
+	unlinkAccounts       = UnlinkAccounts
+	listLinkRequests     = ListLinkRequests
+	answerLinkRequest    = AnswerLinkRequest
 	login                = Login
-	emailFromContext     = utils.EmailFromContext
+	refreshTokens        = RefreshTokens
+	logout               = Logout
+	listSessions         = ListSessions
+	revokeUserSession    = RevokeUserSession
+	requestPasswordReset = RequestPasswordReset
+	resetPassword        = ResetPassword
+	verifyEmail          = VerifyEmail
+	resendVerification   = ResendEmailVerification
+	setupTwoFactor       = SetupTwoFactor
+	confirmTwoFactor     = ConfirmTwoFactor
+	completeTwoFactor    = CompleteTwoFactorLogin
+	deleteAccount        = DeleteAccount
+	updateProfile        = UpdateProfile
+	requestEmailChange   = RequestEmailChange
+	changePassword       = ChangePassword
+	claimsFromContext    = utils.ClaimsFromContext
 )
 
-func RegisterHandler(ctx *gin.Context) {
-	sugar, err := sugarFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+func RegisterHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		newUser := models.UserRegister{}
+		err = ctx.BindJSON(&newUser)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validateRegistration(newUser)
+		if validationErr != nil {
+			sugar.Errorw("Error", validationErr)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		userID, tokens, err := register(ctx, stores, mail, newUser)
+		if err != nil {
+			sugar.Errorw("registration error",
+				zap.String("Error", err.Error()),
+				zap.String("User", newUser.ToString()),
+			)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+
+		}
+
+		response := gin.H{"message": "user registered successfully", "user_id": userID, "email_verified": false}
+		if newUser.ReturnTokens {
+			response["tokens"] = tokens
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func LoginHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		loginData := models.UserLogin{}
+		err = ctx.BindJSON(&loginData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := login(ctx, stores, loginData.Email, loginData.Password, loginData.DeviceName)
+		if err != nil {
+			sugar.Errorw("Error", err)
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		if result.MFAToken != "" {
+			ctx.JSON(http.StatusOK, gin.H{
+				"message":      "two-factor code required",
+				"mfa_required": true,
+				"mfa_token":    result.MFAToken,
+				"expires_in":   int(constants.MFATokenLifetime.Seconds()),
+			})
+			return
+		}
+
+		response := gin.H{"message": "successfully logged in", "user_id": result.UserID}
+		if loginData.ReturnTokens {
+			response["tokens"] = result.Tokens
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func AccountLinkHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		accountLink := models.AccountLink{}
+		err = ctx.BindJSON(&accountLink)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, err := claimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		requestId, linkingErr := linkAccounts(ctx, stores, mail, accountLink, claims.UserID())
+		if errors.Is(linkingErr, errLinkCodeNotFound) {
+			// Unknown codes count towards the IP ban, so short codes cannot be guessed
+			rejectRequest(ctx, stores.Bans, http.StatusNotFound, "Unknown link code")
+			return
+		}
+		if errors.Is(linkingErr, errLinkCodeExpired) {
+			ctx.JSON(http.StatusGone, gin.H{"error": linkingErr.Error()})
+			return
+		}
+		if linkingErr != nil {
+			sugar.Errorw("linking error",
+				zap.String("Error", linkingErr.Error()),
+				zap.String("UserEmail", claims.Email),
+				zap.String("AccountLink", accountLink.ToString()),
+			)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": linkingErr.Error()})
+			return
+		}
+
+		sugar.Info("LINK REQUEST SENT")
+
+		ctx.JSON(http.StatusAccepted, gin.H{"message": "LINK REQUEST SENT", "request_id": requestId})
 	}
+}
+
+func LinkRequestsHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	newUser := models.UserRegister{}
-	err = ctx.BindJSON(&newUser)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		incoming, outgoing, err := listLinkRequests(ctx, stores)
+		if err != nil {
+			sugar.Errorw("link request listing error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"incoming": incoming, "outgoing": outgoing})
 	}
+}
+
+// LinkRequestAnswerHandler accepts or rejects the link request in the path
+func LinkRequestAnswerHandler(stores *store.Stores, mail mailer.Mailer, accept bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		requestId, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid link request ID"})
+			return
+		}
+
+		err = answerLinkRequest(ctx, stores, mail, requestId, accept)
+		if err != nil {
+			switch {
+			case errors.Is(err, errLinkRequestNotFound):
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, errLinkRequestExpired):
+				ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			case errors.Is(err, errLinkConflict):
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("link request answer error", zap.String("Error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
 
-	validationErr := validateRegistration(newUser)
-	if validationErr != nil {
-		sugar.Errorw("Error", validationErr)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
-		return
+		if accept {
+			sugar.Info("ACCOUNTS LINKED")
+			ctx.JSON(http.StatusOK, gin.H{"message": "ACCOUNT LINKED"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "LINK REQUEST REJECTED"})
 	}
+}
+
+func AccountLinkCreationHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		claims, err := claimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		accountLink, expiresAt, err := linkAccountCreation(stores, claims.UserID())
+		if errors.Is(err, errLinkConflict) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			sugar.Errorw("link account creation error",
+				zap.String("Error", err.Error()),
+				zap.String("UserLogin", claims.Email),
+			)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sugar.Info("LINK CODE CREATED", accountLink.ToString())
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "LINK CODE CREATED",
+			"pair_uuid":  accountLink.PairUUID,
+			"pair_code":  accountLink.PairCode,
+			"expires_at": expiresAt,
+			"deep_link":  linkCodeDeepLink(accountLink),
+		})
+	}
+}
+
+// LinkCodeQRHandler returns a QR code of the deep link for the current link code of the user, as PNG or with
+// format=svg as SVG
+func LinkCodeQRHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		format := ctx.DefaultQuery("format", "png")
+		if format != "png" && format != "svg" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+			return
+		}
+
+		claims, err := claimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		deepLink, err := linkCodeDeepLinkFor(stores, claims.UserID())
+		if err != nil {
+			if errors.Is(err, errNoLinkCode) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			sugar.Errorw("link code qr error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		code, err := qrcode.Encode([]byte(deepLink))
+		if err != nil {
+			sugar.Errorw("link code qr error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		// The code grants a link request, it must not end up in a shared cache
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Status(http.StatusOK)
+		if format == "svg" {
+			ctx.Header("Content-Type", "image/svg+xml")
+			err = code.WriteSVG(ctx.Writer, linkCodeQRScale)
+		} else {
+			ctx.Header("Content-Type", "image/png")
+			err = code.WritePNG(ctx.Writer, linkCodeQRScale)
+		}
+		if err != nil {
+			sugar.Warnw("Failed to write link code qr", zap.Error(err))
+		}
+	}
+}
+
+func AccountUnlinkHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		err = unlinkAccounts(ctx, stores, mail)
+		if err != nil {
+			if errors.Is(err, errNoPartner) || errors.Is(err, errLinkConflict) {
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			sugar.Errorw("unlinking error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		sugar.Info("ACCOUNTS UNLINKED")
+		ctx.JSON(http.StatusOK, gin.H{"message": "ACCOUNT UNLINKED"})
+	}
+}
+
+func RefreshHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		// Cookie clients send the refresh token as a cookie, other clients send it in the body and get the new tokens
+		// back in the body
+		refreshToken, err := ctx.Cookie(refreshTokenCookie)
+		fromBody := false
+		if err != nil || refreshToken == "" {
+			refreshRequest := models.RefreshRequest{}
+			if ctx.Request.ContentLength != 0 {
+				if err = ctx.ShouldBindJSON(&refreshRequest); err != nil {
+					ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			refreshToken = refreshRequest.RefreshToken
+			fromBody = true
+		}
+		if refreshToken == "" {
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Missing refresh token, please login")
+			return
+		}
+
+		userID, tokens, err := refreshTokens(ctx, stores, refreshToken)
+		if err != nil {
+			sugar.Errorw("token refresh error", zap.String("Error", err.Error()))
+			clearTokenCookies(ctx)
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Invalid refresh token, please login")
+			return
+		}
+
+		response := gin.H{"message": "tokens refreshed", "user_id": userID}
+		if fromBody {
+			response["tokens"] = tokens
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func LogoutHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	userID, err := register(ctx, newUser)
-	if err != nil {
-		sugar.Errorw("registration error",
-			zap.String("Error", err.Error()),
-			zap.String("User", newUser.ToString()),
-		)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		err = logout(ctx, stores)
+		if err != nil {
+			sugar.Errorw("logout error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
+		ctx.JSON(http.StatusOK, gin.H{"message": "successfully logged out"})
 	}
+}
+
+func ListSessionsHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "user registered successfully", "user_id": userID})
+		sessions, err := listSessions(ctx, stores)
+		if err != nil {
+			sugar.Errorw("list sessions error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
 }
 
-func LoginHandler(ctx *gin.Context) {
-	sugar, err := sugarFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+func RevokeSessionHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		sessionId := ctx.Param("id")
+		isCurrent, err := revokeUserSession(ctx, stores, sessionId)
+		if err != nil {
+			if errors.Is(err, errSessionNotFound) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			sugar.Errorw("revoke session error",
+				zap.String("Error", err.Error()),
+				zap.String("SessionId", sessionId),
+			)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		if isCurrent {
+			clearTokenCookies(ctx)
+		}
+		sugar.Infow("SESSION REVOKED", "session_id", sessionId)
+		ctx.JSON(http.StatusOK, gin.H{"message": "session revoked"})
 	}
+}
 
-	loginData := models.UserLogin{}
-	err = ctx.BindJSON(&loginData)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func ForgotPasswordHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		forgotPassword := models.ForgotPassword{}
+		err = ctx.BindJSON(&forgotPassword)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err = validateEmailFunc(forgotPassword.Email); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = requestPasswordReset(ctx, stores, mail, forgotPassword.Email)
+		if err != nil {
+			sugar.Errorw("password reset request error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"message": "if an account exists for this email, a password reset mail has been sent"})
 	}
+}
+
+func ResetPasswordHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		reset := models.PasswordReset{}
+		err = ctx.BindJSON(&reset)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = resetPassword(ctx, stores, mail, reset)
+		if err != nil {
+			if errors.Is(err, errInvalidResetToken) {
+				// Guessing reset tokens counts towards an IP ban like any other rejected request
+				rejectRequest(ctx, stores.Bans, http.StatusBadRequest, err.Error())
+				return
+			}
+			sugar.Errorw("password reset error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	userID, err := login(ctx, loginData.Email, loginData.Password)
-	if err != nil {
-		sugar.Errorw("Error", err)
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-		return
+		clearTokenCookies(ctx)
+		ctx.JSON(http.StatusOK, gin.H{"message": "password has been reset, please login"})
 	}
+}
+
+func VerifyEmailHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		verification := models.VerifyEmail{}
+		err = ctx.BindJSON(&verification)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = verifyEmail(ctx, stores, verification.Token)
+		if err != nil {
+			if errors.Is(err, errInvalidVerificationToken) {
+				rejectRequest(ctx, stores.Bans, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errors.Is(err, errEmailTaken) {
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			sugar.Errorw("email verification error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "successfully logged in", "user_id": userID})
+		ctx.JSON(http.StatusOK, gin.H{"message": "email verified"})
+	}
 }
 
-func AccountLinkHandler(ctx *gin.Context) {
-	sugar, err := sugarFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+func ResendVerificationHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		err = resendVerification(ctx, stores, mail)
+		if err != nil {
+			sugar.Errorw("resend verification error", zap.String("Error", err.Error()))
+			if errors.Is(err, errEmailAlreadyVerified) {
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"message": "verification mail sent"})
 	}
+}
+
+func TwoFactorSetupHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		setup := models.TwoFactorSetup{}
+		err = ctx.BindJSON(&setup)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret, uri, err := setupTwoFactor(ctx, stores, setup.Password)
+		if err != nil {
+			switch {
+			case errors.Is(err, errIncorrectPassword):
+				rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, err.Error())
+			case errors.Is(err, errTwoFactorAlreadyEnabled):
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("two-factor setup error", zap.String("Error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
 
-	accountLink := models.AccountLink{}
-	err = ctx.BindJSON(&accountLink)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		ctx.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
 	}
+}
+
+func TwoFactorConfirmHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		confirm := models.TwoFactorConfirm{}
+		err = ctx.BindJSON(&confirm)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	orgEmail, err := emailFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+		recoveryCodes, err := confirmTwoFactor(ctx, stores, confirm.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidTwoFactorCode):
+				rejectRequest(ctx, stores.Bans, http.StatusBadRequest, err.Error())
+			case errors.Is(err, errTwoFactorAlreadyEnabled), errors.Is(err, errTwoFactorNotStarted):
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("two-factor confirm error", zap.String("Error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
+
+		sugar.Info("TWO-FACTOR ENABLED")
+		ctx.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled", "recovery_codes": recoveryCodes})
 	}
+}
+
+func TwoFactorLoginHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		loginData := models.TwoFactorLogin{}
+		err = ctx.BindJSON(&loginData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	linkingErr := linkAccounts(ctx, accountLink, orgEmail)
-	if linkingErr != nil {
-		sugar.Errorw("linking error",
-			zap.String("Error", linkingErr.Error()),
-			zap.String("UserEmail", orgEmail),
-			zap.String("AccountLink", accountLink.ToString()),
-		)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": linkingErr.Error()})
-		return
+		userID, tokens, err := completeTwoFactor(ctx, stores, loginData)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidMFAToken), errors.Is(err, errInvalidTwoFactorCode):
+				rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, err.Error())
+			case errors.Is(err, errTwoFactorLocked):
+				rejectRequest(ctx, stores.Bans, http.StatusTooManyRequests, err.Error())
+			default:
+				sugar.Errorw("two-factor login error", zap.String("Error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
+
+		response := gin.H{"message": "successfully logged in", "user_id": userID}
+		if loginData.ReturnTokens {
+			response["tokens"] = tokens
+		}
+		ctx.JSON(http.StatusOK, response)
 	}
+}
+
+func DeleteAccountHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	sugar.Info("ACCOUNTS LINKED")
+		deletion := models.AccountDeletion{}
+		err = ctx.BindJSON(&deletion)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "ACCOUNT LINKED"})
+		err = deleteAccount(ctx, stores, deletion.Password)
+		if err != nil {
+			if errors.Is(err, errIncorrectPassword) {
+				rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, err.Error())
+				return
+			}
+			sugar.Errorw("account deletion error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"message": "account deleted"})
+	}
 }
 
-func AccountLinkCreationHandler(ctx *gin.Context) {
-	sugar, err := sugarFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+func UpdateProfileHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		update := models.ProfileUpdate{}
+		err = ctx.BindJSON(&update)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validateFirstName(update.FirstName); validationErr != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		info, err := updateProfile(ctx, stores, update)
+		if err != nil {
+			sugar.Errorw("profile update error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, info)
 	}
+}
 
-	orgEmail, err := emailFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+func EmailChangeHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		change := models.EmailChange{}
+		err = ctx.BindJSON(&change)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validateEmailFunc(change.Email); validationErr != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err = requestEmailChange(ctx, stores, mail, change)
+		if err != nil {
+			switch {
+			case errors.Is(err, errIncorrectPassword):
+				rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, err.Error())
+			case errors.Is(err, errEmailTaken), errors.Is(err, errEmailUnchanged):
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, errTooManyVerificationMails):
+				ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("email change error", zap.String("Error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
+
+		ctx.JSON(http.StatusAccepted, gin.H{"message": "please confirm the new address with the code we mailed to it"})
 	}
+}
+
+func ChangePasswordHandler(stores *store.Stores, mail mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		change := models.PasswordChange{}
+		err = ctx.BindJSON(&change)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	accountLink, err := linkAccountCreation(ctx, orgEmail)
-	if err != nil {
-		sugar.Errorw("link account creation error",
-			zap.String("Error", err.Error()),
-			zap.String("UserLogin", orgEmail),
-		)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		if validationErr := validatePasswordFunc(change.Password, change.ConfirmPassword); validationErr != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err = changePassword(ctx, stores, mail, change)
+		if err != nil {
+			if errors.Is(err, errIncorrectPassword) {
+				rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, err.Error())
+				return
+			}
+			sugar.Errorw("password change error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"message": "password changed, all other devices have been signed out"})
 	}
+}
 
-	sugar.Info("LINK CODE CREATED", accountLink.ToString())
-	ctx.JSON(http.StatusOK, gin.H{"message": "LINK CODE CREATED", "pair_uuid": accountLink.PairUUID})
+func JWKSHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		keys, err := keyring.JWKS()
+		if err != nil {
+			sugar.Errorw("jwks error", zap.String("Error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(http.StatusOK, gin.H{"keys": keys})
+	}
 }
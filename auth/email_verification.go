@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/mailer"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/url"
+	"time"
+)
+
+var (
+	errInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	errEmailAlreadyVerified     = errors.New("email address is already verified")
+	errTooManyVerificationMails = errors.New("too many verification mails requested, please try again later")
+)
+
+// tokenInstructions tells the user how to use a mailed token, either as a link if the base URL is configured or as a
+// code to paste into the app
+func tokenInstructions(baseURL string, token string, action string) string {
+	if baseURL == "" {
+		return "Use the following code in the app to " + action + ":\n\n" + token
+	}
+	return "Open the following link to " + action + ":\n\n" + baseURL + "?token=" + url.QueryEscape(token)
+}
+
+// createEmailVerificationToken stores a new verification token for the email, which replaces any token mailed before
+func createEmailVerificationToken(stores *store.Stores, userId int, email string) (string, error) {
+	recentVerifications, err := stores.EmailVerifications.CountRecentEmailVerifications(userId, time.Hour)
+	if err != nil {
+		return "", err
+	}
+	if recentVerifications >= constants.EmailVerificationsPerHour {
+		return "", errTooManyVerificationMails
+	}
+
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = stores.EmailVerifications.CreateEmailVerificationToken(models.EmailVerificationToken{
+		UserID:    userId,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(constants.EmailVerificationLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SendEmailVerification mails a verification token for the email to the user
+func SendEmailVerification(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, userId int, email string) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	token, err := createEmailVerificationToken(stores, userId, email)
+	if err != nil {
+		return err
+	}
+
+	go sendMail(mail, sugar, mailer.Message{
+		To:      email,
+		Subject: "Verify your Distance Tracker email address",
+		Body: fmt.Sprintf("Welcome to Distance Tracker!\n\n%s\n\nThe code expires in %d hours. If you did not create "+
+			"an account, you can ignore this mail.",
+			tokenInstructions(constants.EmailVerificationURL, token, "verify your email address"),
+			int(constants.EmailVerificationLifetime.Hours())),
+	})
+	return nil
+}
+
+// ResendEmailVerification sends a new verification mail to the user the request was authenticated as
+func ResendEmailVerification(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer) error {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	verifiedAt, err := stores.Users.EmailVerifiedAt(claims.UserID())
+	if err != nil {
+		return err
+	}
+	if verifiedAt != nil {
+		return errEmailAlreadyVerified
+	}
+
+	userInfo, err := stores.Users.GetUserInformation(claims.UserID())
+	if err != nil {
+		return err
+	}
+	return SendEmailVerification(ctx, stores, mail, claims.UserID(), userInfo.Email)
+}
+
+func VerifyEmail(ctx *gin.Context, stores *store.Stores, token string) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errInvalidVerificationToken
+	}
+
+	userId, err := stores.EmailVerifications.VerifyEmail(hashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+			return errInvalidVerificationToken
+		}
+		if errors.Is(err, store.ErrEmailExists) {
+			return errEmailTaken
+		}
+		return err
+	}
+	sugar.Infow("Email verified", zap.Int("user_id", userId))
+	return nil
+}
@@ -0,0 +1,440 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyFileExtension = ".pem"
+	// keyCreatedHeader is the PEM header holding the creation time of a key. File times change whenever a key is
+	// touched, copied to another replica or restored from a backup, the header travels with the key.
+	keyCreatedHeader = "Created"
+	// clockSkew is added to the verification grace period of superseded keys
+	clockSkew = time.Minute
+)
+
+var (
+	errUnknownKey = errors.New("unknown signing key")
+)
+
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// signingKey returns the key in the form golang-jwt expects for signing
+func (k *SigningKey) signingKey() crypto.PrivateKey {
+	if key, ok := k.Private.(*ed25519.PrivateKey); ok {
+		return *key
+	}
+	return k.Private
+}
+
+// Keyring holds every signing key we know of. The newest key signs new tokens, older keys keep verifying tokens until
+// everything they could have signed has expired, after which they are retired.
+type Keyring struct {
+	mu          sync.RWMutex
+	keys        []*SigningKey // newest first
+	keyFile     string
+	keysDir     string
+	algorithm   string
+	gracePeriod time.Duration
+	now         func() time.Time
+}
+
+func NewKeyring(keyFile string, keysDir string, algorithm string, gracePeriod time.Duration) *Keyring {
+	return &Keyring{
+		keyFile:     keyFile,
+		keysDir:     keysDir,
+		algorithm:   algorithm,
+		gracePeriod: gracePeriod + clockSkew,
+		now:         time.Now,
+	}
+}
+
+// Load (re)reads the configured key file and key directory. Only files ending in .pem are loaded, so renaming a key
+// file (e.g. to <kid>.pem.retired) retires it on the next reload. If no key exists yet and a directory is configured,
+// a first key is generated into it.
+//
+// Keys are ordered by the creation time in their Created header. Keys in the directory without one, like keys
+// created with openssl or by earlier versions, get the time of their file written into the header the first time they
+// are loaded. The configured key file is never written to, without a header it counts as the oldest key.
+func (k *Keyring) Load() error {
+	var keys []*SigningKey
+
+	if k.keyFile != "" {
+		key, err := loadKeyFile(k.keyFile, "")
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	if k.keysDir != "" {
+		entries, err := os.ReadDir(k.keysDir)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT keys directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), keyFileExtension) {
+				continue
+			}
+			kid := strings.TrimSuffix(entry.Name(), keyFileExtension)
+			path := filepath.Join(k.keysDir, entry.Name())
+			key, err := loadKeyFile(path, kid)
+			if err != nil {
+				return err
+			}
+			if key.CreatedAt.IsZero() {
+				if key.CreatedAt, err = recordCreatedAt(path); err != nil {
+					return err
+				}
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		if k.keysDir == "" {
+			return fmt.Errorf("no JWT signing key configured, set DTS_JWT_SECRET_KEY or DTS_JWT_KEYS_DIR")
+		}
+		key, err := k.generateKey()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func loadKeyFile(path string, kid string) (*SigningKey, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key %s: %w", path, err)
+	}
+	rawKey, err := ssh.ParseRawPrivateKey(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %s: %w", path, err)
+	}
+	createdAt, err := keyCreatedAt(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %s: %w", path, err)
+	}
+
+	signer, method, err := signerAndMethod(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported JWT key %s: %w", path, err)
+	}
+	if kid == "" {
+		kid, err = thumbprint(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &SigningKey{ID: kid, Method: method, Private: signer, CreatedAt: createdAt}, nil
+}
+
+// keyCreatedAt reads the Created header of the PEM encoded key, keys without one return the zero time
+func keyCreatedAt(bytes []byte) (time.Time, error) {
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM block found")
+	}
+	value, ok := block.Headers[keyCreatedHeader]
+	if !ok {
+		return time.Time{}, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s header %q: %w", keyCreatedHeader, value, err)
+	}
+	return createdAt, nil
+}
+
+// recordCreatedAt writes the modification time of the key file into its Created header and returns it. The file is
+// replaced atomically, so other replicas never read a half written key.
+func recordCreatedAt(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read JWT key %s: %w", path, err)
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read JWT key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("failed to parse JWT key %s: no PEM block found", path)
+	}
+
+	createdAt := info.ModTime().UTC().Truncate(time.Second)
+	if block.Headers == nil {
+		block.Headers = map[string]string{}
+	}
+	block.Headers[keyCreatedHeader] = createdAt.Format(time.RFC3339)
+	if err = writeKeyFile(path, block); err != nil {
+		return time.Time{}, err
+	}
+	return createdAt, nil
+}
+
+func writeKeyFile(path string, block *pem.Block) error {
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, pem.EncodeToMemory(block), 0600); err != nil {
+		return fmt.Errorf("failed to write JWT key: %w", err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		_ = os.Remove(temporary)
+		return fmt.Errorf("failed to write JWT key: %w", err)
+	}
+	return nil
+}
+
+func signerAndMethod(rawKey any) (crypto.Signer, jwt.SigningMethod, error) {
+	switch key := rawKey.(type) {
+	case *rsa.PrivateKey:
+		return key, jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return key, jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return key, jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return key, jwt.SigningMethodES512, nil
+		}
+		return nil, nil, fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return &key, jwt.SigningMethodEdDSA, nil
+	case *ed25519.PrivateKey:
+		return key, jwt.SigningMethodEdDSA, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported key type %T", rawKey)
+}
+
+// thumbprint derives a stable key ID from the public key
+func thumbprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// generateKey creates a new key with the configured algorithm and writes it to the keys directory
+func (k *Keyring) generateKey() (*SigningKey, error) {
+	var rawKey any
+	var err error
+	switch k.algorithm {
+	case "", "RS256":
+		rawKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		rawKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		rawKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		rawKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, rawKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported JWT key algorithm %s", k.algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT key: %w", err)
+	}
+
+	signer, method, err := signerAndMethod(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := thumbprint(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JWT key: %w", err)
+	}
+	createdAt := k.now().UTC().Truncate(time.Second)
+	block := &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{keyCreatedHeader: createdAt.Format(time.RFC3339)},
+		Bytes:   der,
+	}
+	if err = writeKeyFile(filepath.Join(k.keysDir, kid+keyFileExtension), block); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: kid, Method: method, Private: signer, CreatedAt: createdAt}, nil
+}
+
+// activeKeys returns the keys that may still verify tokens, newest first. A key is retired once the key that
+// superseded it has been signing for longer than the grace period.
+func (k *Keyring) activeKeys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	var active []*SigningKey
+	for i, key := range k.keys {
+		if i > 0 && now.After(k.keys[i-1].CreatedAt.Add(k.gracePeriod)) {
+			break
+		}
+		active = append(active, key)
+	}
+	return active
+}
+
+func (k *Keyring) SigningKey() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return nil, fmt.Errorf("no JWT signing key loaded")
+	}
+	return k.keys[0], nil
+}
+
+func (k *Keyring) VerificationKey(kid string) (*SigningKey, error) {
+	for _, key := range k.activeKeys() {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errUnknownKey, kid)
+}
+
+// Algorithms lists the signing algorithms of the active keys, tokens using any other algorithm are rejected
+func (k *Keyring) Algorithms() []string {
+	var algorithms []string
+	seen := map[string]bool{}
+	for _, key := range k.activeKeys() {
+		if !seen[key.Method.Alg()] {
+			seen[key.Method.Alg()] = true
+			algorithms = append(algorithms, key.Method.Alg())
+		}
+	}
+	return algorithms
+}
+
+// Rotate generates a new signing key if the current one is older than the interval
+func (k *Keyring) Rotate(interval time.Duration) (bool, error) {
+	if k.keysDir == "" {
+		return false, fmt.Errorf("key rotation requires DTS_JWT_KEYS_DIR")
+	}
+
+	current, err := k.SigningKey()
+	if err != nil {
+		return false, err
+	}
+	if k.now().Sub(current.CreatedAt) < interval {
+		return false, nil
+	}
+
+	if _, err = k.generateKey(); err != nil {
+		return false, err
+	}
+	return true, k.Load()
+}
+
+// StartRotation periodically reloads the keys directory, so keys rotated by other replicas are picked up, and
+// rotates the signing key once it is older than the interval.
+func (k *Keyring) StartRotation(interval time.Duration, sugar *zap.SugaredLogger) {
+	checkEvery := min(interval/10, time.Hour)
+	go func() {
+		for {
+			time.Sleep(checkEvery)
+			if err := k.Load(); err != nil {
+				sugar.Errorw("Failed to reload JWT keys", zap.Error(err))
+				continue
+			}
+			rotated, err := k.Rotate(interval)
+			if err != nil {
+				sugar.Errorw("Failed to rotate JWT signing key", zap.Error(err))
+				continue
+			}
+			if rotated {
+				current, _ := k.SigningKey()
+				sugar.Infow("Rotated JWT signing key", "kid", current.ID)
+			}
+		}
+	}()
+}
+
+// JWK is the JSON Web Key representation of a public verification key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k *Keyring) JWKS() ([]JWK, error) {
+	keys := []JWK{}
+	for _, key := range k.activeKeys() {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch publicKey := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = publicKey.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+		}
+		keys = append(keys, jwk)
+	}
+	return keys, nil
+}
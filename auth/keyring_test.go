@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateKeyForEveryAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "ES384", "ES512", "EdDSA"} {
+		keyring := NewKeyring("", t.TempDir(), algorithm, time.Hour)
+		if err := keyring.Load(); err != nil {
+			t.Errorf("%s: failed to generate a first key: %v", algorithm, err)
+			continue
+		}
+		key, err := keyring.SigningKey()
+		if err != nil {
+			t.Errorf("%s: no signing key: %v", algorithm, err)
+			continue
+		}
+		if key.Method.Alg() != algorithm {
+			t.Errorf("expected a %s key, got %s", algorithm, key.Method.Alg())
+		}
+	}
+}
+
+func TestKeyCreationTimeSurvivesFileTimeChanges(t *testing.T) {
+	dir := t.TempDir()
+	keyring := NewKeyring("", dir, "ES256", time.Hour)
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	keyring.now = func() time.Time { return created }
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	first, _ := keyring.SigningKey()
+
+	keyring.now = func() time.Time { return created.Add(48 * time.Hour) }
+	if rotated, err := keyring.Rotate(24 * time.Hour); err != nil || !rotated {
+		t.Fatalf("expected the key to be rotated, got %t (%v)", rotated, err)
+	}
+	second, _ := keyring.SigningKey()
+	if second.ID == first.ID {
+		t.Fatal("expected a new signing key after rotating")
+	}
+
+	// Touching the old key, as a restore from backup or a copy to another replica would, must not make it sign again
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, first.ID+keyFileExtension), now, now); err != nil {
+		t.Fatalf("failed to touch key: %v", err)
+	}
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to reload keys: %v", err)
+	}
+	current, _ := keyring.SigningKey()
+	if current.ID != second.ID {
+		t.Errorf("expected %s to keep signing, got %s", second.ID, current.ID)
+	}
+	if !current.CreatedAt.Equal(created.Add(48 * time.Hour)) {
+		t.Errorf("expected the recorded creation time, got %s", current.CreatedAt)
+	}
+
+	// The old key keeps verifying during the grace period and is retired afterwards
+	if _, err := keyring.VerificationKey(first.ID); err != nil {
+		t.Errorf("expected the superseded key to verify during the grace period: %v", err)
+	}
+	keyring.now = func() time.Time { return created.Add(50 * time.Hour) }
+	if _, err := keyring.VerificationKey(first.ID); err == nil {
+		t.Error("expected the superseded key to be retired after the grace period")
+	}
+}
+
+func TestKeyWithoutCreatedHeaderIsStampedOnce(t *testing.T) {
+	dir := t.TempDir()
+	rawKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(rawKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	// Keys made with openssl have no headers
+	path := filepath.Join(dir, "external"+keyFileExtension)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	modified := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("failed to set file time: %v", err)
+	}
+
+	keyring := NewKeyring("", dir, "ES256", time.Hour)
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	key, _ := keyring.SigningKey()
+	if key.ID != "external" || !key.CreatedAt.Equal(modified) {
+		t.Fatalf("expected the external key created at %s, got %s created at %s", modified, key.ID, key.CreatedAt)
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(bytes)
+	if block == nil || block.Headers[keyCreatedHeader] != modified.Format(time.RFC3339) {
+		t.Fatalf("expected the file time to be recorded in the key, got %v", block)
+	}
+
+	// From now on the header counts, not the file time
+	if err := os.Chtimes(path, time.Now(), time.Now()); err != nil {
+		t.Fatalf("failed to touch key: %v", err)
+	}
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to reload keys: %v", err)
+	}
+	key, _ = keyring.SigningKey()
+	if !key.CreatedAt.Equal(modified) {
+		t.Errorf("expected the recorded creation time %s, got %s", modified, key.CreatedAt)
+	}
+}
+
+func TestConfiguredKeyFileIsNotModified(t *testing.T) {
+	rawKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(rawKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.key")
+	content := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, content, 0400); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	keyring := NewKeyring(path, "", "", time.Hour)
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to load key file: %v", err)
+	}
+	key, _ := keyring.SigningKey()
+	if key.Method.Alg() != "ES384" || !key.CreatedAt.IsZero() {
+		t.Errorf("expected an ES384 key without creation time, got %s created at %s", key.Method.Alg(), key.CreatedAt)
+	}
+	if bytes, _ := os.ReadFile(path); string(bytes) != string(content) {
+		t.Error("expected the configured key file to be left alone")
+	}
+}
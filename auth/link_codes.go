@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"net/url"
+)
+
+// shortLinkCodeAttempts is how often a new short code is generated when it collides with an existing one
+const shortLinkCodeAttempts = 5
+
+// linkCodeDeepLink returns the link a QR code for the link code points to. Codes created before short codes existed
+// are only known by their UUID.
+func linkCodeDeepLink(link models.AccountLink) string {
+	query := url.Values{}
+	if link.PairCode != "" {
+		query.Set("code", link.PairCode)
+	} else {
+		query.Set("pair_uuid", link.PairUUID.String())
+	}
+	return constants.LinkCodeURL + "?" + query.Encode()
+}
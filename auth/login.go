@@ -1,7 +1,8 @@
 package auth
 
 import (
-	"DistanceTrackerServer/utils"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
 	"crypto/rand"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -9,8 +10,11 @@ import (
 )
 
 var (
-	createToken = CreateToken
-	randomHash  = generateRandomHash()
+	createToken    = CreateToken
+	createMFAToken = CreateMFAToken
+	verifyMFAToken = VerifyMFAToken
+	issueTokens    = IssueTokens
+	randomHash     = generateRandomHash()
 )
 
 func randomString(length int) string {
@@ -33,36 +37,54 @@ func generateRandomHash() []byte {
 	return hash
 }
 
-func Login(ctx *gin.Context, email string, password string) (int, error) {
+// confirmPassword makes a logged-in user re-enter their password before sensitive changes
+func confirmPassword(users store.UserStore, userId int, password string) error {
+	passwordHash, err := users.GetPasswordHash(userId)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return errIncorrectPassword
+	}
+	return nil
+}
+
+// Login checks the password of the user. Without two-factor authentication the user is logged in right away,
+// otherwise the result only carries an MFA token for CompleteTwoFactorLogin.
+func Login(ctx *gin.Context, stores *store.Stores, email string, password string, deviceName string) (models.LoginResult, error) {
 	// First we get the password hash from the database
 	// Then we compare the password hash with the password
 	// If they match, we return the user ID
 	// If they don't match, we return an error
 
-	dbConn, err := utils.DBConnFromContext(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get database connection: %w", err)
-	}
-
-	var userID int
-	var passwordHash string
-	err = dbConn.QueryRow("SELECT id, password FROM users WHERE email = ?", email).Scan(&userID, &passwordHash)
+	userID, passwordHash, err := stores.Users.GetCredentials(email)
 	if err != nil {
 		// Hash and compare password to a random value to ensure we don't leak information based on the runtime of the request
 		_ = bcrypt.CompareHashAndPassword(randomHash, []byte(password))
 
-		return 0, fmt.Errorf("failed to get user from database: %w", err)
+		return models.LoginResult{}, fmt.Errorf("failed to get user from database: %w", err)
 	}
 
 	// Check if the password is correct
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
-		return 0, fmt.Errorf("password is incorrect: %w", err)
+		return models.LoginResult{}, fmt.Errorf("password is incorrect: %w", err)
+	}
+
+	enabled, err := twoFactorEnabled(stores.TwoFactor, userID)
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+	if enabled {
+		mfaToken, err := createMFAToken(userID, email)
+		if err != nil {
+			return models.LoginResult{}, fmt.Errorf("failed to create MFA token: %w", err)
+		}
+		return models.LoginResult{UserID: userID, MFAToken: mfaToken}, nil
 	}
 
-	tokenString, err := createToken(email)
+	tokens, err := issueTokens(ctx, stores, userID, email, deviceName)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create token: %w", err)
+		return models.LoginResult{}, err
 	}
-	ctx.SetCookie("token", tokenString, 3600, "/", "", false, true)
-	return userID, nil
+	return models.LoginResult{UserID: userID, Tokens: tokens}, nil
 }
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/mailer"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+var (
+	errInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+// RequestPasswordReset mails a single-use reset token to the user. Unknown emails are silently ignored, so the response
+// does not reveal whether an account exists.
+func RequestPasswordReset(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, email string) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	userId, err := stores.Users.GetUserIdByEmail(email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			sugar.Infow("Password reset requested for unknown email", zap.String("email", email))
+			return nil
+		}
+		return err
+	}
+
+	recentResets, err := stores.PasswordResets.CountRecentPasswordResets(userId, time.Hour)
+	if err != nil {
+		return err
+	}
+	if recentResets >= constants.PasswordResetsPerHour {
+		sugar.Warnw("Too many password reset requests, not sending another mail", zap.Int("user_id", userId))
+		return nil
+	}
+
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = stores.PasswordResets.CreatePasswordResetToken(models.PasswordResetToken{
+		UserID:    userId,
+		TokenHash: tokenHash,
+		IPAddress: ctx.ClientIP(),
+		ExpiresAt: time.Now().Add(constants.PasswordResetLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sending can take a while, doing it in the background keeps known and unknown emails indistinguishable by timing
+	go sendMail(mail, sugar, passwordResetMail(email, token))
+	return nil
+}
+
+func passwordResetMail(email string, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Reset your Distance Tracker password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Distance Tracker account.\n\n%s\n\n"+
+			"The code expires in %d minutes and can only be used once. If you did not ask for this, you can ignore "+
+			"this mail.", tokenInstructions(constants.PasswordResetURL, token, "choose a new password"),
+			int(constants.PasswordResetLifetime.Minutes())),
+	}
+}
+
+// ResetPassword sets a new password using a mailed reset token. Every session of the user is signed out.
+func ResetPassword(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, reset models.PasswordReset) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if reset.Token == "" {
+		return errInvalidResetToken
+	}
+	if err := validatePasswordFunc(reset.Password, reset.ConfirmPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(reset.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	userId, err := stores.PasswordResets.ResetPassword(hashOpaqueToken(reset.Token), passwordHash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+			return errInvalidResetToken
+		}
+		return err
+	}
+	sugar.Infow("Password reset", zap.Int("user_id", userId))
+
+	userInfo, err := stores.Users.GetUserInformation(userId)
+	if err != nil {
+		sugar.Warnw("Failed to load user for password change notification", zap.Error(err))
+		return nil
+	}
+	go sendMail(mail, sugar, mailer.Message{
+		To:      userInfo.Email,
+		Subject: "Your Distance Tracker password was changed",
+		Body: "The password of your Distance Tracker account was just reset and all devices were signed out.\n\n" +
+			"If this was not you, reset your password again right away.",
+	})
+	return nil
+}
+
+func sendMail(mail mailer.Mailer, sugar *zap.SugaredLogger, message mailer.Message) {
+	if err := mail.Send(message); err != nil {
+		sugar.Errorw("Failed to send mail", zap.String("subject", message.Subject), zap.Error(err))
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/mailer"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errEmailTaken     = errors.New("email already exists")
+	errEmailUnchanged = errors.New("this is already the email address of the account")
+)
+
+// UpdateProfile changes the first name of the authenticated user and returns the updated information
+func UpdateProfile(ctx *gin.Context, stores *store.Stores, update models.ProfileUpdate) (models.UserInformation, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return models.UserInformation{}, err
+	}
+
+	if err := stores.Users.UpdateFirstName(claims.UserID(), update.FirstName); err != nil {
+		return models.UserInformation{}, err
+	}
+	return stores.Users.GetUserInformation(claims.UserID())
+}
+
+// RequestEmailChange mails a verification token to the new address. The email of the account only changes once the
+// token is used through VerifyEmail, until then the user keeps logging in with the old address.
+func RequestEmailChange(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, change models.EmailChange) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(stores.Users, claims.UserID(), change.Password); err != nil {
+		return err
+	}
+
+	userInfo, err := stores.Users.GetUserInformation(claims.UserID())
+	if err != nil {
+		return err
+	}
+	if userInfo.Email == change.Email {
+		return errEmailUnchanged
+	}
+	if _, err := stores.Users.GetUserIdByEmail(change.Email); err == nil {
+		return errEmailTaken
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	token, err := createEmailVerificationToken(stores, claims.UserID(), change.Email)
+	if err != nil {
+		return err
+	}
+
+	err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    claims.UserID(),
+		Event:     models.AuditEmailChangeRequested,
+		IPAddress: ctx.ClientIP(),
+	})
+	if err != nil {
+		sugar.Warnw("Failed to record email change request", zap.Error(err))
+	}
+
+	go sendMail(mail, sugar, mailer.Message{
+		To:      change.Email,
+		Subject: "Confirm your new Distance Tracker email address",
+		Body: fmt.Sprintf("You asked to use this address for your Distance Tracker account.\n\n%s\n\nThe code expires "+
+			"in %d hours. If you did not ask for this, you can ignore this mail.",
+			tokenInstructions(constants.EmailVerificationURL, token, "confirm your new email address"),
+			int(constants.EmailVerificationLifetime.Hours())),
+	})
+	go sendMail(mail, sugar, mailer.Message{
+		To:      userInfo.Email,
+		Subject: "Your Distance Tracker email address is being changed",
+		Body: "Someone asked to change the email address of your Distance Tracker account to " + change.Email +
+			". The change only happens once the new address is confirmed.\n\nIf this was not you, change your " +
+			"password right away.",
+	})
+	sugar.Infow("Email change requested", zap.Int("user_id", claims.UserID()))
+	return nil
+}
+
+// ChangePassword sets a new password for the authenticated user after checking the current one. Every other session
+// is signed out, the session making the request stays logged in.
+func ChangePassword(ctx *gin.Context, stores *store.Stores, mail mailer.Mailer, change models.PasswordChange) error {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(stores.Users, claims.UserID(), change.CurrentPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(change.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := stores.Users.ChangePassword(claims.UserID(), passwordHash, claims.SessionID); err != nil {
+		return err
+	}
+
+	err = stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    claims.UserID(),
+		Event:     models.AuditPasswordChanged,
+		IPAddress: ctx.ClientIP(),
+	})
+	if err != nil {
+		sugar.Warnw("Failed to record password change", zap.Error(err))
+	}
+	sugar.Infow("Password changed", zap.Int("user_id", claims.UserID()))
+
+	userInfo, err := stores.Users.GetUserInformation(claims.UserID())
+	if err != nil {
+		sugar.Warnw("Failed to load user for password change notification", zap.Error(err))
+		return nil
+	}
+	go sendMail(mail, sugar, mailer.Message{
+		To:      userInfo.Email,
+		Subject: "Your Distance Tracker password was changed",
+		Body: "The password of your Distance Tracker account was just changed and all other devices were signed " +
+			"out.\n\nIf this was not you, reset your password right away.",
+	})
+	return nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+)
+
+var (
+	errRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+)
+
+// generateOpaqueToken returns a random token for the client and the hash we keep in the database. It is used for
+// refresh tokens and every token we send out by mail.
+func generateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashOpaqueToken(token), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func setTokenCookies(ctx *gin.Context, accessToken string, refreshToken string) {
+	ctx.SetCookie(accessTokenCookie, accessToken, int(constants.AccessTokenLifetime.Seconds()), "/", "", false, true)
+	ctx.SetCookie(refreshTokenCookie, refreshToken, int(constants.RefreshTokenLifetime.Seconds()), "/", "", false, true)
+}
+
+func newTokenPair(accessToken string, refreshToken string) models.TokenPair {
+	return models.TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(constants.AccessTokenLifetime.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(constants.RefreshTokenLifetime.Seconds()),
+	}
+}
+
+func clearTokenCookies(ctx *gin.Context) {
+	ctx.SetCookie(accessTokenCookie, "", -1, "/", "", false, true)
+	ctx.SetCookie(refreshTokenCookie, "", -1, "/", "", false, true)
+}
+
+// IssueTokens starts a new session for the user and hands out an access and a refresh token. The session ID doubles
+// as the refresh token family, so revoking the session revokes every refresh token issued for it. The tokens are set
+// as cookies and returned, so handlers can also put them in the response body.
+func IssueTokens(ctx *gin.Context, stores *store.Stores, userId int, email string, deviceName string) (models.TokenPair, error) {
+	sessionId := uuid.New().String()
+	if deviceName == "" {
+		deviceName = ctx.GetHeader("X-Device-Name")
+	}
+
+	err := stores.Sessions.CreateSession(models.Session{
+		ID:         sessionId,
+		UserID:     userId,
+		DeviceName: truncate(deviceName, 100),
+		UserAgent:  ctx.Request.UserAgent(),
+		IPAddress:  ctx.ClientIP(),
+	})
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	accessToken, err := createToken(userId, email, sessionId)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	refreshToken, refreshTokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	err = stores.Refresh.CreateRefreshToken(models.RefreshToken{
+		UserID:    userId,
+		FamilyID:  sessionId,
+		TokenHash: refreshTokenHash,
+		ExpiresAt: time.Now().Add(constants.RefreshTokenLifetime),
+	})
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	ctx.Set("session_id", sessionId)
+	setTokenCookies(ctx, accessToken, refreshToken)
+	return newTokenPair(accessToken, refreshToken), nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access and refresh token. Presenting a refresh token that has
+// already been rotated means it was stolen or replayed, so the whole session gets revoked.
+func RefreshTokens(ctx *gin.Context, stores *store.Stores, refreshToken string) (int, models.TokenPair, error) {
+	current, err := stores.Refresh.GetRefreshToken(hashOpaqueToken(refreshToken))
+	if err != nil {
+		return 0, models.TokenPair{}, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+
+	session, err := stores.Sessions.GetSession(current.FamilyID)
+	if err != nil {
+		return 0, models.TokenPair{}, fmt.Errorf("failed to find session for refresh token: %w", err)
+	}
+	if session.IsRevoked() {
+		return 0, models.TokenPair{}, fmt.Errorf("session has been revoked")
+	}
+
+	if current.IsRevoked() {
+		if err := stores.Sessions.RevokeSession(session.ID); err != nil {
+			return 0, models.TokenPair{}, err
+		}
+		return 0, models.TokenPair{}, errRefreshTokenReused
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return 0, models.TokenPair{}, fmt.Errorf("refresh token expired")
+	}
+
+	userInfo, err := stores.Users.GetUserInformation(current.UserID)
+	if err != nil {
+		return 0, models.TokenPair{}, fmt.Errorf("failed to retrieve user for refresh token: %w", err)
+	}
+
+	newRefreshToken, newRefreshTokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return 0, models.TokenPair{}, err
+	}
+	err = stores.Refresh.RotateRefreshToken(current.ID, models.RefreshToken{
+		UserID:    current.UserID,
+		FamilyID:  current.FamilyID,
+		TokenHash: newRefreshTokenHash,
+		ExpiresAt: time.Now().Add(constants.RefreshTokenLifetime),
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrRevoked) {
+			// Another request rotated the token between our read and the rotation, treat it as reuse
+			if err := stores.Sessions.RevokeSession(session.ID); err != nil {
+				return 0, models.TokenPair{}, err
+			}
+			return 0, models.TokenPair{}, errRefreshTokenReused
+		}
+		return 0, models.TokenPair{}, err
+	}
+
+	accessToken, err := createToken(current.UserID, userInfo.Email, session.ID)
+	if err != nil {
+		return 0, models.TokenPair{}, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	err = stores.Sessions.TouchSession(session.ID, ctx.ClientIP())
+	if err != nil {
+		return 0, models.TokenPair{}, err
+	}
+
+	ctx.Set("email", userInfo.Email)
+	ctx.Set("session_id", session.ID)
+	setTokenCookies(ctx, accessToken, newRefreshToken)
+	return current.UserID, newTokenPair(accessToken, newRefreshToken), nil
+}
+
+// Logout revokes the session the request was authenticated with and clears the token cookies
+func Logout(ctx *gin.Context, stores *store.Stores) error {
+	defer clearTokenCookies(ctx)
+
+	sessionId, err := sessionIdFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return stores.Sessions.RevokeSession(sessionId)
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return value
+}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"DistanceTrackerServer/mailer"
 	"DistanceTrackerServer/models"
-	"DistanceTrackerServer/utils"
+	"DistanceTrackerServer/store"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -12,9 +14,10 @@ import (
 )
 
 var (
-	validateEmailFunc    = ValidateEmail
-	validatePasswordFunc = ValidatePassword
-	validateFirstName    = ValidateFirstName
+	validateEmailFunc     = ValidateEmail
+	validatePasswordFunc  = ValidatePassword
+	validateFirstName     = ValidateFirstName
+	sendEmailVerification = SendEmailVerification
 )
 
 func ValidateEmail(email string) error {
@@ -93,7 +96,8 @@ func ValidateRegistration(user models.UserRegister) error {
 	return nil
 }
 
-func Register(ctx *gin.Context, user models.UserRegister) (int, error) {
+// Register creates the user, mails them a verification token and logs them in
+func Register(ctx *gin.Context, stores *store.Stores, sender mailer.Mailer, user models.UserRegister) (int, models.TokenPair, error) {
 	//sugar, err := utils.SugarFromContext(ctx)
 	//if err != nil {
 	//	return fmt.Errorf("failed to retrieve logger from context: %s", err)
@@ -101,31 +105,29 @@ func Register(ctx *gin.Context, user models.UserRegister) (int, error) {
 	password := ([]byte)(user.Password)
 	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
 	if err != nil {
-		return 0, fmt.Errorf("failed to hash password: %s", err)
+		return 0, models.TokenPair{}, fmt.Errorf("failed to hash password: %s", err)
 	}
 
-	dbConn, err := utils.DBConnFromContext(ctx)
+	userID, err := stores.Users.CreateUser(user.Email, user.FirstName, hashedPassword)
 	if err != nil {
-		return 0, err
-	}
-	res, err := dbConn.Exec("INSERT INTO users(id, email, name, password) VALUES(NULL, ?, ?, ?)",
-		user.Email, user.FirstName, hashedPassword)
-	if err != nil {
-		if err.Error() == "UNIQUE constraint failed: users.email" {
-			return 0, fmt.Errorf("email already exists")
+		if errors.Is(err, store.ErrEmailExists) {
+			return 0, models.TokenPair{}, errEmailTaken
 		}
-		return 0, fmt.Errorf("failed to insert registration into db")
+		return 0, models.TokenPair{}, fmt.Errorf("failed to insert registration into db")
 	}
-	userID, err := res.LastInsertId()
+
+	// The account is usable without verification, so a failing mail server must not fail the registration
+	err = sendEmailVerification(ctx, stores, sender, userID, user.Email)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get last insert id from db insert: %s", err)
+		if sugar, sugarErr := sugarFromContext(ctx); sugarErr == nil {
+			sugar.Warnw("Failed to send verification mail", "user_id", userID, "error", err)
+		}
 	}
 
-	tokenString, err := createToken(user.Email)
+	tokens, err := issueTokens(ctx, stores, userID, user.Email, user.DeviceName)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create token: %w", err)
+		return 0, models.TokenPair{}, err
 	}
-	ctx.SetCookie("token", tokenString, 3600, "/", "", false, true)
 
-	return int(userID), nil
+	return userID, tokens, nil
 }
@@ -1,27 +1,88 @@
 package auth
 
 import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/store"
 	"DistanceTrackerServer/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
+	"time"
 )
 
 var (
-	verifyToken      = VerifyToken
-	sugarFromContext = utils.SugarFromContext
+	verifyToken          = VerifyToken
+	sugarFromContext     = utils.SugarFromContext
+	sessionIdFromContext = utils.SessionIdFromContext
 )
 
+var (
+	// loggedOutOnlyPaths can only be used without a token
+	loggedOutOnlyPaths = map[string]bool{
+		"/login":     true,
+		"/login/2fa": true,
+		"/register":  true,
+	}
+	// publicPaths do not need an access token, they authenticate the request themselves if necessary
+	publicPaths = map[string]bool{
+		"/token/refresh":         true,
+		"/.well-known/jwks.json": true,
+		"/password/forgot":       true,
+		"/password/reset":        true,
+		"/verify-email":          true,
+	}
+)
+
+var (
+	errMalformedAuthorization = errors.New("malformed authorization header")
+	errNoAccessToken          = errors.New("no access token provided")
+)
+
+// Error codes of requests without a usable access token, so clients know whether to refresh or to login again
+const (
+	tokenMissingCode = "token_missing"
+	tokenExpiredCode = "token_expired"
+)
+
+// accessTokenFromRequest reads the access token from the Authorization header or the token cookie.
+//
+// Precedence: if an Authorization header is present it is the only credential considered, even if it is invalid and
+// a cookie is present too. This way a native client that sends a stale bearer token is never silently authenticated
+// as whoever the cookie jar belongs to. The header must use the Bearer scheme (case-insensitive), any other value is
+// rejected instead of falling back to the cookie. Only without an Authorization header is the cookie used.
+func accessTokenFromRequest(ctx *gin.Context) (string, error) {
+	if header, ok := ctx.Request.Header["Authorization"]; ok {
+		if len(header) != 1 {
+			return "", errMalformedAuthorization
+		}
+		scheme, token, found := strings.Cut(strings.TrimSpace(header[0]), " ")
+		token = strings.TrimSpace(token)
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", errMalformedAuthorization
+		}
+		return token, nil
+	}
+
+	token, err := ctx.Cookie(accessTokenCookie)
+	if err != nil || token == "" {
+		return "", errNoAccessToken
+	}
+	return token, nil
+}
+
 type EmailExtractor struct {
 	Email string `json:"email"`
 }
 
-func CheckIfIpIsBanned() gin.HandlerFunc {
+func CheckIfIpIsBanned(stores *store.Stores) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ip := ctx.ClientIP()
 		sugar, _ := sugarFromContext(ctx)
 
-		isBanned, bannedUntil, err := utils.IsIpBanned(ctx, ip)
+		isBanned, bannedUntil, err := utils.IsIpBanned(stores.Bans, ip)
 		if err != nil {
 			sugar.Errorw("Error checking if IP is banned",
 				zap.String("ip", ip),
@@ -52,37 +113,116 @@ func CheckIfIpIsBanned() gin.HandlerFunc {
 	}
 }
 
-func AuthenticateRequest() gin.HandlerFunc {
+func AuthenticateRequest(stores *store.Stores) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		path := ctx.Request.URL.Path
-		tokenString, err := ctx.Cookie("token")
+		if publicPaths[path] {
+			ctx.Set("email", "ANONYMOUS")
+			return
+		}
+
+		tokenString, err := accessTokenFromRequest(ctx)
+		if errors.Is(err, errMalformedAuthorization) {
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Malformed Authorization header, expected 'Bearer <token>'")
+			return
+		}
 
 		if err != nil { // no token provdided
-			if path == "/login" || path == "/register" {
+			if loggedOutOnlyPaths[path] {
 				ctx.Set("email", "NEW_USER")
 				return
 			}
-			rejectRequest(ctx, http.StatusUnauthorized, "Missing credentials, please provide a valid token or login")
+			requireAuthentication(ctx, tokenMissingCode, "Missing credentials, please provide a valid token or login")
 			return
 		}
 
-		email, verifyErr := verifyToken(tokenString)
+		claims, verifyErr := verifyToken(tokenString)
+		if errors.Is(verifyErr, jwt.ErrTokenExpired) {
+			requireAuthentication(ctx, tokenExpiredCode, "Access token expired, please refresh it")
+			return
+		}
 		if verifyErr != nil {
-			rejectRequest(ctx, http.StatusUnauthorized, "Invalid token")
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
-		ctx.Set("email", email)
+		ctx.Set("email", claims.Email)
+		sessionId := claims.SessionID
 
-		if path == "/login" || path == "/register" {
-			rejectRequest(ctx, http.StatusForbidden, "Already logged in, please logout first")
+		// Access tokens are only valid as long as the session they were issued for
+		session, err := stores.Sessions.GetSession(sessionId)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				sugar, _ := sugarFromContext(ctx)
+				sugar.Errorw("Error retrieving session", zap.Error(err))
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				ctx.Abort()
+				return
+			}
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		if session.IsRevoked() || session.UserID != claims.UserID() {
+			rejectRequest(ctx, stores.Bans, http.StatusUnauthorized, "Session has been revoked, please login")
+			return
+		}
+		ctx.Set("session_id", sessionId)
+		ctx.Set("claims", claims)
+
+		if time.Since(session.LastSeenAt) > sessionTouchInterval {
+			if err := stores.Sessions.TouchSession(sessionId, ctx.ClientIP()); err != nil {
+				sugar, _ := sugarFromContext(ctx)
+				sugar.Warnw("Failed to update session last seen", zap.Error(err))
+			}
+		}
+
+		if loggedOutOnlyPaths[path] {
+			rejectRequest(ctx, stores.Bans, http.StatusForbidden, "Already logged in, please logout first")
 			return
 		}
 
 	}
 }
 
-func rejectRequest(ctx *gin.Context, statusCode int, reason string) {
+// RequireVerifiedEmail only lets users with a verified email through, unless verification is disabled through
+// DTS_REQUIRE_EMAIL_VERIFICATION. It has to run after AuthenticateRequest.
+func RequireVerifiedEmail(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !constants.RequireEmailVerification {
+			return
+		}
+
+		claims, err := claimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			ctx.Abort()
+			return
+		}
+
+		verifiedAt, err := stores.Users.EmailVerifiedAt(claims.UserID())
+		if err != nil {
+			sugar, _ := sugarFromContext(ctx)
+			sugar.Errorw("Error checking email verification", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			ctx.Abort()
+			return
+		}
+		if verifiedAt == nil {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			ctx.Abort()
+			return
+		}
+	}
+}
+
+// requireAuthentication answers a request that has no usable access token. Every client runs into this whenever its
+// access token lapses, so unlike rejectRequest it does not count towards banning the IP.
+func requireAuthentication(ctx *gin.Context, code string, reason string) {
+	ctx.JSON(http.StatusUnauthorized, gin.H{"error": reason, "code": code})
+	ctx.Abort()
+}
+
+func rejectRequest(ctx *gin.Context, bans store.BanStore, statusCode int, reason string) {
 	userEmail, err := utils.EmailFromContext(ctx)
 
 	user := "unknown"
@@ -92,7 +232,7 @@ func rejectRequest(ctx *gin.Context, statusCode int, reason string) {
 
 	sugar, _ := sugarFromContext(ctx)
 
-	loggingErr := utils.LogRejectedRequest(ctx, sugar, statusCode, reason, user)
+	loggingErr := utils.LogRejectedRequest(ctx, bans, sugar, statusCode, reason, user)
 	if loggingErr != nil {
 		sugar.Error("Error logging rejected request", loggingErr)
 	}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/utils"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testClientIp = "192.0.2.1"
+
+// useTestKeyring signs and verifies the tokens of the test with a fresh key
+func useTestKeyring(t *testing.T) {
+	t.Helper()
+	previous := keyring
+	keyring = NewKeyring("", t.TempDir(), "ES256", time.Hour)
+	if err := keyring.Load(); err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	t.Cleanup(func() {
+		keyring = previous
+	})
+}
+
+// authenticate sends a request with the Authorization header through AuthenticateRequest, the header is left out
+// if it is empty
+func authenticate(stores *store.Stores, authorization string) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		ctx.Set("sugar", zap.NewNop().Sugar())
+	}, AuthenticateRequest(stores))
+	engine.GET("/distance", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/distance", nil)
+	request.RemoteAddr = testClientIp + ":4711"
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestExpiredAndMissingTokensDoNotBanTheIp(t *testing.T) {
+	useTestKeyring(t)
+	stores := store.NewMemoryStores()
+	expired, err := signToken(models.Claims{Email: "alice@example.com", SessionID: "session"}, 1, -time.Hour)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	for _, test := range []struct {
+		authorization string
+		code          string
+	}{
+		{"Bearer " + expired, tokenExpiredCode},
+		{"", tokenMissingCode},
+	} {
+		for i := 0; i < 2*constants.RequestsUntilBan; i++ {
+			recorder := authenticate(stores, test.authorization)
+			var response struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusUnauthorized ||
+				response.Code != test.code {
+				t.Fatalf("expected status %d with code %s, got %d: %s", http.StatusUnauthorized, test.code,
+					recorder.Code, recorder.Body.String())
+			}
+		}
+	}
+
+	banned, _, err := utils.IsIpBanned(stores.Bans, testClientIp)
+	if err != nil || banned {
+		t.Fatalf("expected the IP not to be banned, got %t (%v)", banned, err)
+	}
+	if count, err := stores.Bans.CountRecentRejections(testClientIp, 24*time.Hour); err != nil || count != 0 {
+		t.Errorf("expected no rejected requests to be logged, got %d (%v)", count, err)
+	}
+
+	// Malformed headers and bad signatures still count
+	for _, authorization := range []string{"Token " + expired, "Bearer " + expired[:len(expired)-4] + "AAAA"} {
+		if recorder := authenticate(stores, authorization); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, recorder.Code)
+		}
+	}
+	if count, err := stores.Bans.CountRecentRejections(testClientIp, 24*time.Hour); err != nil || count != 2 {
+		t.Errorf("expected the malformed header and the bad signature to be logged, got %d (%v)", count, err)
+	}
+}
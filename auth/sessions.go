@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+const (
+	// sessionTouchInterval limits how often last_seen_at is written for a session
+	sessionTouchInterval = time.Minute
+)
+
+var (
+	errSessionNotFound = errors.New("session not found")
+)
+
+// currentSession loads the session the request was authenticated with
+func currentSession(ctx *gin.Context, sessions store.SessionStore) (models.Session, error) {
+	sessionId, err := sessionIdFromContext(ctx)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return sessions.GetSession(sessionId)
+}
+
+func ListSessions(ctx *gin.Context, stores *store.Stores) ([]models.Session, error) {
+	current, err := currentSession(ctx, stores.Sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve current session: %w", err)
+	}
+
+	sessions, err := stores.Sessions.ListActiveSessions(current.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+	return sessions, nil
+}
+
+// RevokeUserSession signs out one of the current user's sessions, e.g. a lost phone. It returns whether the revoked
+// session is the one making the request.
+func RevokeUserSession(ctx *gin.Context, stores *store.Stores, sessionId string) (bool, error) {
+	current, err := currentSession(ctx, stores.Sessions)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve current session: %w", err)
+	}
+
+	session, err := stores.Sessions.GetSession(sessionId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, errSessionNotFound
+		}
+		return false, err
+	}
+	// Do not reveal whether sessions of other users exist
+	if session.UserID != current.UserID || session.IsRevoked() {
+		return false, errSessionNotFound
+	}
+
+	err = stores.Sessions.RevokeSession(sessionId)
+	if err != nil {
+		return false, err
+	}
+	return sessionId == current.ID, nil
+}
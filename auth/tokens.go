@@ -2,58 +2,157 @@ package auth
 
 import (
 	"DistanceTrackerServer/constants"
-	"crypto/rsa"
+	"DistanceTrackerServer/models"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/ssh"
-	"os"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"strconv"
 	"time"
 )
 
+const (
+	// tokenLeeway allows for small clock differences between replicas when checking exp, nbf and iat
+	tokenLeeway = 30 * time.Second
+)
+
 var (
-	secretKey *rsa.PrivateKey
+	keyring *Keyring
 )
 
-func init() {
-	bytes, err := os.ReadFile(constants.JwtSecretkey)
-	if err != nil {
-		panic(err)
+// InitKeyring loads the JWT signing keys and, if configured, starts rotating them
+func InitKeyring(sugar *zap.SugaredLogger) error {
+	keyring = NewKeyring(constants.JwtSecretkey, constants.JwtKeysDir, constants.JwtKeyAlgorithm, constants.AccessTokenLifetime)
+	if err := keyring.Load(); err != nil {
+		return err
+	}
+
+	if constants.JwtKeyRotationInterval > 0 {
+		rotated, err := keyring.Rotate(constants.JwtKeyRotationInterval)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			sugar.Info("Rotated JWT signing key on startup")
+		}
+		keyring.StartRotation(constants.JwtKeyRotationInterval, sugar)
 	}
-	key, err := ssh.ParseRawPrivateKey(bytes)
+
+	current, err := keyring.SigningKey()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	secretKey = key.(*rsa.PrivateKey)
+	sugar.Infow("JWT keyring loaded", "kid", current.ID, "alg", current.Method.Alg())
+	return nil
+}
+
+func CreateToken(userId int, email string, sessionId string) (string, error) {
+	return signToken(models.Claims{Email: email, SessionID: sessionId}, userId, constants.AccessTokenLifetime)
 }
 
-func CreateToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256,
-		jwt.MapClaims{
-			"email": email,
-			"exp":   time.Now().Add(time.Hour * 24).Unix(),
-		})
+// CreateMFAToken creates the short-lived token handed out after a correct password when a second factor is required
+func CreateMFAToken(userId int, email string) (string, error) {
+	return signToken(models.Claims{Email: email, Use: models.TokenUseMFA}, userId, constants.MFATokenLifetime)
+}
+
+func signToken(claims models.Claims, userId int, lifetime time.Duration) (string, error) {
+	key, err := keyring.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    constants.JwtIssuer,
+		Subject:   strconv.Itoa(userId),
+		Audience:  jwt.ClaimStrings{constants.JwtAudience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.New().String(),
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(key.signingKey())
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
 	return tokenString, nil
 }
 
-func VerifyToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey.Public(), nil
-	})
+// VerifyToken validates an access token and returns its claims
+func VerifyToken(tokenString string) (*models.Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Use != "" {
+		return nil, fmt.Errorf("token is not an access token")
+	}
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("failed to extract session ID from token")
+	}
+	return claims, nil
+}
 
+// VerifyMFAToken validates a token created by CreateMFAToken and returns its claims
+func VerifyMFAToken(tokenString string) (*models.Claims, error) {
+	claims, err := parseToken(tokenString)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse token: %w", err)
+		return nil, err
+	}
+	if claims.Use != models.TokenUseMFA {
+		return nil, fmt.Errorf("token is not an MFA token")
+	}
+	return claims, nil
+}
+
+// parseToken validates the signature and every registered claim of the token and returns its claims
+func parseToken(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("token has no key ID")
+		}
+		key, err := keyring.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// Only accept the algorithm the key was created for
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+		return key.Public(), nil
+	},
+		jwt.WithValidMethods(keyring.Algorithms()),
+		jwt.WithIssuer(constants.JwtIssuer),
+		jwt.WithAudience(constants.JwtAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if claims.NotBefore == nil || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("token is missing the nbf or iat claim")
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("token is missing the jti claim")
+	}
+	if userId, err := strconv.Atoi(claims.Subject); err != nil || userId <= 0 {
+		return nil, fmt.Errorf("token subject is not a valid user ID")
 	}
-	email, ok := token.Claims.(jwt.MapClaims)["email"].(string)
-	if !ok {
-		return "", fmt.Errorf("failed to extract email from token")
+	if claims.Email == "" {
+		return nil, fmt.Errorf("failed to extract email from token")
 	}
-	return email, nil
+	return claims, nil
 }
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the test vectors in RFC 6238 appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil || string(key) != "12345678901234567890" {
+		t.Fatalf("failed to decode the RFC 6238 secret: %q (%v)", key, err)
+	}
+
+	// The RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	for _, vector := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		step := totpStep(time.Unix(vector.unix, 0))
+		if code := totpCode(key, step); code != vector.code[2:] {
+			t.Errorf("expected %s at %d, got %s", vector.code[2:], vector.unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// 287082 is the code of step 1, from 30 to 59 seconds after the epoch
+	for _, test := range []struct {
+		name   string
+		secret string
+		code   string
+		unix   int64
+		step   int64
+		valid  bool
+	}{
+		{"current period", rfc6238Secret, "287082", 59, 1, true},
+		{"start of the period", rfc6238Secret, "287082", 30, 1, true},
+		{"one period late", rfc6238Secret, "287082", 89, 1, true},
+		{"one period early", rfc6238Secret, "287082", 29, 1, true},
+		{"two periods late", rfc6238Secret, "287082", 90, 0, false},
+		{"spaces", rfc6238Secret, " 287 082 ", 59, 1, true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "287082", 59, 1, true},
+		{"wrong code", rfc6238Secret, "287083", 59, 0, false},
+		{"eight digits", rfc6238Secret, "94287082", 59, 0, false},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	} {
+		step, valid := validateTOTP(test.secret, test.code, time.Unix(test.unix, 0))
+		if valid != test.valid || step != test.step {
+			t.Errorf("%s: expected step %d valid %t, got step %d valid %t", test.name, test.step, test.valid, step,
+				valid)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI(rfc6238Secret, "Distance Tracker", "alice@example.com"))
+	if err != nil {
+		t.Fatalf("failed to parse URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Distance Tracker:alice@example.com" {
+		t.Errorf("expected a TOTP URI labelled with issuer and account, got %s", uri)
+	}
+	query := uri.Query()
+	for key, expected := range map[string]string{
+		"secret":    rfc6238Secret,
+		"issuer":    "Distance Tracker",
+		"algorithm": "SHA1",
+		"digits":    strconv.Itoa(totpDigits),
+		"period":    strconv.Itoa(totpPeriod),
+	} {
+		if query.Get(key) != expected {
+			t.Errorf("expected %s=%s, got %q", key, expected, query.Get(key))
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+var (
+	errTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotStarted     = errors.New("two-factor setup has not been started")
+	errInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	errInvalidMFAToken         = errors.New("invalid or expired MFA token, please login again")
+	errTwoFactorLocked         = errors.New("too many invalid two-factor codes, please try again later")
+	errIncorrectPassword       = errors.New("password is incorrect")
+)
+
+var (
+	recoveryCodeEncoding = strings.ToLower("ABCDEFGHIJKLMNOPQRSTUVWXYZ234567")
+)
+
+// twoFactorEnabled reports whether the user has a confirmed TOTP enrollment
+func twoFactorEnabled(twoFactor store.TwoFactorStore, userId int) (bool, error) {
+	totp, err := twoFactor.GetTOTP(userId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return totp.IsConfirmed(), nil
+}
+
+// SetupTwoFactor starts a TOTP enrollment for the authenticated user and returns the secret together with the
+// otpauth:// URI for authenticator apps. The enrollment only becomes active once it is confirmed with a code.
+func SetupTwoFactor(ctx *gin.Context, stores *store.Stores, password string) (string, string, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Enrolling a second factor with a stolen access token would lock the owner out, so ask for the password again
+	if err := confirmPassword(stores.Users, claims.UserID(), password); err != nil {
+		return "", "", err
+	}
+
+	enabled, err := twoFactorEnabled(stores.TwoFactor, claims.UserID())
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", errTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	err = stores.TwoFactor.SaveTOTPSecret(claims.UserID(), secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(secret, constants.TotpIssuer, claims.Email), nil
+}
+
+// ConfirmTwoFactor activates the pending enrollment if the code matches and returns the recovery codes. They are only
+// stored hashed, so this is the only time the user gets to see them.
+func ConfirmTwoFactor(ctx *gin.Context, stores *store.Stores, code string) ([]string, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := stores.TwoFactor.GetTOTP(claims.UserID())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errTwoFactorNotStarted
+		}
+		return nil, err
+	}
+	if totp.IsConfirmed() {
+		return nil, errTwoFactorAlreadyEnabled
+	}
+
+	step, ok := validateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	recoveryCodes := make([]string, constants.RecoveryCodeCount)
+	recoveryCodeHashes := make([]string, constants.RecoveryCodeCount)
+	for i := range recoveryCodes {
+		recoveryCodes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodeHashes[i] = hashOpaqueToken(normalizeRecoveryCode(recoveryCodes[i]))
+	}
+
+	err = stores.TwoFactor.ConfirmTOTP(claims.UserID(), step, recoveryCodeHashes)
+	if err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// generateRecoveryCode returns a code like "k3xq7-mz2pa", 50 random bits are plenty for a single-use code that is
+// protected by the attempt limit
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := make([]byte, len(b))
+	for i, value := range b {
+		code[i] = recoveryCodeEncoding[value%32]
+	}
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// CompleteTwoFactorLogin exchanges the MFA token from the password step and a second factor for a session
+func CompleteTwoFactorLogin(ctx *gin.Context, stores *store.Stores, login models.TwoFactorLogin) (int, models.TokenPair, error) {
+	sugar, err := sugarFromContext(ctx)
+	if err != nil {
+		return 0, models.TokenPair{}, err
+	}
+
+	claims, err := verifyMFAToken(login.MFAToken)
+	if err != nil {
+		return 0, models.TokenPair{}, errInvalidMFAToken
+	}
+	userId := claims.UserID()
+	// Lets rejectRequest log which account the failed attempt was for
+	ctx.Set("email", claims.Email)
+
+	totp, err := stores.TwoFactor.GetTOTP(userId)
+	if err != nil {
+		return 0, models.TokenPair{}, err
+	}
+	if !totp.IsConfirmed() {
+		return 0, models.TokenPair{}, errInvalidMFAToken
+	}
+	if totp.FailedAttempts >= constants.MFAMaxAttempts && totp.LastFailedAt != nil &&
+		time.Since(*totp.LastFailedAt) < constants.MFALockoutWindow {
+		return 0, models.TokenPair{}, errTwoFactorLocked
+	}
+
+	if login.RecoveryCode != "" {
+		err = stores.TwoFactor.UseRecoveryCode(userId, hashOpaqueToken(normalizeRecoveryCode(login.RecoveryCode)))
+		if err == nil {
+			sugar.Infow("Recovery code used for login", zap.Int("user_id", userId))
+		}
+	} else {
+		step, ok := validateTOTP(totp.Secret, login.Code, time.Now())
+		if !ok {
+			err = errInvalidTwoFactorCode
+		} else {
+			err = stores.TwoFactor.UseTOTPStep(userId, step)
+		}
+	}
+
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrAlreadyUsed) &&
+			!errors.Is(err, errInvalidTwoFactorCode) {
+			return 0, models.TokenPair{}, err
+		}
+		attempts, recordErr := stores.TwoFactor.RecordFailedTOTPAttempt(userId, constants.MFALockoutWindow)
+		if recordErr != nil {
+			return 0, models.TokenPair{}, recordErr
+		}
+		if attempts >= constants.MFAMaxAttempts {
+			sugar.Warnw("Two-factor login locked after too many invalid codes", zap.Int("user_id", userId))
+			return 0, models.TokenPair{}, errTwoFactorLocked
+		}
+		return 0, models.TokenPair{}, errInvalidTwoFactorCode
+	}
+
+	tokens, err := issueTokens(ctx, stores, userId, claims.Email, login.DeviceName)
+	if err != nil {
+		return 0, models.TokenPair{}, err
+	}
+	return userId, tokens, nil
+}
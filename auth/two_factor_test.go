@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"encoding/json"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+// twoFactorUser creates a user with the test password and confirmed two-factor authentication. It returns the user
+// ID, the TOTP key, the step of the code the enrollment was confirmed with and the recovery codes.
+func twoFactorUser(t *testing.T, stores *store.Stores) (int, []byte, int64, []string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	userId, err := stores.Users.CreateUser("alice@example.com", "Alice", hash)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	recorder := serve(t, TwoFactorSetupHandler(stores), http.MethodPost, "/2fa/setup", "/2fa/setup", userId,
+		models.TwoFactorSetup{Password: testPassword})
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &setup); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected a TOTP secret, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	key, err := totpEncoding.DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("failed to decode TOTP secret: %v", err)
+	}
+
+	step := totpStep(time.Now())
+	recorder = serve(t, TwoFactorConfirmHandler(stores), http.MethodPost, "/2fa/confirm", "/2fa/confirm", userId,
+		models.TwoFactorConfirm{Code: totpCode(key, step)})
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &confirm); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected recovery codes, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if len(confirm.RecoveryCodes) != constants.RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", constants.RecoveryCodeCount, len(confirm.RecoveryCodes))
+	}
+	return userId, key, step, confirm.RecoveryCodes
+}
+
+// loginWithPassword runs the password step of the login and returns the MFA token it hands out
+func loginWithPassword(t *testing.T, stores *store.Stores) string {
+	t.Helper()
+	recorder := serve(t, LoginHandler(stores), http.MethodPost, "/login", "/login", 0,
+		models.UserLogin{Email: "alice@example.com", Password: testPassword, ReturnTokens: true})
+	var response struct {
+		MFARequired bool              `json:"mfa_required"`
+		MFAToken    string            `json:"mfa_token"`
+		Tokens      *models.TokenPair `json:"tokens"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the password to be accepted, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if !response.MFARequired || response.MFAToken == "" || response.Tokens != nil {
+		t.Fatalf("expected only an MFA token after the password, got %s", recorder.Body.String())
+	}
+	return response.MFAToken
+}
+
+func completeLogin(t *testing.T, stores *store.Stores, login models.TwoFactorLogin) *httptest.ResponseRecorder {
+	t.Helper()
+	login.ReturnTokens = true
+	return serve(t, TwoFactorLoginHandler(stores), http.MethodPost, "/2fa/login", "/2fa/login", 0, login)
+}
+
+// wrongCode returns a code that is not valid for the key right now
+func wrongCode(key []byte) string {
+	for value := 0; ; value++ {
+		code := strconv.Itoa(1000000 + value)[1:]
+		if _, ok := validateTOTP(totpEncoding.EncodeToString(key), code, time.Now()); !ok {
+			return code
+		}
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	useTestKeyring(t)
+	stores := store.NewMemoryStores()
+	userId, key, step, _ := twoFactorUser(t, stores)
+	mfaToken := loginWithPassword(t, stores)
+
+	// The MFA token is no access token
+	if recorder := authenticate(stores, "Bearer "+mfaToken); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the MFA token to be refused as access token, got %d", recorder.Code)
+	}
+
+	// The code the enrollment was confirmed with is used up
+	recorder := completeLogin(t, stores, models.TwoFactorLogin{MFAToken: mfaToken, Code: totpCode(key, step)})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the confirmation code to be refused, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	code := totpCode(key, step+1)
+	recorder = completeLogin(t, stores, models.TwoFactorLogin{MFAToken: mfaToken, Code: code})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		UserID int              `json:"user_id"`
+		Tokens models.TokenPair `json:"tokens"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.UserID != userId {
+		t.Fatalf("expected user %d to be logged in, got %s", userId, recorder.Body.String())
+	}
+	claims, err := VerifyToken(response.Tokens.AccessToken)
+	if err != nil || claims.UserID() != userId {
+		t.Fatalf("expected an access token of user %d, got %v (%v)", userId, claims, err)
+	}
+	if recorder := authenticate(stores, "Bearer "+response.Tokens.AccessToken); recorder.Code != http.StatusOK {
+		t.Errorf("expected the access token to be accepted, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Every code works once, an intercepted one cannot be replayed
+	recorder = completeLogin(t, stores, models.TwoFactorLogin{MFAToken: loginWithPassword(t, stores), Code: code})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected the replayed code to be refused, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if err := stores.TwoFactor.UseTOTPStep(userId, step+1); err == nil {
+		t.Errorf("expected the step of the used code to be taken")
+	}
+}
+
+func TestTwoFactorLoginWithRecoveryCode(t *testing.T) {
+	useTestKeyring(t)
+	stores := store.NewMemoryStores()
+	userId, _, _, recoveryCodes := twoFactorUser(t, stores)
+
+	// Recovery codes are accepted without the dash and in any case
+	shouted := " " + strings.ToUpper(recoveryCodes[1][:5]+recoveryCodes[1][6:])
+	for _, recoveryCode := range []string{recoveryCodes[0], shouted} {
+		recorder := completeLogin(t, stores, models.TwoFactorLogin{MFAToken: loginWithPassword(t, stores),
+			RecoveryCode: recoveryCode})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected recovery code %q to be accepted, got %d: %s", recoveryCode, recorder.Code,
+				recorder.Body.String())
+		}
+	}
+
+	recorder := completeLogin(t, stores, models.TwoFactorLogin{MFAToken: loginWithPassword(t, stores),
+		RecoveryCode: recoveryCodes[0]})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected the used recovery code to be refused, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if totp, err := stores.TwoFactor.GetTOTP(userId); err != nil || totp.FailedAttempts != 1 {
+		t.Errorf("expected the used recovery code to count as failed attempt, got %+v (%v)", totp, err)
+	}
+}
+
+func TestTwoFactorLoginLocksAfterTooManyInvalidCodes(t *testing.T) {
+	useTestKeyring(t)
+	stores := store.NewMemoryStores()
+	_, key, step, recoveryCodes := twoFactorUser(t, stores)
+	mfaToken := loginWithPassword(t, stores)
+
+	wrong := wrongCode(key)
+	for attempt := 1; attempt <= constants.MFAMaxAttempts; attempt++ {
+		expected := http.StatusUnauthorized
+		if attempt == constants.MFAMaxAttempts {
+			expected = http.StatusTooManyRequests
+		}
+		recorder := completeLogin(t, stores, models.TwoFactorLogin{MFAToken: mfaToken, Code: wrong})
+		if recorder.Code != expected {
+			t.Fatalf("expected status %d for attempt %d, got %d: %s", expected, attempt, recorder.Code,
+				recorder.Body.String())
+		}
+	}
+
+	// Correct codes do not get through the lockout either, and are not used up by it
+	for _, login := range []models.TwoFactorLogin{
+		{MFAToken: mfaToken, Code: totpCode(key, step+1)},
+		{MFAToken: mfaToken, RecoveryCode: recoveryCodes[0]},
+	} {
+		if recorder := completeLogin(t, stores, login); recorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected the locked login to be refused, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+	}
+	claims, err := verifyMFAToken(mfaToken)
+	if err != nil {
+		t.Fatalf("failed to verify MFA token: %v", err)
+	}
+	codeHash := hashOpaqueToken(normalizeRecoveryCode(recoveryCodes[0]))
+	if err := stores.TwoFactor.UseRecoveryCode(claims.UserID(), codeHash); err != nil {
+		t.Errorf("expected the recovery code to stay unused during the lockout, got %v", err)
+	}
+}
+
+func TestTwoFactorLoginRefusesInvalidMFAToken(t *testing.T) {
+	useTestKeyring(t)
+	stores := store.NewMemoryStores()
+	userId, key, step, _ := twoFactorUser(t, stores)
+	session, err := signToken(models.Claims{Email: "alice@example.com", SessionID: "session"}, userId, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	expired, err := signToken(models.Claims{Email: "alice@example.com", Use: models.TokenUseMFA}, userId, -time.Hour)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	// An access token or an expired MFA token cannot skip the password
+	for _, mfaToken := range []string{session, expired, ""} {
+		recorder := completeLogin(t, stores, models.TwoFactorLogin{MFAToken: mfaToken, Code: totpCode(key, step+1)})
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d: %s", http.StatusUnauthorized, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package circles
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/utils"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxCircleNameLength = 50
+	// inviteCodeAttempts is how often a new code is generated when it collides with an existing one
+	inviteCodeAttempts = 5
+)
+
+var (
+	userIdFromContext = utils.UserIdFromContext
+	sugarFromContext  = utils.SugarFromContext
+
+	errInvalidName       = fmt.Errorf("name must be between 1 and %d characters", maxCircleNameLength)
+	errCircleNotFound    = errors.New("circle not found")
+	errNotOwner          = errors.New("only owners of the circle can do this")
+	errInvalidInviteCode = errors.New("invalid invite code")
+	errInviteNotFound    = errors.New("unknown invite code")
+	errInviteExpired     = errors.New("invite code expired")
+	errAlreadyMember     = errors.New("you are already a member of this circle")
+	errCircleFull        = fmt.Errorf("circles are limited to %d members", constants.CircleMemberLimit)
+	errInviteConflict    = errors.New("failed to create a unique invite code, please try again")
+)
+
+func recordCircleEvent(ctx *gin.Context, stores *store.Stores, userId int, event string, details string) {
+	err := stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    userId,
+		Event:     event,
+		Details:   details,
+		IPAddress: ctx.ClientIP(),
+	})
+	if err != nil {
+		sugar, _ := sugarFromContext(ctx)
+		sugar.Warnw("Failed to record circle event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+// CreateCircle creates a circle with the authenticated user as its owner
+func CreateCircle(ctx *gin.Context, stores *store.Stores, newCircle models.NewCircle) (models.Circle, error) {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return models.Circle{}, err
+	}
+
+	name := strings.TrimSpace(newCircle.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCircleNameLength {
+		return models.Circle{}, errInvalidName
+	}
+
+	circle, err := stores.Circles.CreateCircle(name, userId)
+	if err != nil {
+		return models.Circle{}, err
+	}
+	recordCircleEvent(ctx, stores, userId, models.AuditCircleCreated, fmt.Sprintf("circle %d", circle.ID))
+	return circle, nil
+}
+
+// GetCircle returns the circle with its members, if the authenticated user is one of them
+func GetCircle(ctx *gin.Context, stores *store.Stores, circleId int) (models.Circle, error) {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return models.Circle{}, err
+	}
+
+	circle, err := stores.Circles.GetCircle(circleId, userId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return models.Circle{}, errCircleNotFound
+		}
+		return models.Circle{}, err
+	}
+	return circle, nil
+}
+
+// ownedCircle returns the circle if the authenticated user owns it
+func ownedCircle(ctx *gin.Context, stores *store.Stores, circleId int) (models.Circle, error) {
+	circle, err := GetCircle(ctx, stores, circleId)
+	if err != nil {
+		return models.Circle{}, err
+	}
+	if circle.Role != models.CircleRoleOwner {
+		return models.Circle{}, errNotOwner
+	}
+	return circle, nil
+}
+
+// CreateInvite creates a single use invite code for the circle, only owners can invite
+func CreateInvite(ctx *gin.Context, stores *store.Stores, circleId int) (models.CircleInvite, error) {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return models.CircleInvite{}, err
+	}
+	if _, err := ownedCircle(ctx, stores, circleId); err != nil {
+		return models.CircleInvite{}, err
+	}
+
+	for attempt := 0; attempt < inviteCodeAttempts; attempt++ {
+		shortCode, err := utils.GenerateShortCode()
+		if err != nil {
+			return models.CircleInvite{}, err
+		}
+
+		invite, err := stores.Circles.CreateCircleInvite(models.CircleInvite{
+			CircleID:  circleId,
+			CreatedBy: userId,
+			ShortCode: shortCode,
+			ExpiresAt: time.Now().Add(constants.CircleInviteLifetime),
+		})
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return models.CircleInvite{}, err
+		}
+		invite.ShortCode = utils.FormatShortCode(invite.ShortCode)
+		return invite, nil
+	}
+	return models.CircleInvite{}, errInviteConflict
+}
+
+// JoinCircle redeems an invite code and adds the authenticated user to its circle
+func JoinCircle(ctx *gin.Context, stores *store.Stores, join models.CircleJoin) (models.Circle, error) {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return models.Circle{}, err
+	}
+
+	code, err := utils.NormalizeShortCode(join.Code)
+	if err != nil {
+		return models.Circle{}, errInvalidInviteCode
+	}
+
+	circle, err := stores.Circles.RedeemCircleInvite(code, userId, constants.CircleMemberLimit)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return models.Circle{}, errInviteNotFound
+		case errors.Is(err, store.ErrExpired):
+			return models.Circle{}, errInviteExpired
+		case errors.Is(err, store.ErrIsMember):
+			return models.Circle{}, errAlreadyMember
+		case errors.Is(err, store.ErrCircleFull):
+			return models.Circle{}, errCircleFull
+		}
+		return models.Circle{}, err
+	}
+	recordCircleEvent(ctx, stores, userId, models.AuditCircleJoined, fmt.Sprintf("circle %d", circle.ID))
+	return circle, nil
+}
+
+// RemoveMember removes a member from the circle. Everyone can remove themselves, which is how a circle is left,
+// removing anyone else is up to the owners.
+func RemoveMember(ctx *gin.Context, stores *store.Stores, circleId int, memberId int) error {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if memberId == userId {
+		if _, err := GetCircle(ctx, stores, circleId); err != nil {
+			return err
+		}
+	} else if _, err := ownedCircle(ctx, stores, circleId); err != nil {
+		return err
+	}
+
+	err = stores.Circles.RemoveCircleMember(circleId, memberId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return errCircleNotFound
+		}
+		return err
+	}
+
+	if memberId == userId {
+		recordCircleEvent(ctx, stores, userId, models.AuditCircleLeft, fmt.Sprintf("circle %d", circleId))
+		return nil
+	}
+	recordCircleEvent(ctx, stores, userId, models.AuditCircleMemberRemoved,
+		fmt.Sprintf("removed user %d from circle %d", memberId, circleId))
+	return nil
+}
+
+// DeleteCircle deletes the circle for all of its members, only owners can delete it
+func DeleteCircle(ctx *gin.Context, stores *store.Stores, circleId int) error {
+	userId, err := userIdFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := ownedCircle(ctx, stores, circleId); err != nil {
+		return err
+	}
+
+	if err := stores.Circles.DeleteCircle(circleId); err != nil {
+		return err
+	}
+	recordCircleEvent(ctx, stores, userId, models.AuditCircleDeleted, fmt.Sprintf("circle %d", circleId))
+	return nil
+}
@@ -0,0 +1,216 @@
+package circles
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+func CreateCircleHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		newCircle := models.NewCircle{}
+		err = ctx.BindJSON(&newCircle)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		circle, err := CreateCircle(ctx, stores, newCircle)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		sugar.Infow("Circle created", zap.Int("circle_id", circle.ID))
+		ctx.JSON(http.StatusCreated, circle)
+	}
+}
+
+func ListCirclesHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+
+		circles, err := stores.Circles.CirclesForUser(userId)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"circles": circles})
+	}
+}
+
+func GetCircleHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circleId, ok := circleIdFromRequest(ctx)
+		if !ok {
+			return
+		}
+
+		circle, err := GetCircle(ctx, stores, circleId)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, circle)
+	}
+}
+
+func CreateInviteHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circleId, ok := circleIdFromRequest(ctx)
+		if !ok {
+			return
+		}
+
+		invite, err := CreateInvite(ctx, stores, circleId)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		sugar.Infow("Circle invite created", zap.Int("circle_id", circleId))
+		ctx.JSON(http.StatusCreated, invite)
+	}
+}
+
+func JoinCircleHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		join := models.CircleJoin{}
+		err = ctx.BindJSON(&join)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		circle, err := JoinCircle(ctx, stores, join)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		sugar.Infow("Joined circle", zap.Int("circle_id", circle.ID))
+		ctx.JSON(http.StatusOK, circle)
+	}
+}
+
+// RemoveMemberHandler removes the member in the path from the circle, members leave a circle by removing themselves
+func RemoveMemberHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circleId, ok := circleIdFromRequest(ctx)
+		if !ok {
+			return
+		}
+		memberId, err := strconv.Atoi(ctx.Param("userId"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+			return
+		}
+
+		err = RemoveMember(ctx, stores, circleId, memberId)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		sugar.Infow("Circle member removed", zap.Int("circle_id", circleId), zap.Int("member_id", memberId))
+		ctx.JSON(http.StatusOK, gin.H{"message": "MEMBER REMOVED"})
+	}
+}
+
+func DeleteCircleHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := sugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circleId, ok := circleIdFromRequest(ctx)
+		if !ok {
+			return
+		}
+
+		err = DeleteCircle(ctx, stores, circleId)
+		if err != nil {
+			respondWithError(ctx, stores, sugar, err)
+			return
+		}
+		sugar.Infow("Circle deleted", zap.Int("circle_id", circleId))
+		ctx.JSON(http.StatusOK, gin.H{"message": "CIRCLE DELETED"})
+	}
+}
+
+func circleIdFromRequest(ctx *gin.Context) (int, bool) {
+	circleId, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid circle ID"})
+		return 0, false
+	}
+	return circleId, true
+}
+
+func respondWithError(ctx *gin.Context, stores *store.Stores, sugar *zap.SugaredLogger, err error) {
+	switch {
+	case errors.Is(err, errInvalidName), errors.Is(err, errInvalidInviteCode):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotOwner):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errCircleNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errInviteNotFound):
+		// Unknown codes count towards the IP ban like unknown link codes, so invites cannot be guessed
+		user, _ := utils.EmailFromContext(ctx)
+		if logErr := utils.LogRejectedRequest(ctx, stores.Bans, sugar, http.StatusNotFound, err.Error(), user); logErr != nil {
+			sugar.Errorw("Error logging rejected request", zap.Error(logErr))
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errInviteExpired):
+		ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, errAlreadyMember), errors.Is(err, errCircleFull), errors.Is(err, errInviteConflict):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		sugar.Errorw("circle error", zap.String("Error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+	}
+}
@@ -0,0 +1,184 @@
+package circles
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs the handler for a request of the user, as if the authentication middleware had let it through
+func serve(t *testing.T, handler gin.HandlerFunc, method string, route string, target string, userId int, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	engine := gin.New()
+	engine.Handle(method, route, func(ctx *gin.Context) {
+		ctx.Set("sugar", zap.NewNop().Sugar())
+		ctx.Set("claims", &models.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(userId)}})
+	}, handler)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, &payload)
+	request.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, target any) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), target); err != nil {
+		t.Fatalf("failed to decode response %q: %v", recorder.Body.String(), err)
+	}
+}
+
+func createUser(t *testing.T, stores *store.Stores, name string) int {
+	t.Helper()
+	userId, err := stores.Users.CreateUser(strings.ToLower(name)+"@example.com", name, []byte("hash"))
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", name, err)
+	}
+	return userId
+}
+
+func expectStatus(t *testing.T, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, recorder.Code, recorder.Body.String())
+	}
+}
+
+func circlePath(circleId int, path string) string {
+	return "/circles/" + strconv.Itoa(circleId) + path
+}
+
+// circleOf creates a circle owned by the first user, the others join it through invites in the order they are given
+func circleOf(t *testing.T, stores *store.Stores, owner int, members ...int) int {
+	t.Helper()
+	recorder := serve(t, CreateCircleHandler(stores), http.MethodPost, "/circles", "/circles", owner,
+		models.NewCircle{Name: "Family"})
+	expectStatus(t, recorder, http.StatusCreated)
+	var circle models.Circle
+	decode(t, recorder, &circle)
+
+	for _, member := range members {
+		recorder = inviteTo(t, stores, circle.ID, owner)
+		expectStatus(t, recorder, http.StatusCreated)
+		var invite models.CircleInvite
+		decode(t, recorder, &invite)
+
+		recorder = serve(t, JoinCircleHandler(stores), http.MethodPost, "/circles/join", "/circles/join", member,
+			models.CircleJoin{Code: invite.ShortCode})
+		expectStatus(t, recorder, http.StatusOK)
+	}
+	return circle.ID
+}
+
+func inviteTo(t *testing.T, stores *store.Stores, circleId int, userId int) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, CreateInviteHandler(stores), http.MethodPost, "/circles/:id/invites",
+		circlePath(circleId, "/invites"), userId, nil)
+}
+
+func deleteCircle(t *testing.T, stores *store.Stores, circleId int, userId int) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, DeleteCircleHandler(stores), http.MethodDelete, "/circles/:id", circlePath(circleId, ""), userId,
+		nil)
+}
+
+func getCircle(t *testing.T, stores *store.Stores, circleId int, userId int) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, GetCircleHandler(stores), http.MethodGet, "/circles/:id", circlePath(circleId, ""), userId, nil)
+}
+
+func removeMember(t *testing.T, stores *store.Stores, circleId int, userId int,
+	memberId int) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, RemoveMemberHandler(stores), http.MethodDelete, "/circles/:id/members/:userId",
+		circlePath(circleId, "/members/"+strconv.Itoa(memberId)), userId, nil)
+}
+
+// roles returns the role of every member of the circle as the user sees it
+func roles(t *testing.T, stores *store.Stores, circleId int, userId int) map[int]string {
+	t.Helper()
+	recorder := getCircle(t, stores, circleId, userId)
+	expectStatus(t, recorder, http.StatusOK)
+	var circle models.Circle
+	decode(t, recorder, &circle)
+	roles := make(map[int]string, len(circle.Members))
+	for _, member := range circle.Members {
+		roles[member.UserID] = member.Role
+	}
+	return roles
+}
+
+func TestMembersCannotManageTheCircle(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, bob, carol := createUser(t, stores, "Alice"), createUser(t, stores, "Bob"), createUser(t, stores, "Carol")
+	circleId := circleOf(t, stores, alice, bob, carol)
+
+	expectStatus(t, inviteTo(t, stores, circleId, bob), http.StatusForbidden)
+	expectStatus(t, deleteCircle(t, stores, circleId, bob), http.StatusForbidden)
+	expectStatus(t, removeMember(t, stores, circleId, bob, carol), http.StatusForbidden)
+	expectStatus(t, removeMember(t, stores, circleId, bob, alice), http.StatusForbidden)
+	if members := roles(t, stores, circleId, bob); len(members) != 3 || members[alice] != models.CircleRoleOwner {
+		t.Fatalf("expected the circle to stay as it was, got %v", members)
+	}
+
+	// Outsiders do not even learn that the circle exists
+	dave := createUser(t, stores, "Dave")
+	expectStatus(t, inviteTo(t, stores, circleId, dave), http.StatusNotFound)
+	expectStatus(t, deleteCircle(t, stores, circleId, dave), http.StatusNotFound)
+	expectStatus(t, removeMember(t, stores, circleId, dave, bob), http.StatusNotFound)
+
+	// The owner can do all of it
+	expectStatus(t, removeMember(t, stores, circleId, alice, carol), http.StatusOK)
+	if members := roles(t, stores, circleId, alice); len(members) != 2 || members[carol] != "" {
+		t.Errorf("expected carol to be removed, got %v", members)
+	}
+	expectStatus(t, inviteTo(t, stores, circleId, alice), http.StatusCreated)
+	expectStatus(t, deleteCircle(t, stores, circleId, alice), http.StatusOK)
+	expectStatus(t, getCircle(t, stores, circleId, bob), http.StatusNotFound)
+}
+
+func TestOwnershipPassesOnWhenTheOwnerLeaves(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, bob, carol := createUser(t, stores, "Alice"), createUser(t, stores, "Bob"), createUser(t, stores, "Carol")
+	circleId := circleOf(t, stores, alice, bob, carol)
+
+	// Bob joined first, so he takes over
+	expectStatus(t, removeMember(t, stores, circleId, alice, alice), http.StatusOK)
+	members := roles(t, stores, circleId, carol)
+	if len(members) != 2 || members[bob] != models.CircleRoleOwner || members[carol] != models.CircleRoleMember {
+		t.Fatalf("expected bob to own the circle and carol to stay a member, got %v", members)
+	}
+	expectStatus(t, getCircle(t, stores, circleId, alice), http.StatusNotFound)
+
+	expectStatus(t, inviteTo(t, stores, circleId, bob), http.StatusCreated)
+	expectStatus(t, inviteTo(t, stores, circleId, carol), http.StatusForbidden)
+
+	// Members leave on their own, the circle goes with the last one
+	expectStatus(t, removeMember(t, stores, circleId, carol, carol), http.StatusOK)
+	expectStatus(t, removeMember(t, stores, circleId, bob, bob), http.StatusOK)
+	circles, err := stores.Circles.CirclesForUser(bob)
+	if err != nil || len(circles) != 0 {
+		t.Errorf("expected the empty circle to be deleted, got %v (%v)", circles, err)
+	}
+}
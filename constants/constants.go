@@ -1,13 +1,137 @@
 package constants
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var (
-	ServerPort   = os.Getenv("DTS_PORT")
-	DatabaseFile = os.Getenv("DTS_DB_FILE")
-	JwtSecretkey = os.Getenv("DTS_JWT_SECRET_KEY")
+	ServerPort     = os.Getenv("DTS_PORT")
+	DatabaseDriver = getEnv("DTS_DB_DRIVER", "sqlite3")
+	DatabaseFile   = os.Getenv("DTS_DB_FILE")
+	DatabaseURL    = os.Getenv("DTS_DB_URL")
+	JwtSecretkey   = os.Getenv("DTS_JWT_SECRET_KEY")
+	JwtKeysDir     = os.Getenv("DTS_JWT_KEYS_DIR")
+	JwtIssuer      = getEnv("DTS_JWT_ISSUER", "DistanceTrackerServer")
+	JwtAudience    = getEnv("DTS_JWT_AUDIENCE", "DistanceTrackerApp")
+	// JwtKeyAlgorithm is used for generated keys: RS256, ES256, ES384, ES512 or EdDSA
+	JwtKeyAlgorithm        = getEnv("DTS_JWT_KEY_ALGORITHM", "RS256")
+	JwtKeyRotationInterval = getDurationEnv("DTS_JWT_KEY_ROTATION_INTERVAL", 0)
+	AutoMigrate            = os.Getenv("DTS_AUTO_MIGRATE") != "false"
+	// MailerType is one of smtp, file or log
+	MailerType   = getEnv("DTS_MAILER", "log")
+	MailDir      = os.Getenv("DTS_MAIL_DIR")
+	MailFrom     = getEnv("DTS_MAIL_FROM", "no-reply@distancetracker.local")
+	SmtpHost     = os.Getenv("DTS_SMTP_HOST")
+	SmtpPort     = getEnv("DTS_SMTP_PORT", "587")
+	SmtpUsername = os.Getenv("DTS_SMTP_USERNAME")
+	SmtpPassword = os.Getenv("DTS_SMTP_PASSWORD")
+	// PasswordResetURL is the page or deep link the reset token is appended to, e.g. https://example.com/reset
+	PasswordResetURL = os.Getenv("DTS_PASSWORD_RESET_URL")
+	// EmailVerificationURL works like PasswordResetURL for email verification links
+	EmailVerificationURL = os.Getenv("DTS_EMAIL_VERIFICATION_URL")
+	// RequireEmailVerification blocks account linking and distance requests until the user verified their email
+	RequireEmailVerification = os.Getenv("DTS_REQUIRE_EMAIL_VERIFICATION") != "false"
+	// TotpIssuer is shown next to the account in authenticator apps
+	TotpIssuer = getEnv("DTS_TOTP_ISSUER", "DistanceTracker")
+	// ExportDir keeps personal data exports that were generated in the background until they expire
+	ExportDir = getEnv("DTS_EXPORT_DIR", filepath.Join(os.TempDir(), "dts-exports"))
+	// LinkCodeLifetime is how long a link code can be redeemed after it was created
+	LinkCodeLifetime = getDurationEnv("DTS_LINK_CODE_TTL", 15*time.Minute)
+	// LinkCodeURL is the deep link QR codes for link codes point to, the code is appended as query parameter
+	LinkCodeURL = getEnv("DTS_LINK_CODE_URL", "distancetracker://link")
+	// ValidationRules is a comma separated list of the location validation rules to run, every rule runs if it is empty
+	ValidationRules = getListEnv("DTS_VALIDATION_RULES")
+	// ValidationMaxAccuracy is the least accurate fix in meters that is accepted
+	ValidationMaxAccuracy = getFloatEnv("DTS_VALIDATION_MAX_ACCURACY", 1000)
+	// ValidationMaxSpeed is the fastest everyday movement in km/h that is accepted
+	ValidationMaxSpeed = getFloatEnv("DTS_VALIDATION_MAX_SPEED", 150)
+	// ValidationLongDistance is the distance in km from the last location beyond which the user may be on a train or
+	// flight, so they may move up to ValidationMaxLongDistanceSpeed
+	ValidationLongDistance = getFloatEnv("DTS_VALIDATION_LONG_DISTANCE", 300)
+	// ValidationMaxLongDistanceSpeed is the fastest travel in km/h that is accepted, about a commercial plane
+	ValidationMaxLongDistanceSpeed = getFloatEnv("DTS_VALIDATION_MAX_LONG_DISTANCE_SPEED", 900)
+	// ValidationTeleportSpeed is the speed in km/h from which a location is rejected whatever the distance, it is
+	// probably spoofed
+	ValidationTeleportSpeed = getFloatEnv("DTS_VALIDATION_TELEPORT_SPEED", 1000)
+	// ValidationMinPrevious is how many valid locations a user needs before their speed is checked
+	ValidationMinPrevious = getIntEnv("DTS_VALIDATION_MIN_PREVIOUS", 1)
+	// ValidationNullIslandTolerance is how many degrees around 0,0 a location counts as the position a failed fix
+	// reports
+	ValidationNullIslandTolerance = getFloatEnv("DTS_VALIDATION_NULL_ISLAND_TOLERANCE", 1e-6)
+	// ValidationMaxClockSkew is how far in the future timestamps of uploaded locations may be, device clocks are
+	// rarely exact
+	ValidationMaxClockSkew = getDurationEnv("DTS_VALIDATION_MAX_CLOCK_SKEW", 5*time.Minute)
+	// ValidationDuplicateWindow is how close in time the same position counts as a duplicate
+	ValidationDuplicateWindow = getDurationEnv("DTS_VALIDATION_DUPLICATE_WINDOW", 10*time.Second)
 )
 
 const (
-	RequestsUntilBan = 10
+	RequestsUntilBan      = 10
+	AccessTokenLifetime   = 15 * time.Minute
+	RefreshTokenLifetime  = 30 * 24 * time.Hour
+	PasswordResetLifetime = time.Hour
+	// PasswordResetsPerHour limits how many reset mails a single account receives
+	PasswordResetsPerHour     = 3
+	EmailVerificationLifetime = 48 * time.Hour
+	EmailVerificationsPerHour = 3
+	// MFATokenLifetime is how long the user has to enter their second factor after the password
+	MFATokenLifetime = 5 * time.Minute
+	// MFAMaxAttempts wrong second factors within MFALockoutWindow lock the second login step of the account
+	MFAMaxAttempts    = 5
+	MFALockoutWindow  = 15 * time.Minute
+	RecoveryCodeCount = 10
+	ExportLifetime    = 24 * time.Hour
+	// LinkRequestLifetime is how long the owner of a link code has to accept a request to link
+	LinkRequestLifetime = 24 * time.Hour
+	// CircleInviteLifetime is how long an invite code for a circle can be redeemed
+	CircleInviteLifetime = 48 * time.Hour
+	CircleMemberLimit    = 20
+	// SyncExportLocationLimit is the largest location history that is exported within the request, larger ones are
+	// generated in the background
+	SyncExportLocationLimit = 5000
 )
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
+
+func getFloatEnv(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
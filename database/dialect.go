@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the differences between the SQL databases we support. Queries are written with '?' placeholders and
+// plain ANSI SQL; anything database specific (time arithmetic, placeholder style, error codes) goes through here.
+// Upserts use "INSERT ... ON CONFLICT ... DO UPDATE ... RETURNING" which both SQLite (3.35+) and PostgreSQL understand.
+type Dialect interface {
+	// Name is used to pick the migration directory
+	Name() string
+	DriverName() string
+	// Rebind converts '?' placeholders into the placeholder style of the database
+	Rebind(query string) string
+	// Now returns an expression evaluating to the current timestamp
+	Now() string
+	// SecondsFromNow returns an expression evaluating to the current timestamp shifted by the number of seconds the
+	// given expression evaluates to. The expression may be a placeholder or reference columns.
+	SecondsFromNow(seconds string) string
+	// Timestamp returns an expression that compares and sorts the timestamp the given expression evaluates to by its
+	// value, whatever format it was stored in
+	Timestamp(expression string) string
+	IsUniqueViolation(err error) bool
+	// ForUpdate returns the clause to append to a SELECT so the rows it reads stay locked until the transaction ends
+	ForUpdate() string
+	// LockMigrations blocks until no one else is migrating the database. The lock belongs to the connection and is held
+	// until UnlockMigrations is called on the same connection.
+	LockMigrations(ctx context.Context, conn *sql.Conn) error
+	UnlockMigrations(ctx context.Context, conn *sql.Conn) error
+}
+
+const (
+	SQLiteDriver   = "sqlite3"
+	PostgresDriver = "postgres"
+)
+
+// migrationLockKey identifies the advisory lock replicas take while migrating a PostgreSQL database. Any constant
+// works as long as nothing else uses it.
+const migrationLockKey int64 = 0x4454535f4d494752
+
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "", SQLiteDriver, "sqlite":
+		return SQLite{}, nil
+	case PostgresDriver, "postgresql", "pgx":
+		return Postgres{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver: %s", driver)
+}
+
+type SQLite struct{}
+
+func (SQLite) Name() string {
+	return "sqlite"
+}
+
+func (SQLite) DriverName() string {
+	return SQLiteDriver
+}
+
+func (SQLite) Rebind(query string) string {
+	return query
+}
+
+func (SQLite) Now() string {
+	return "datetime('now')"
+}
+
+func (SQLite) SecondsFromNow(seconds string) string {
+	return "datetime('now', (" + seconds + ") || ' seconds')"
+}
+
+// Timestamp converts to a Julian day number, SQLite keeps timestamps as text and rows written by CURRENT_TIMESTAMP,
+// the driver or older versions do not share one format that sorts as text
+func (SQLite) Timestamp(expression string) string {
+	return "julianday(" + expression + ")"
+}
+
+func (SQLite) IsUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// ForUpdate is empty, SQLite has no row locks but only ever lets one transaction write to the database at a time
+func (SQLite) ForUpdate() string {
+	return ""
+}
+
+// LockMigrations does nothing, SQLite databases are files which only a single server uses
+func (SQLite) LockMigrations(context.Context, *sql.Conn) error {
+	return nil
+}
+
+func (SQLite) UnlockMigrations(context.Context, *sql.Conn) error {
+	return nil
+}
+
+type Postgres struct{}
+
+func (Postgres) Name() string {
+	return "postgres"
+}
+
+func (Postgres) DriverName() string {
+	return PostgresDriver
+}
+
+// Rebind replaces every '?' outside of string literals and quoted identifiers with $1, $2, ...
+func (Postgres) Rebind(query string) string {
+	var builder strings.Builder
+	builder.Grow(len(query) + 16)
+
+	position := 0
+	var quote rune
+	for _, char := range query {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '?':
+			position++
+			builder.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+func (Postgres) Now() string {
+	return "NOW()"
+}
+
+func (Postgres) SecondsFromNow(seconds string) string {
+	return "(NOW() + make_interval(secs => (" + seconds + ")))"
+}
+
+func (Postgres) Timestamp(expression string) string {
+	return expression
+}
+
+func (Postgres) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (Postgres) ForUpdate() string {
+	return " FOR UPDATE"
+}
+
+// LockMigrations takes a session level advisory lock, which PostgreSQL releases by itself if the connection drops
+func (Postgres) LockMigrations(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	return err
+}
+
+func (Postgres) UnlockMigrations(ctx context.Context, conn *sql.Conn) error {
+	var unlocked bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey).Scan(&unlocked)
+	if err != nil {
+		return err
+	}
+	if !unlocked {
+		return errors.New("migration lock was not held")
+	}
+	return nil
+}
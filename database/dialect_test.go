@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	dbConn, err := sql.Open(SQLiteDriver, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = dbConn.Close()
+	})
+	return dbConn
+}
+
+func TestDialectFor(t *testing.T) {
+	for driver, name := range map[string]string{
+		"":           "sqlite",
+		"sqlite3":    "sqlite",
+		"sqlite":     "sqlite",
+		"postgres":   "postgres",
+		"postgresql": "postgres",
+		"pgx":        "postgres",
+	} {
+		dialect, err := DialectFor(driver)
+		if err != nil {
+			t.Errorf("driver %q: %v", driver, err)
+			continue
+		}
+		if dialect.Name() != name {
+			t.Errorf("driver %q: expected dialect %s, got %s", driver, name, dialect.Name())
+		}
+	}
+
+	if _, err := DialectFor("mysql"); err == nil {
+		t.Error("expected an error for an unsupported driver")
+	}
+}
+
+func TestPostgresRebind(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = $1"},
+		{"INSERT INTO t (a, b, c) VALUES (?, ?, ?)", "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)"},
+		{"UPDATE t SET a = ?,b=? WHERE c IN (?,?)", "UPDATE t SET a = $1,b=$2 WHERE c IN ($3,$4)"},
+		// Question marks in string literals and quoted identifiers are not placeholders
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{`SELECT "what?" FROM t WHERE a = ?`, `SELECT "what?" FROM t WHERE a = $1`},
+		{"SELECT 'it''s ?' || ? FROM t", "SELECT 'it''s ?' || $1 FROM t"},
+		{`SELECT '"?' FROM t WHERE a = ? AND b = '?"'`, `SELECT '"?' FROM t WHERE a = $1 AND b = '?"'`},
+		{"SELECT 'ä?' , ? FROM t", "SELECT 'ä?' , $1 FROM t"},
+	}
+	for _, test := range tests {
+		if actual := (Postgres{}).Rebind(test.query); actual != test.expected {
+			t.Errorf("Rebind(%q): expected %q, got %q", test.query, test.expected, actual)
+		}
+	}
+}
+
+func TestSQLiteRebindKeepsPlaceholders(t *testing.T) {
+	query := "SELECT '?' FROM t WHERE a = ? AND b = ?"
+	if actual := (SQLite{}).Rebind(query); actual != query {
+		t.Errorf("expected %q to be unchanged, got %q", query, actual)
+	}
+}
+
+func TestSecondsFromNow(t *testing.T) {
+	if expected, actual := "(NOW() + make_interval(secs => ($1)))", (Postgres{}).SecondsFromNow("$1"); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if expected, actual := "datetime('now', (?) || ' seconds')", (SQLite{}).SecondsFromNow("?"); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// The SQLite expression has to work with positive and negative offsets as well as column arithmetic
+	dbConn := openTestDatabase(t)
+	for expression, offset := range map[string]time.Duration{
+		"3600":     time.Hour,
+		"-86400":   -24 * time.Hour,
+		"0":        0,
+		"2 * 3600": 2 * time.Hour,
+	} {
+		// datetime() returns text in UTC
+		var text string
+		if err := dbConn.QueryRow("SELECT " + (SQLite{}).SecondsFromNow(expression)).Scan(&text); err != nil {
+			t.Fatalf("failed to evaluate SecondsFromNow(%s): %v", expression, err)
+		}
+		shifted, err := time.Parse(time.DateTime, text)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", text, err)
+		}
+		if difference := shifted.Sub(time.Now().Add(offset)); difference > 2*time.Second || difference < -2*time.Second {
+			t.Errorf("SecondsFromNow(%s): expected about %s from now, got %s", expression, offset, shifted)
+		}
+	}
+
+	// Placeholders are passed as integers
+	var text string
+	if err := dbConn.QueryRow("SELECT "+(SQLite{}).SecondsFromNow("?"), -60).Scan(&text); err != nil {
+		t.Fatalf("failed to evaluate SecondsFromNow with a placeholder: %v", err)
+	}
+	if shifted, err := time.Parse(time.DateTime, text); err != nil || time.Since(shifted) < 58*time.Second {
+		t.Errorf("expected a minute ago, got %q (%v)", text, err)
+	}
+}
+
+func TestSQLiteIsUniqueViolation(t *testing.T) {
+	dbConn := openTestDatabase(t)
+	if _, err := dbConn.Exec("CREATE TABLE t (a TEXT UNIQUE, b TEXT NOT NULL)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := dbConn.Exec("INSERT INTO t (a, b) VALUES ('x', 'y')"); err != nil {
+		t.Fatalf("failed to insert row: %v", err)
+	}
+
+	_, err := dbConn.Exec("INSERT INTO t (a, b) VALUES ('x', 'z')")
+	if !(SQLite{}).IsUniqueViolation(err) {
+		t.Errorf("expected a unique violation, got %v", err)
+	}
+	if !(SQLite{}).IsUniqueViolation(fmt.Errorf("failed to insert: %w", err)) {
+		t.Error("expected a wrapped unique violation to be detected")
+	}
+
+	_, err = dbConn.Exec("INSERT INTO t (a, b) VALUES ('w', NULL)")
+	if err == nil || (SQLite{}).IsUniqueViolation(err) {
+		t.Errorf("expected a NOT NULL violation not to count, got %v", err)
+	}
+	if (SQLite{}).IsUniqueViolation(nil) {
+		t.Error("expected nil not to be a unique violation")
+	}
+}
+
+func TestPostgresIsUniqueViolation(t *testing.T) {
+	unique := &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{unique, true},
+		{fmt.Errorf("failed to insert: %w", unique), true},
+		{&pq.Error{Code: "23502", Message: "null value violates not-null constraint"}, false},
+		{&pq.Error{Code: "23503", Message: "insert violates foreign key constraint"}, false},
+		// SQLite errors look different and must not be mistaken for Postgres ones
+		{errors.New("UNIQUE constraint failed: users.email"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if actual := (Postgres{}).IsUniqueViolation(test.err); actual != test.expected {
+			t.Errorf("IsUniqueViolation(%v): expected %t, got %t", test.err, test.expected, actual)
+		}
+	}
+}
+
+func TestForUpdate(t *testing.T) {
+	dbConn := openTestDatabase(t)
+	// SQLite would reject FOR UPDATE, the clause must be left out
+	var one int
+	if err := dbConn.QueryRow("SELECT 1" + (SQLite{}).ForUpdate()).Scan(&one); err != nil {
+		t.Errorf("expected the SQLite query to run: %v", err)
+	}
+	if actual := (Postgres{}).ForUpdate(); actual != " FOR UPDATE" {
+		t.Errorf("expected a FOR UPDATE clause for Postgres, got %q", actual)
+	}
+}
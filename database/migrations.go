@@ -0,0 +1,335 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	migrationFileName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+)
+
+// connection is what running migrations needs from the database. Both the connection pool and the single
+// connection holding the migration lock provide it.
+type connection interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+func (m Migration) ID() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadMigrations reads the embedded migration files for the dialect and returns them ordered by version.
+// Every version must have both an up and a down script.
+func LoadMigrations(dialect Dialect) ([]Migration, error) {
+	directory := path.Join("migrations", dialect.Name())
+	entries, err := fs.ReadDir(migrationFiles, directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		name := match[2]
+		content, err := migrationFiles.ReadFile(path.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %04d has conflicting names %s and %s", version, migration.Name, name)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s is missing its up or down script", migration.ID())
+		}
+		migration.Checksum = checksum(migration.Up)
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func ensureMigrationsTable(dbConn connection) error {
+	createMigrationsTable := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+	)
+	`
+	_, err := dbConn.ExecContext(context.Background(), createMigrationsTable)
+	if err != nil {
+		return fmt.Errorf("failed to create schema migrations table: %w", err)
+	}
+	return nil
+}
+
+func appliedMigrations(dbConn connection) (map[int]appliedMigration, error) {
+	rows, err := dbConn.QueryContext(context.Background(), "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var migration appliedMigration
+		err = rows.Scan(&migration.Version, &migration.Name, &migration.Checksum, &migration.AppliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[migration.Version] = migration
+	}
+	return applied, rows.Err()
+}
+
+// verifyMigrations makes sure every migration recorded in the database still exists and has not been edited since
+// it was applied.
+func verifyMigrations(migrations []Migration, applied map[int]appliedMigration) error {
+	known := map[int]Migration{}
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, record := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("database has migration %04d_%s applied which is unknown to this build", version, record.Name)
+		}
+		if migration.Checksum != record.Checksum {
+			return fmt.Errorf("checksum mismatch for migration %s: database has %s, file has %s",
+				migration.ID(), record.Checksum, migration.Checksum)
+		}
+	}
+	return nil
+}
+
+func prepareMigrations(dbConn connection, dialect Dialect) ([]Migration, map[int]appliedMigration, error) {
+	if err := ensureMigrationsTable(dbConn); err != nil {
+		return nil, nil, err
+	}
+	migrations, err := LoadMigrations(dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations(dbConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = verifyMigrations(migrations, applied); err != nil {
+		return nil, nil, err
+	}
+	return migrations, applied, nil
+}
+
+func runInTransaction(dbConn connection, fn func(tx *sql.Tx) error) error {
+	tx, err := dbConn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err = fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rollbackErr))
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// withMigrationLock runs fn on a single connection holding the migration lock of the dialect, so replicas starting at
+// the same time do not apply the same migration twice. fn has to read the applied migrations itself, another replica
+// may have applied some while we were waiting for the lock.
+func withMigrationLock(dbConn *sql.DB, dialect Dialect, fn func(conn connection) error) error {
+	ctx := context.Background()
+	conn, err := dbConn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migrations: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err = dialect.LockMigrations(ctx, conn); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	err = fn(conn)
+	if unlockErr := dialect.UnlockMigrations(ctx, conn); unlockErr != nil {
+		// The lock belongs to the session, so the connection must not go back into the pool while holding it
+		_ = conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+		return errors.Join(err, fmt.Errorf("failed to release migration lock: %w", unlockErr))
+	}
+	return err
+}
+
+// MigrateUp applies every pending migration in version order and returns the applied migrations. It holds the
+// migration lock while doing so, replicas migrating at the same time wait for each other.
+func MigrateUp(dbConn *sql.DB, dialect Dialect) ([]Migration, error) {
+	var done []Migration
+	err := withMigrationLock(dbConn, dialect, func(conn connection) error {
+		migrations, applied, err := prepareMigrations(conn, dialect)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = runInTransaction(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Up); err != nil {
+					return fmt.Errorf("failed to apply migration %s: %w", migration.ID(), err)
+				}
+				_, err := tx.Exec(dialect.Rebind("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"),
+					migration.Version, migration.Name, migration.Checksum)
+				if err != nil {
+					return fmt.Errorf("failed to record migration %s: %w", migration.ID(), err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown reverts the given number of most recently applied migrations and returns the reverted migrations. Like
+// MigrateUp it holds the migration lock.
+func MigrateDown(dbConn *sql.DB, dialect Dialect, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be at least 1")
+	}
+
+	var done []Migration
+	err := withMigrationLock(dbConn, dialect, func(conn connection) error {
+		migrations, applied, err := prepareMigrations(conn, dialect)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err = runInTransaction(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Down); err != nil {
+					return fmt.Errorf("failed to revert migration %s: %w", migration.ID(), err)
+				}
+				_, err := tx.Exec(dialect.Rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+				if err != nil {
+					return fmt.Errorf("failed to remove migration record %s: %w", migration.ID(), err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status reports every known migration and whether it has been applied to the database.
+func Status(dbConn *sql.DB, dialect Dialect) ([]MigrationStatus, error) {
+	migrations, applied, err := prepareMigrations(dbConn, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(50) NOT NULL UNIQUE,
+	name VARCHAR(20) NOT NULL,
+	password TEXT NOT NULL,
+	linked_account INTEGER NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	modified_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+
+	CONSTRAINT fk_linked_account FOREIGN KEY(linked_account) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS link_code (
+	user_id INTEGER PRIMARY KEY,
+	code UUID NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+
+	CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_code_code ON link_code (code);
+
+CREATE TABLE IF NOT EXISTS locations (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	latitude DOUBLE PRECISION NOT NULL,
+	longitude DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	is_valid BOOLEAN DEFAULT TRUE NOT NULL,
+	validation_reason TEXT DEFAULT '' NOT NULL,
+
+	CONSTRAINT fk_user_location FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_id_valid ON locations (user_id, is_valid);
+
+CREATE TABLE IF NOT EXISTS rejected_requests (
+	id SERIAL PRIMARY KEY,
+	user_email VARCHAR(50) NOT NULL,
+	status_code INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	ip_address VARCHAR(45) NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rejected_requests_ip_created ON rejected_requests (ip_address, created_at);
+
+CREATE TABLE IF NOT EXISTS banned_ips (
+	id SERIAL PRIMARY KEY,
+	ip_address VARCHAR(45) NOT NULL UNIQUE,
+	reason TEXT NOT NULL,
+	last_banned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	banned_length DOUBLE PRECISION NOT NULL,
+	banned_until TIMESTAMPTZ NOT NULL,
+	banned_times INTEGER DEFAULT 1 NOT NULL,
+
+	CONSTRAINT chk_banned_until CHECK (banned_until > last_banned_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_banned_ips_ip ON banned_ips (ip_address);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	device_name VARCHAR(100) DEFAULT '' NOT NULL,
+	user_agent TEXT DEFAULT '' NOT NULL,
+	ip_address VARCHAR(45) DEFAULT '' NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMPTZ NULL,
+
+	CONSTRAINT fk_session_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id);
+
+-- Every existing refresh token family becomes a session, so nobody gets logged out by the upgrade
+INSERT INTO sessions (id, user_id, created_at, last_seen_at, revoked_at)
+SELECT family_id,
+       MIN(user_id),
+       MIN(created_at),
+       MAX(created_at),
+       CASE WHEN COUNT(*) = COUNT(revoked_at) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id;
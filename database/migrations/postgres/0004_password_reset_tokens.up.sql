@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	ip_address VARCHAR(45) DEFAULT '' NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ NULL,
+
+	CONSTRAINT fk_password_reset_token_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens (user_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_email_verification_tokens_user;
+DROP TABLE IF EXISTS email_verification_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INTEGER PRIMARY KEY,
+	secret VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	confirmed_at TIMESTAMPTZ NULL,
+	last_used_step BIGINT DEFAULT 0 NOT NULL,
+	failed_attempts INTEGER DEFAULT 0 NOT NULL,
+	last_failed_at TIMESTAMPTZ NULL,
+
+	CONSTRAINT fk_user_totp_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	code_hash VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	used_at TIMESTAMPTZ NULL,
+
+	CONSTRAINT fk_recovery_code_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes (user_id, code_hash);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_log_user;
+DROP TABLE IF EXISTS audit_log;
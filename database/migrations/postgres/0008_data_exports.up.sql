@@ -0,0 +1,17 @@
+-- Exports of large location histories are generated in the background, the file is kept until expires_at
+CREATE TABLE IF NOT EXISTS data_exports (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	format VARCHAR(10) NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending' NOT NULL,
+	file_path TEXT DEFAULT '' NOT NULL,
+	error TEXT DEFAULT '' NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	completed_at TIMESTAMPTZ NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+
+	CONSTRAINT fk_user_data_export FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_expires ON data_exports (expires_at);
@@ -0,0 +1,18 @@
+-- History of every pairing, the user IDs have no foreign keys so the history of a user survives the partner deleting
+-- their account
+CREATE TABLE IF NOT EXISTS partner_links (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	partner_id INTEGER NOT NULL,
+	started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	ended_at TIMESTAMPTZ NULL,
+	ended_by INTEGER NULL,
+	end_reason VARCHAR(30) DEFAULT '' NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_partner_links_user ON partner_links (user_id, ended_at);
+CREATE INDEX IF NOT EXISTS idx_partner_links_partner ON partner_links (partner_id, ended_at);
+
+-- When existing pairings started is unknown, their history starts now
+INSERT INTO partner_links (user_id, partner_id)
+SELECT id, linked_account FROM users WHERE linked_account IS NOT NULL AND id < linked_account;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_link_requests_requester;
+DROP INDEX IF EXISTS idx_link_requests_owner;
+DROP TABLE IF EXISTS link_requests;
@@ -0,0 +1,16 @@
+-- Redeeming a link code only creates a request, the code owner has to accept it before the accounts are linked
+CREATE TABLE IF NOT EXISTS link_requests (
+	id SERIAL PRIMARY KEY,
+	owner_id INTEGER NOT NULL,
+	requester_id INTEGER NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending' NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	responded_at TIMESTAMPTZ NULL,
+
+	CONSTRAINT fk_link_request_owner FOREIGN KEY(owner_id) REFERENCES users(id),
+	CONSTRAINT fk_link_request_requester FOREIGN KEY(requester_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_requests_owner ON link_requests (owner_id, status);
+CREATE INDEX IF NOT EXISTS idx_link_requests_requester ON link_requests (requester_id, status);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_link_code_short_code;
+ALTER TABLE link_code DROP COLUMN short_code;
@@ -0,0 +1,4 @@
+-- Short codes people can type instead of the UUID. Codes created before stay usable through their UUID.
+ALTER TABLE link_code ADD COLUMN short_code VARCHAR(8) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_link_code_short_code ON link_code (short_code);
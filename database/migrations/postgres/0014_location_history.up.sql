@@ -0,0 +1,2 @@
+-- Pages through the location history by time without scanning every location of the user
+CREATE INDEX IF NOT EXISTS idx_locations_user_created ON locations (user_id, created_at, id);
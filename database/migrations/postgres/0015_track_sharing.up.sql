@@ -0,0 +1,2 @@
+-- Consent to let the linked partner export the track, it is withdrawn whenever the pairing ends
+ALTER TABLE users ADD COLUMN share_track BOOLEAN DEFAULT FALSE NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE locations DROP COLUMN altitude;
+ALTER TABLE locations DROP COLUMN accuracy;
@@ -0,0 +1,3 @@
+-- Optional details devices report with a location, in meters
+ALTER TABLE locations ADD COLUMN accuracy DOUBLE PRECISION NULL;
+ALTER TABLE locations ADD COLUMN altitude DOUBLE PRECISION NULL;
@@ -0,0 +1 @@
+-- PostgreSQL compares timestamps by value, idx_locations_user_created already serves the location history
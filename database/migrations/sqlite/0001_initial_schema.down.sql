@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_banned_ips_ip;
+DROP TABLE IF EXISTS banned_ips;
+
+DROP INDEX IF EXISTS idx_rejected_requests_ip_created;
+DROP TABLE IF EXISTS rejected_requests;
+
+DROP INDEX IF EXISTS idx_user_id_valid;
+DROP TABLE IF EXISTS locations;
+
+DROP INDEX IF EXISTS idx_link_code_code;
+DROP TABLE IF EXISTS link_code;
+
+DROP INDEX IF EXISTS idx_users_email;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_user;
+DROP INDEX IF EXISTS idx_refresh_tokens_family;
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	family_id VARCHAR(36) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME NULL,
+	replaced_by INTEGER NULL,
+
+	CONSTRAINT fk_refresh_token_user FOREIGN KEY(user_id) REFERENCES users(id),
+	CONSTRAINT fk_refresh_token_replaced_by FOREIGN KEY(replaced_by) REFERENCES refresh_tokens(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens (user_id);
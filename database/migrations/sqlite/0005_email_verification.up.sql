@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME NULL;
+
+-- Accounts created before verification existed cannot prove ownership anymore, they keep working as verified
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	email VARCHAR(50) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME NULL,
+
+	CONSTRAINT fk_email_verification_token_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user ON email_verification_tokens (user_id, created_at);
@@ -0,0 +1,11 @@
+-- user_id has no foreign key on purpose, audit records outlive deleted accounts
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NULL,
+	event VARCHAR(50) NOT NULL,
+	details TEXT DEFAULT '' NOT NULL,
+	ip_address VARCHAR(45) DEFAULT '' NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (user_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_data_exports_expires;
+DROP INDEX IF EXISTS idx_data_exports_user;
+DROP TABLE IF EXISTS data_exports;
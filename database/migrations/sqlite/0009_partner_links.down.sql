@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_partner_links_partner;
+DROP INDEX IF EXISTS idx_partner_links_user;
+DROP TABLE IF EXISTS partner_links;
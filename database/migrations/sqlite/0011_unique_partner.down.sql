@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_partner_links_open_partner;
+DROP INDEX IF EXISTS idx_partner_links_open_user;
+DROP INDEX IF EXISTS idx_users_linked_account;
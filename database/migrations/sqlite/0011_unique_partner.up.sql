@@ -0,0 +1,15 @@
+-- Earlier versions could leave a user pointing at a partner that moved on, so two people ended up linked to the same
+-- user. Those one-sided links are dropped before the unique index makes sure it cannot happen again.
+UPDATE users SET linked_account = NULL
+WHERE linked_account IS NOT NULL AND NOT EXISTS (
+	SELECT 1 FROM users AS partner WHERE partner.id = users.linked_account AND partner.linked_account = users.id
+);
+
+UPDATE partner_links SET ended_at = CURRENT_TIMESTAMP, end_reason = 'unlinked'
+WHERE ended_at IS NULL AND NOT EXISTS (
+	SELECT 1 FROM users WHERE users.id = partner_links.user_id AND users.linked_account = partner_links.partner_id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_linked_account ON users (linked_account);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_partner_links_open_user ON partner_links (user_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_partner_links_open_partner ON partner_links (partner_id) WHERE ended_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_circle_invites_circle;
+DROP TABLE IF EXISTS circle_invites;
+DROP INDEX IF EXISTS idx_circle_members_user;
+DROP TABLE IF EXISTS circle_members;
+DROP TABLE IF EXISTS circles;
@@ -0,0 +1,33 @@
+-- Circles let more than two users share their distance, independent of the one partner a user is linked with
+CREATE TABLE IF NOT EXISTS circles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS circle_members (
+	circle_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	role VARCHAR(10) DEFAULT 'member' NOT NULL,
+	joined_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+
+	PRIMARY KEY (circle_id, user_id),
+	CONSTRAINT fk_circle_member_circle FOREIGN KEY(circle_id) REFERENCES circles(id),
+	CONSTRAINT fk_circle_member_user FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_members_user ON circle_members (user_id);
+
+CREATE TABLE IF NOT EXISTS circle_invites (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	circle_id INTEGER NOT NULL,
+	created_by INTEGER NOT NULL,
+	short_code VARCHAR(8) NOT NULL UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at DATETIME NOT NULL,
+
+	CONSTRAINT fk_circle_invite_circle FOREIGN KEY(circle_id) REFERENCES circles(id),
+	CONSTRAINT fk_circle_invite_user FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_invites_circle ON circle_invites (circle_id);
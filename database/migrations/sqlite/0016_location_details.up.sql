@@ -0,0 +1,3 @@
+-- Optional details devices report with a location, in meters
+ALTER TABLE locations ADD COLUMN accuracy REAL NULL;
+ALTER TABLE locations ADD COLUMN altitude REAL NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE locations DROP COLUMN source;
+ALTER TABLE locations DROP COLUMN heading;
+ALTER TABLE locations DROP COLUMN speed;
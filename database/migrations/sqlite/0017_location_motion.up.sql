@@ -0,0 +1,4 @@
+-- Speed in meters per second and heading in degrees as reported by the device, and where the fix came from
+ALTER TABLE locations ADD COLUMN speed REAL NULL;
+ALTER TABLE locations ADD COLUMN heading REAL NULL;
+ALTER TABLE locations ADD COLUMN source VARCHAR(16) DEFAULT '' NOT NULL;
@@ -0,0 +1,2 @@
+-- The location history compares timestamps by their Julian day, whatever text format they were stored in
+CREATE INDEX IF NOT EXISTS idx_locations_user_julianday ON locations (user_id, julianday(created_at), id);
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	dbConn := openTestDatabase(t)
+	migrations, err := LoadMigrations(SQLite{})
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	applied, err := MigrateUp(dbConn, SQLite{})
+	if err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations to be applied, got %d", len(migrations), len(applied))
+	}
+	if applied, err = MigrateUp(dbConn, SQLite{}); err != nil || len(applied) != 0 {
+		t.Fatalf("expected an up to date database, got %d migrations (%v)", len(applied), err)
+	}
+
+	reverted, err := MigrateDown(dbConn, SQLite{}, 2)
+	if err != nil || len(reverted) != 2 {
+		t.Fatalf("expected 2 reverted migrations, got %d (%v)", len(reverted), err)
+	}
+	if reverted[0].Version != migrations[len(migrations)-1].Version {
+		t.Errorf("expected the newest migration to be reverted first, got %s", reverted[0].ID())
+	}
+
+	applied, err = MigrateUp(dbConn, SQLite{})
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected the 2 reverted migrations to be applied again, got %d (%v)", len(applied), err)
+	}
+	statuses, err := Status(dbConn, SQLite{})
+	if err != nil {
+		t.Fatalf("failed to read status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("expected %s to be applied", status.ID())
+		}
+	}
+}
+
+func TestPostgresMigrationsMatchSQLite(t *testing.T) {
+	sqlite, err := LoadMigrations(SQLite{})
+	if err != nil {
+		t.Fatalf("failed to load SQLite migrations: %v", err)
+	}
+	postgres, err := LoadMigrations(Postgres{})
+	if err != nil {
+		t.Fatalf("failed to load Postgres migrations: %v", err)
+	}
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("expected the same number of migrations, got %d for SQLite and %d for Postgres", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].ID() != postgres[i].ID() {
+			t.Errorf("expected migration %s for Postgres, got %s", sqlite[i].ID(), postgres[i].ID())
+		}
+	}
+}
+
+// processLock stands in for the Postgres advisory lock, which needs a server, with a lock shared by every replica in
+// the test
+type processLock struct {
+	SQLite
+	mu     *sync.Mutex
+	locked *int
+}
+
+func (l processLock) LockMigrations(context.Context, *sql.Conn) error {
+	l.mu.Lock()
+	*l.locked++
+	return nil
+}
+
+func (l processLock) UnlockMigrations(context.Context, *sql.Conn) error {
+	l.mu.Unlock()
+	return nil
+}
+
+func TestConcurrentMigrateUpAppliesEveryMigrationOnce(t *testing.T) {
+	migrations, err := LoadMigrations(SQLite{})
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	const replicas = 5
+	file := filepath.Join(t.TempDir(), "shared.db")
+	dialect := processLock{mu: &sync.Mutex{}, locked: new(int)}
+	applied := make([][]Migration, replicas)
+	errs := make([]error, replicas)
+
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		// Every replica has its own connection pool, like separate servers would
+		dbConn, err := sql.Open(SQLiteDriver, file)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = dbConn.Close()
+		})
+
+		wg.Add(1)
+		go func(replica int) {
+			defer wg.Done()
+			applied[replica], errs[replica] = MigrateUp(dbConn, dialect)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := 0; i < replicas; i++ {
+		if errs[i] != nil {
+			t.Errorf("replica %d failed to migrate: %v", i, errs[i])
+		}
+		total += len(applied[i])
+	}
+	if total != len(migrations) {
+		t.Errorf("expected every migration to be applied exactly once, %d were applied for %d migrations", total,
+			len(migrations))
+	}
+	if *dialect.locked != replicas {
+		t.Errorf("expected every replica to take the lock, it was taken %d times", *dialect.locked)
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer is meant for local development and tests. Every mail is logged and, if a directory is configured,
+// written to <dir>/<timestamp>_<id>.txt so links and tokens can be copied out of it.
+type FileMailer struct {
+	dir   string
+	sugar *zap.SugaredLogger
+}
+
+func NewFileMailer(dir string, sugar *zap.SugaredLogger) *FileMailer {
+	return &FileMailer{dir: dir, sugar: sugar}
+}
+
+func (m *FileMailer) Send(message Message) error {
+	if m.dir == "" {
+		m.sugar.Infow("Mail not sent, logging only",
+			zap.String("to", message.To),
+			zap.String("subject", message.Subject),
+			zap.String("body", message.Body),
+		)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s_%s.txt", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", m.dir, err)
+	}
+	m.sugar.Infow("Mail written to file", zap.String("to", message.To), zap.String("file", name))
+	return nil
+}
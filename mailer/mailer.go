@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"DistanceTrackerServer/constants"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text emails to users
+type Mailer interface {
+	Send(message Message) error
+}
+
+// New creates the mailer configured through DTS_MAILER: "smtp" for a real SMTP relay, "file" to write every mail into
+// DTS_MAIL_DIR, or "log" (the default) to only log mails, which is handy when running the server locally.
+func New(sugar *zap.SugaredLogger) (Mailer, error) {
+	switch constants.MailerType {
+	case "smtp":
+		if constants.SmtpHost == "" {
+			return nil, fmt.Errorf("DTS_SMTP_HOST is required for the smtp mailer")
+		}
+		return NewSMTPMailer(constants.SmtpHost, constants.SmtpPort, constants.SmtpUsername, constants.SmtpPassword,
+			constants.MailFrom), nil
+	case "file":
+		if constants.MailDir == "" {
+			return nil, fmt.Errorf("DTS_MAIL_DIR is required for the file mailer")
+		}
+		return NewFileMailer(constants.MailDir, sugar), nil
+	case "", "log":
+		return NewFileMailer("", sugar), nil
+	}
+	return nil, fmt.Errorf("unsupported mailer: %s", constants.MailerType)
+}
@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (m *SMTPMailer) Send(message Message) error {
+	// Never let user controlled values inject additional headers
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header value")
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection to anything but localhost
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	err := smtp.SendMail(net.JoinHostPort(m.host, m.port), auth, m.from, []string{message.To}, m.format(message))
+	if err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", message.To, err)
+	}
+	return nil
+}
+
+func (m *SMTPMailer) format(message Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + m.from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
@@ -6,6 +6,7 @@ import (
 	"DistanceTrackerServer/utils"
 	"fmt"
 	"go.uber.org/zap"
+	"os"
 	"time"
 )
 
@@ -42,6 +43,13 @@ func run() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			utils.Sugar.Fatal("Migration failed: ", err)
+		}
+		return
+	}
+
 	//TIP <p>Press <shortcut actionId="ShowIntentionActions"/> when your caret is at the underlined text
 	// to see how GoLand suggests fixing the warning.</p><p>Alternatively, if available, click the lightbulb to view possible fixes.</p>
 	run()
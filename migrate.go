@@ -0,0 +1,77 @@
+package main
+
+import (
+	"DistanceTrackerServer/database"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = "usage: DistanceTrackerServer migrate up|down [steps]|status"
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	dbConn, dialect, err := database.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbConn.Close()
+	}()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(dbConn, dialect)
+		for _, migration := range applied {
+			fmt.Printf("applied %s\n", migration.ID())
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of steps %q: %w", args[1], err)
+			}
+		}
+		reverted, err := database.MigrateDown(dbConn, dialect, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %s\n", migration.ID())
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case "status":
+		statuses, err := database.Status(dbConn, dialect)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "MIGRATION\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", status.ID(), state, appliedAt)
+		}
+		return writer.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
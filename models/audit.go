@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	AuditAccountDeleted       = "account_deleted"
+	AuditPasswordChanged      = "password_changed"
+	AuditEmailChangeRequested = "email_change_requested"
+	AuditPartnerUnlinked      = "partner_unlinked"
+	AuditLinkRequested        = "link_requested"
+	AuditLinkRequestAccepted  = "link_request_accepted"
+	AuditLinkRequestRejected  = "link_request_rejected"
+	AuditCircleCreated        = "circle_created"
+	AuditCircleJoined         = "circle_joined"
+	AuditCircleLeft           = "circle_left"
+	AuditCircleMemberRemoved  = "circle_member_removed"
+	AuditCircleDeleted        = "circle_deleted"
+	AuditTrackSharingChanged  = "track_sharing_changed"
+)
+
+// AuditEvent records security relevant changes to an account. Details must not contain personal data, the record is
+// kept after the account is deleted.
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Event     string    `json:"event"`
+	Details   string    `json:"details"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccountDeletion struct {
+	Password string `json:"password"`
+}
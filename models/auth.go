@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
 type UserRegister struct {
@@ -10,6 +11,8 @@ type UserRegister struct {
 	FirstName       string `json:"first_name"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
+	DeviceName      string `json:"device_name"`
+	ReturnTokens    bool   `json:"return_tokens"`
 }
 
 func (u *UserRegister) ToString() string {
@@ -19,16 +22,153 @@ func (u *UserRegister) ToString() string {
 }
 
 type UserLogin struct {
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	DeviceName   string `json:"device_name"`
+	ReturnTokens bool   `json:"return_tokens"`
+}
+
+type ProfileUpdate struct {
+	FirstName string `json:"first_name"`
+}
+
+type EmailChange struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenPair is returned in the response body to clients that cannot use cookies, e.g. the mobile apps
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+type ForgotPassword struct {
+	Email string `json:"email"`
+}
+
+type PasswordReset struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	IPAddress string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type VerifyEmail struct {
+	Token string `json:"token"`
+}
+
+type EmailVerificationToken struct {
+	ID        int
+	UserID    int
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type TwoFactorSetup struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorConfirm struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLogin completes a login that returned an MFA token. Either the code from the authenticator app or one of
+// the recovery codes has to be provided.
+type TwoFactorLogin struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceName   string `json:"device_name"`
+	ReturnTokens bool   `json:"return_tokens"`
+}
+
+// LoginResult either carries the issued tokens or, if a second factor is required, the MFA token to complete the
+// login with
+type LoginResult struct {
+	UserID   int
+	Tokens   TokenPair
+	MFAToken string
+}
+
+type TOTP struct {
+	UserID         int
+	Secret         string
+	CreatedAt      time.Time
+	ConfirmedAt    *time.Time
+	LastUsedStep   int64
+	FailedAttempts int
+	LastFailedAt   *time.Time
+}
+
+func (t *TOTP) IsConfirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// AccountLink identifies a link code either by its UUID or by the short code people can type
 type AccountLink struct {
 	PairUUID uuid.UUID `json:"pair_uuid"`
+	PairCode string    `json:"pair_code,omitempty"`
 }
 
 func (a *AccountLink) ToString() string {
-	return fmt.Sprintf("{pair_uuid: %s}",
-		a.PairUUID.String(),
+	return fmt.Sprintf("{pair_uuid: %s,\tpair_code: %s}",
+		a.PairUUID.String(), a.PairCode,
 	)
 }
+
+type RefreshToken struct {
+	ID         int
+	UserID     int
+	FamilyID   string
+	TokenHash  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *int
+}
+
+func (r *RefreshToken) IsRevoked() bool {
+	return r.RevokedAt != nil
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	DeviceName string     `json:"device_name"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
+
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
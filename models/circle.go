@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	CircleRoleOwner  = "owner"
+	CircleRoleMember = "member"
+)
+
+// Circle is a group of users sharing their distance with each other, next to the one partner a user can link with
+type Circle struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role of the user the circle was loaded for
+	Role    string         `json:"role,omitempty"`
+	Members []CircleMember `json:"members,omitempty"`
+}
+
+type CircleMember struct {
+	UserID    int       `json:"user_id"`
+	FirstName string    `json:"first_name"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// CircleInvite lets whoever redeems its short code join the circle once
+type CircleInvite struct {
+	ID        int       `json:"-"`
+	CircleID  int       `json:"circle_id"`
+	CreatedBy int       `json:"-"`
+	ShortCode string    `json:"code"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type NewCircle struct {
+	Name string `json:"name"`
+}
+
+type CircleJoin struct {
+	Code string `json:"code"`
+}
+
+// MemberDistance is how far a circle member is away
+type MemberDistance struct {
+	UserID    int    `json:"user_id"`
+	FirstName string `json:"first_name"`
+	Role      string `json:"role"`
+	DistanceInfo
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+)
+
+// TokenUseMFA marks tokens that only prove the password was correct and can only be exchanged for access tokens
+// together with a second factor
+const TokenUseMFA = "mfa"
+
+// Claims are carried by every access token. The subject is the user ID.
+type Claims struct {
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	// Use is empty for access tokens
+	Use string `json:"use,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user ID from the subject claim. VerifyToken rejects tokens whose subject is not a user ID, so
+// verified claims always return a valid ID.
+func (c *Claims) UserID() int {
+	userId, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0
+	}
+	return userId
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Account is the users row without the password hash
+type Account struct {
+	ID              int        `json:"id"`
+	Email           string     `json:"email"`
+	FirstName       string     `json:"first_name"`
+	LinkedAccount   *int       `json:"linked_account"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ModifiedAt      time.Time  `json:"modified_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	SharesTrack     bool       `json:"share_track_with_partner"`
+}
+
+type LinkCode struct {
+	Code      uuid.UUID `json:"code"`
+	ShortCode string    `json:"short_code"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RejectedRequest struct {
+	StatusCode int       `json:"status_code"`
+	Reason     string    `json:"reason"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PersonalDataExport holds everything we store about a user except their location history, which can be too large
+// to keep in memory and is streamed into the "locations" field instead
+type PersonalDataExport struct {
+	GeneratedAt      time.Time         `json:"generated_at"`
+	Account          Account           `json:"account"`
+	LinkCode         *LinkCode         `json:"link_code"`
+	PartnerLinks     []PartnerLink     `json:"partner_links"`
+	LinkRequests     []LinkRequest     `json:"link_requests"`
+	Circles          []Circle          `json:"circles"`
+	RejectedRequests []RejectedRequest `json:"rejected_requests"`
+	AuditLog         []AuditEvent      `json:"audit_log"`
+}
+
+// DataExport tracks an export that is generated in the background
+type DataExport struct {
+	ID          string     `json:"id"`
+	UserID      int        `json:"-"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
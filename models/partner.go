@@ -8,25 +8,67 @@ import (
 type Location struct {
 	Longitude float64 `json:"longitude"`
 	Latitude  float64 `json:"latitude"`
+	// Accuracy is the radius in meters the device is confident the position is within. It and every other field
+	// below is optional, the altitude is in meters, the speed in meters per second and the heading in degrees
+	// clockwise from north.
+	Accuracy *float64 `json:"accuracy,omitempty"`
+	Altitude *float64 `json:"altitude,omitempty"`
+	Speed    *float64 `json:"speed,omitempty"`
+	Heading  *float64 `json:"heading,omitempty"`
+	// Source is one of the LocationSource constants
+	Source string `json:"source,omitempty"`
 }
 
+const (
+	LocationSourceGPS     = "gps"
+	LocationSourceNetwork = "network"
+	LocationSourceManual  = "manual"
+)
+
 type LocationFromDB struct {
-	ID               int
-	UserID           int
-	Latitude         float64
-	Longitude        float64
-	CreatedAt        time.Time
-	IsValid          bool
-	ValidationReason string // optional
+	ID               int       `json:"id"`
+	UserID           int       `json:"-"`
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	Accuracy         *float64  `json:"accuracy,omitempty"`
+	Altitude         *float64  `json:"altitude,omitempty"`
+	Speed            *float64  `json:"speed,omitempty"`
+	Heading          *float64  `json:"heading,omitempty"`
+	Source           string    `json:"source,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	IsValid          bool      `json:"is_valid"`
+	ValidationReason string    `json:"validation_reason"` // optional
 }
 
 func (l *LocationFromDB) ToLocation() Location {
 	return Location{
 		Longitude: l.Longitude,
 		Latitude:  l.Latitude,
+		Accuracy:  l.Accuracy,
+		Altitude:  l.Altitude,
+		Speed:     l.Speed,
+		Heading:   l.Heading,
+		Source:    l.Source,
 	}
 }
 
+// BatchLocation is a location recorded by the device while it could not reach the server
+type BatchLocation struct {
+	Location
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type LocationBatch struct {
+	Locations []BatchLocation `json:"locations"`
+}
+
+// BatchResult tells whether the location at Index of the batch was accepted
+type BatchResult struct {
+	Index    int    `json:"index"`
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+}
+
 func (l *LocationFromDB) ToString() string {
 	return "{latitude: " + fmt.Sprintf("%f", l.Latitude) +
 		", longitude: " + fmt.Sprintf("%f", l.Longitude) +
@@ -35,7 +77,122 @@ func (l *LocationFromDB) ToString() string {
 		", validation_reason: " + l.ValidationReason + "}"
 }
 
+const DistanceUnitKilometers = "km"
+
+// DistanceInfo describes where someone is seen from the requesting user. Everything but Unit and NoLocation is nil
+// while they have no valid location.
+type DistanceInfo struct {
+	Distance         *float64   `json:"distance"`
+	Unit             string     `json:"unit"`
+	Bearing          *float64   `json:"bearing"`
+	Direction        string     `json:"direction,omitempty"`
+	LastUpdate       *time.Time `json:"last_update"`
+	StalenessSeconds *int64     `json:"staleness_seconds"`
+	NoLocation       bool       `json:"no_location"`
+}
+
+// PartnerDistance is the response to a distance request
+type PartnerDistance struct {
+	PartnerFirstName string `json:"partner_first_name"`
+	DistanceInfo
+}
+
+// LocationCursor points at a location in the history, the next page continues with the location following it
+type LocationCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// LocationQuery selects a page of the location history, zero times leave the range open. The history is ordered
+// newest first unless OldestFirst is set.
+type LocationQuery struct {
+	From           time.Time
+	To             time.Time
+	IncludeInvalid bool
+	OldestFirst    bool
+	Cursor         *LocationCursor
+	Limit          int
+}
+
+// FollowsCursor reports whether the location comes after the cursor in the order of the query
+func (q *LocationQuery) FollowsCursor(location LocationFromDB) bool {
+	if q.Cursor == nil {
+		return true
+	}
+	if location.CreatedAt.Equal(q.Cursor.CreatedAt) {
+		if q.OldestFirst {
+			return location.ID > q.Cursor.ID
+		}
+		return location.ID < q.Cursor.ID
+	}
+	if q.OldestFirst {
+		return location.CreatedAt.After(q.Cursor.CreatedAt)
+	}
+	return location.CreatedAt.Before(q.Cursor.CreatedAt)
+}
+
+// HistoryLocation is a location as returned by the history endpoints, the validity is only included on request
+type HistoryLocation struct {
+	ID               int       `json:"id"`
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	Accuracy         *float64  `json:"accuracy,omitempty"`
+	Altitude         *float64  `json:"altitude,omitempty"`
+	Speed            *float64  `json:"speed,omitempty"`
+	Heading          *float64  `json:"heading,omitempty"`
+	Source           string    `json:"source,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	IsValid          *bool     `json:"is_valid,omitempty"`
+	ValidationReason *string   `json:"validation_reason,omitempty"`
+}
+
+type LocationPage struct {
+	Locations  []HistoryLocation `json:"locations"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type TrackSharing struct {
+	Enabled *bool `json:"enabled"`
+}
+
 type UserInformation struct {
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 }
+
+const (
+	LinkEndUnlinked = "unlinked"
+	LinkEndRelinked = "relinked"
+	// LinkEndNewLinkCode is kept in the history of pairings older versions ended when a new link code was created
+	LinkEndNewLinkCode    = "new_link_code"
+	LinkEndAccountDeleted = "account_deleted"
+)
+
+// PartnerLink is one pairing in the link history of a user, seen from that user
+type PartnerLink struct {
+	ID        int        `json:"id"`
+	PartnerID int        `json:"partner_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	EndedBy   *int       `json:"ended_by"`
+	EndReason string     `json:"end_reason"`
+}
+
+const (
+	LinkRequestPending  = "pending"
+	LinkRequestAccepted = "accepted"
+	LinkRequestRejected = "rejected"
+)
+
+// LinkRequest is created when someone redeems a link code, the owner of the code has to accept it before the
+// accounts are linked
+type LinkRequest struct {
+	ID          int              `json:"id"`
+	OwnerID     int              `json:"-"`
+	RequesterID int              `json:"-"`
+	Status      string           `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	RespondedAt *time.Time       `json:"responded_at"`
+	Requester   *UserInformation `json:"requester,omitempty"`
+}
@@ -0,0 +1,104 @@
+package partner
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const maxBatchSize = 500
+
+var errBatchSize = fmt.Errorf("a batch must contain between 1 and %d locations", maxBatchSize)
+
+// RecordBatch validates the locations of the batch in the order they were recorded, each one against the valid
+// locations recorded before it, and stores all of them in one transaction. Batches are usually uploaded after the
+// device was offline, so their locations can be older than the ones the user sent live in the meantime. Rejected
+// locations are stored as invalid like single ones are. The results are in the order of the batch.
+func RecordBatch(locations store.LocationStore, userId int, batch models.LocationBatch) ([]models.BatchResult, error) {
+	if len(batch.Locations) == 0 || len(batch.Locations) > maxBatchSize {
+		return nil, errBatchSize
+	}
+
+	order := make([]int, len(batch.Locations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return batch.Locations[order[i]].Timestamp.Before(batch.Locations[order[j]].Timestamp)
+	})
+
+	now := time.Now()
+	results := make([]models.BatchResult, len(batch.Locations))
+	records := make([]models.LocationFromDB, 0, len(batch.Locations))
+	var accepted []models.LocationFromDB
+	for _, index := range order {
+		location := batch.Locations[index]
+		record := models.LocationFromDB{
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Accuracy:  location.Accuracy,
+			Altitude:  location.Altitude,
+			Speed:     location.Speed,
+			Heading:   location.Heading,
+			Source:    location.Source,
+			CreatedAt: location.Timestamp,
+			IsValid:   true,
+		}
+
+		previous, err := previousLocations(locations, userId, location.Timestamp, accepted)
+		if err != nil {
+			return nil, err
+		}
+		validationErr := locationValidator.Validate(LocationCheck{
+			Location:   location.Location,
+			RecordedAt: location.Timestamp,
+			ReceivedAt: now,
+			Previous:   previous,
+		})
+		if validationErr != nil {
+			record.IsValid = false
+			record.ValidationReason = validationErr.Error()
+			if location.Timestamp.IsZero() || location.Timestamp.After(now.Add(constants.ValidationMaxClockSkew)) {
+				// The timestamp cannot be trusted, the location is kept with the time it arrived
+				record.CreatedAt = now
+			}
+		} else {
+			// Later locations of the batch are validated against this one
+			accepted = append(accepted, record)
+		}
+
+		records = append(records, record)
+		results[index] = models.BatchResult{Index: index, Accepted: record.IsValid, Reason: record.ValidationReason}
+	}
+
+	if err := locations.InsertLocations(userId, records); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// previousLocations returns the newest valid locations recorded up to the time, newest first. The stored ones are
+// merged with those accepted from the batch so far, which are in the order they were recorded and not stored yet.
+func previousLocations(locations store.LocationStore, userId int, until time.Time,
+	accepted []models.LocationFromDB) ([]models.LocationFromDB, error) {
+	stored, err := locations.LastValidLocationsUntil(userId, until, savedLocationsToRetrieve)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve previous locations: %w", err)
+	}
+
+	previous := make([]models.LocationFromDB, 0, len(stored)+savedLocationsToRetrieve)
+	previous = append(previous, stored...)
+	for i := len(accepted) - 1; i >= 0 && i >= len(accepted)-savedLocationsToRetrieve; i-- {
+		previous = append(previous, accepted[i])
+	}
+	sort.SliceStable(previous, func(i, j int) bool {
+		return previous[i].CreatedAt.After(previous[j].CreatedAt)
+	})
+	if len(previous) > savedLocationsToRetrieve {
+		previous = previous[:savedLocationsToRetrieve]
+	}
+	return previous, nil
+}
@@ -0,0 +1,74 @@
+package partner
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"testing"
+	"time"
+)
+
+// walk returns locations around the start recorded a few minutes apart, moving about 100 m each time
+func walk(start models.Location, from time.Time, points int) []models.BatchLocation {
+	locations := make([]models.BatchLocation, points)
+	for i := range locations {
+		location := start
+		location.Latitude += float64(i) * 0.001
+		locations[i] = models.BatchLocation{Location: location, Timestamp: from.Add(time.Duration(i) * 5 * time.Minute)}
+	}
+	return locations
+}
+
+func TestRecordBatchValidatesAgainstLocationsRecordedBefore(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+	now := time.Now().Truncate(time.Second)
+
+	// Alice walked through Berlin while offline and took the train to Munich, where the app sent a live fix before
+	// the offline locations were uploaded
+	insertLocation(t, stores, alice, berlin, now.Add(-4*time.Hour))
+	insertLocation(t, stores, alice, munich, now.Add(-time.Minute))
+	batch := models.LocationBatch{Locations: walk(berlin, now.Add(-3*time.Hour), 4)}
+
+	results, err := RecordBatch(stores.Locations, alice, batch)
+	if err != nil {
+		t.Fatalf("failed to record batch: %v", err)
+	}
+	for _, result := range results {
+		if !result.Accepted {
+			t.Errorf("expected location %d recorded before the live fix to be accepted, got %q", result.Index,
+				result.Reason)
+		}
+	}
+}
+
+func TestRecordBatchValidatesAgainstAcceptedLocationsOfTheBatch(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+	now := time.Now().Truncate(time.Second)
+	insertLocation(t, stores, alice, berlin, now.Add(-4*time.Hour))
+
+	// Munich five minutes after a location in Berlin is out of reach, the location is sent last but recorded in the
+	// middle of the batch
+	locations := walk(berlin, now.Add(-3*time.Hour), 3)
+	locations = append(locations, models.BatchLocation{Location: munich, Timestamp: locations[1].Timestamp.Add(time.Minute)})
+	results, err := RecordBatch(stores.Locations, alice, models.LocationBatch{Locations: locations})
+	if err != nil {
+		t.Fatalf("failed to record batch: %v", err)
+	}
+	for index, accepted := range []bool{true, true, true, false} {
+		if results[index].Accepted != accepted {
+			t.Errorf("expected location %d to be accepted %t, got %+v", index, accepted, results[index])
+		}
+	}
+
+	// Uploading the same batch again adds nothing
+	results, err = RecordBatch(stores.Locations, alice, models.LocationBatch{Locations: locations})
+	if err != nil {
+		t.Fatalf("failed to record batch: %v", err)
+	}
+	for _, result := range results {
+		if result.Accepted {
+			t.Errorf("expected location %d of the repeated batch to be rejected", result.Index)
+		}
+	}
+}
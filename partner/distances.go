@@ -2,8 +2,8 @@ package partner
 
 import (
 	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
 	"DistanceTrackerServer/utils"
-	"database/sql"
 	"errors"
 	"fmt"
 	"math"
@@ -15,134 +15,102 @@ const (
 )
 
 var (
-	emailFromContext  = utils.EmailFromContext
-	dbConnFromContext = utils.DBConnFromContext
+	userIdFromContext = utils.UserIdFromContext
 	sin               = math.Sin
 	cos               = math.Cos
+	// locationValidator decides which submitted locations are valid, InitLocationValidation configures it
+	locationValidator LocationValidator = ValidationPipeline(validationRules())
 )
 
-func retrievePartnerLocation(dbConn *sql.DB, userId int) (models.LocationFromDB, error) {
-	partnerId, err := utils.GetPartnerIdByUserId(dbConn, userId)
-	if err != nil {
-		return models.LocationFromDB{}, fmt.Errorf("failed to retrieve partner ID: %w", err)
-	}
+var compassDirections = [...]string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
 
-	if partnerId == 0 {
-		return models.LocationFromDB{}, fmt.Errorf("no partner linked for user ID %d", userId)
+// partnerDistance returns how far the partner of the user is away from the location
+func partnerDistance(stores *store.Stores, userId int, location models.Location) (models.PartnerDistance, error) {
+	partnerId, err := stores.Users.GetPartnerId(userId)
+	if err != nil {
+		return models.PartnerDistance{}, fmt.Errorf("failed to retrieve partner ID: %w", err)
 	}
 
-	query := `
-		SELECT latitude, longitude, created_at FROM locations 
-		WHERE user_id = ? AND is_valid = TRUE
-		ORDER BY created_at DESC 
-		LIMIT 1`
-	row := dbConn.QueryRow(query, partnerId)
-
-	var partnerLocation models.LocationFromDB
-	err = row.Scan(&partnerLocation.Latitude, &partnerLocation.Longitude, &partnerLocation.CreatedAt)
+	partner, err := stores.Users.GetUserInformation(partnerId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.LocationFromDB{}, fmt.Errorf("no valid location found for partner ID %d", partnerId)
-		}
-		return models.LocationFromDB{}, fmt.Errorf("failed to scan partner location: %w", err)
+		return models.PartnerDistance{}, fmt.Errorf("failed to retrieve partner information: %w", err)
 	}
 
-	return partnerLocation, nil
-}
-
-func insertLocationToDB(location models.Location, dbConn *sql.DB, userId int, isValid bool) error {
-	query := `
-		INSERT INTO locations (user_id, latitude, longitude, created_at, is_valid) 
-		VALUES (?, ?, ?, ?, ?)`
-	_, err := dbConn.Exec(query, userId, location.Latitude, location.Longitude, time.Now(), isValid)
+	info, err := distanceTo(stores.Locations, partnerId, location)
 	if err != nil {
-		return fmt.Errorf("failed to insert location into database: %w", err)
+		return models.PartnerDistance{}, fmt.Errorf("failed to retrieve partner location: %w", err)
 	}
-	return nil
+	return models.PartnerDistance{PartnerFirstName: partner.FirstName, DistanceInfo: info}, nil
 }
 
-func validateDistanceRequest(currentLocation models.Location, dbConn *sql.DB, userId int) error {
-	if currentLocation.Latitude < -90 || currentLocation.Latitude > 90 {
-		return fmt.Errorf("latitude must be between -90 and 90")
-	}
-	if currentLocation.Longitude < -180 || currentLocation.Longitude > 180 {
-		return fmt.Errorf("longitude must be between -180 and 180")
-	}
+// distanceTo describes where the latest valid location of the other user is seen from the location. Not having a
+// valid location yet is not an error, it is flagged in the result instead.
+func distanceTo(locations store.LocationStore, otherId int, location models.Location) (models.DistanceInfo, error) {
+	info := models.DistanceInfo{Unit: models.DistanceUnitKilometers}
 
-	locations, err := getLastNLocations(userId, dbConn, savedLocationsToRetrieve)
+	otherLocation, err := locations.LatestValidLocation(otherId)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve last locations: %w", err)
-	}
-
-	// If we don't have enough locations, we can't validate the distance request, so we allow it to proceed
-	if len(locations) < (savedLocationsToRetrieve) {
-		return nil
-	}
-
-	const maxSpeedKmh = 150.0           // Standard hard limit
-	const highDistanceThreshold = 300.0 // km, allow high speed for longer distances
-	const insaneSpeedThreshold = 1000.0 // km/h, probably spoofed or plane teleport
-
-	newDistance := calculateDistance(locations[0].ToLocation(), currentLocation)
-	newTimeDiff := time.Since(locations[0].CreatedAt).Hours()
-
-	if newTimeDiff <= 0 {
-		return fmt.Errorf("invalid time difference for new location")
+		if errors.Is(err, store.ErrNotFound) {
+			info.NoLocation = true
+			return info, nil
+		}
+		return models.DistanceInfo{}, err
 	}
 
-	newSpeed := newDistance / newTimeDiff
-
-	// Reject speeds that are implausibly fast under any circumstance
-	if newSpeed > insaneSpeedThreshold {
-		return fmt.Errorf("speed %.2f km/h is unreasonably high", newSpeed)
-	}
+	distance := calculateDistance(location, otherLocation.ToLocation())
+	bearing := calculateBearing(location, otherLocation.ToLocation())
+	staleness := int64(math.Max(0, time.Since(otherLocation.CreatedAt).Seconds()))
+	lastUpdate := otherLocation.CreatedAt.UTC()
+
+	info.Distance = &distance
+	info.Bearing = &bearing
+	info.Direction = compassDirection(bearing)
+	info.LastUpdate = &lastUpdate
+	info.StalenessSeconds = &staleness
+	return info, nil
+}
 
-	// Allow high-speed travel if distance is very large
-	if newDistance > highDistanceThreshold {
-		// Only allow if the time justifies it
-		if newSpeed > 900.0 { // Max reasonable commercial plane speed
-			return fmt.Errorf("high distance (%.2f km) but speed %.2f km/h exceeds realistic air travel", newDistance, newSpeed)
+// memberDistances returns how far every other member of the circle is away from the location
+func memberDistances(locations store.LocationStore, circle models.Circle, userId int, location models.Location) ([]models.MemberDistance, error) {
+	distances := []models.MemberDistance{}
+	for _, member := range circle.Members {
+		if member.UserID == userId {
+			continue
 		}
-		// Otherwise allow — user may be on a train or flight
-		return nil
+		info, err := distanceTo(locations, member.UserID, location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve location of member %d: %w", member.UserID, err)
+		}
+		distances = append(distances, models.MemberDistance{
+			UserID:       member.UserID,
+			FirstName:    member.FirstName,
+			Role:         member.Role,
+			DistanceInfo: info,
+		})
 	}
+	return distances, nil
+}
 
-	// Normal validation for everyday movement
-	if newSpeed > maxSpeedKmh {
-		return fmt.Errorf("new speed %.2f km/h exceeds maximum allowed speed of %.2f km/h", newSpeed, maxSpeedKmh)
+func insertLocationToDB(location models.Location, locations store.LocationStore, userId int, validationErr error) error {
+	if validationErr != nil {
+		return locations.InsertLocation(userId, location, time.Now(), false, validationErr.Error())
 	}
-
-	return nil
+	return locations.InsertLocation(userId, location, time.Now(), true, "")
 }
 
-func getLastNLocations(userID int, dbConn *sql.DB, n int) ([]models.LocationFromDB, error) {
-	query := `
-		SELECT latitude, longitude, created_at FROM locations 
-        WHERE user_id = ? AND is_valid = TRUE
-        ORDER BY created_at DESC 
-        LIMIT ?`
-	rows, err := dbConn.Query(query, userID, n)
+// validateDistanceRequest checks a location submitted right now against the last valid locations of the user
+func validateDistanceRequest(currentLocation models.Location, locationStore store.LocationStore, userId int) error {
+	locations, err := locationStore.LastValidLocations(userId, savedLocationsToRetrieve)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve last %d locations for user %d: %w", n, userID, err)
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			fmt.Printf("Error closing rows: %v\n", err)
-		}
-	}(rows)
-
-	var locations []models.LocationFromDB
-	for rows.Next() {
-		var loc models.LocationFromDB
-		if err := rows.Scan(&loc.Latitude, &loc.Longitude, &loc.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan location: %w", err)
-		}
-		loc.UserID = userID
-		locations = append(locations, loc)
+		return fmt.Errorf("failed to retrieve last locations: %w", err)
 	}
-
-	return locations, nil
+	now := time.Now()
+	return locationValidator.Validate(LocationCheck{
+		Location:   currentLocation,
+		RecordedAt: now,
+		ReceivedAt: now,
+		Previous:   locations,
+	})
 }
 
 func calculateDistance(loc1, loc2 models.Location) float64 {
@@ -164,6 +132,24 @@ func calculateDistance(loc1, loc2 models.Location) float64 {
 	return math.Abs(R * c) // Distance in kilometers
 }
 
+// calculateBearing returns the initial bearing from loc1 to loc2 in degrees clockwise from north, between 0 and 360
+func calculateBearing(loc1, loc2 models.Location) float64 {
+	lat1 := degreesToRadians(loc1.Latitude)
+	lat2 := degreesToRadians(loc2.Latitude)
+	dlon := degreesToRadians(loc2.Longitude - loc1.Longitude)
+
+	y := sin(dlon) * cos(lat2)
+	x := cos(lat1)*sin(lat2) - sin(lat1)*cos(lat2)*cos(dlon)
+	bearing := math.Atan2(y, x) * 180 / math.Pi
+
+	return math.Mod(bearing+360, 360)
+}
+
+// compassDirection returns the closest of the eight compass directions for the bearing
+func compassDirection(bearing float64) string {
+	return compassDirections[int(math.Round(bearing/45))%len(compassDirections)]
+}
+
 func degreesToRadians(degrees float64) float64 {
 	return degrees * (3.141592653589793 / 180)
 }
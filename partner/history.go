@@ -0,0 +1,147 @@
+package partner
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryPageSize = 100
+	maxHistoryPageSize     = 500
+)
+
+var (
+	errInvalidLimit  = fmt.Errorf("limit must be between 1 and %d", maxHistoryPageSize)
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidRange  = errors.New("to must be after from")
+)
+
+// parseHistoryQuery reads the limit and cursor query parameters on top of the ones parseRangeQuery reads. Every error
+// it returns is caused by the request.
+func parseHistoryQuery(ctx *gin.Context) (models.LocationQuery, error) {
+	query, err := parseRangeQuery(ctx)
+	if err != nil {
+		return models.LocationQuery{}, err
+	}
+
+	query.Limit = defaultHistoryPageSize
+	if limit := ctx.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 || query.Limit > maxHistoryPageSize {
+			return models.LocationQuery{}, errInvalidLimit
+		}
+	}
+
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		query.Cursor, err = decodeCursor(cursor)
+		if err != nil {
+			return models.LocationQuery{}, err
+		}
+	}
+	return query, nil
+}
+
+// parseRangeQuery reads the from, to and include_invalid query parameters
+func parseRangeQuery(ctx *gin.Context) (models.LocationQuery, error) {
+	var query models.LocationQuery
+	var err error
+	if query.From, err = parseTimeParameter(ctx, "from"); err != nil {
+		return models.LocationQuery{}, err
+	}
+	if query.To, err = parseTimeParameter(ctx, "to"); err != nil {
+		return models.LocationQuery{}, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.To.After(query.From) {
+		return models.LocationQuery{}, errInvalidRange
+	}
+
+	if includeInvalid := ctx.Query("include_invalid"); includeInvalid != "" {
+		query.IncludeInvalid, err = strconv.ParseBool(includeInvalid)
+		if err != nil {
+			return models.LocationQuery{}, errors.New("include_invalid must be true or false")
+		}
+	}
+	return query, nil
+}
+
+func parseTimeParameter(ctx *gin.Context, name string) (time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return parsed, nil
+}
+
+// encodeCursor turns the position of the location in the history into an opaque string
+func encodeCursor(location models.LocationFromDB) string {
+	raw := fmt.Sprintf("%d:%d", location.CreatedAt.UnixNano(), location.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*models.LocationCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, errInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	locationId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &models.LocationCursor{CreatedAt: time.Unix(0, createdAt).UTC(), ID: locationId}, nil
+}
+
+// LocationHistory returns a page of the location history of the user. The next cursor is only set if there are more
+// locations.
+func LocationHistory(locations store.LocationStore, userId int, query models.LocationQuery) (models.LocationPage, error) {
+	// One more than requested tells whether there is another page
+	limit := query.Limit
+	query.Limit++
+	history, err := locations.LocationHistory(userId, query)
+	if err != nil {
+		return models.LocationPage{}, err
+	}
+
+	page := models.LocationPage{Locations: []models.HistoryLocation{}}
+	if len(history) > limit {
+		history = history[:limit]
+		page.NextCursor = encodeCursor(history[limit-1])
+	}
+	for _, location := range history {
+		entry := models.HistoryLocation{
+			ID:        location.ID,
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Accuracy:  location.Accuracy,
+			Altitude:  location.Altitude,
+			Speed:     location.Speed,
+			Heading:   location.Heading,
+			Source:    location.Source,
+			CreatedAt: location.CreatedAt.UTC(),
+		}
+		if query.IncludeInvalid {
+			entry.IsValid = &location.IsValid
+			entry.ValidationReason = &location.ValidationReason
+		}
+		page.Locations = append(page.Locations, entry)
+	}
+	return page, nil
+}
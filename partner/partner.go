@@ -2,9 +2,15 @@ package partner
 
 import (
 	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/tracks"
 	"DistanceTrackerServer/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // DistanceHandler /**
@@ -14,100 +20,411 @@ import (
 //	distance the partner is away.
 //
 // */
-func DistanceHandler(ctx *gin.Context) {
-	sugar, err := utils.SugarFromContext(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
-	}
+func DistanceHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	dbConn, err := dbConnFromContext(ctx)
-	if err != nil {
-		sugar.Errorw("Error retrieving database connection from context", "error", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
-	}
+		location := models.Location{}
+		err = ctx.BindJSON(&location)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	location := models.Location{}
-	err = ctx.BindJSON(&location)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	userEmail, err := emailFromContext(ctx)
-	if err != nil {
-		sugar.Errorw("Error retrieving email from context", "error", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+		if !recordLocation(ctx, stores, sugar, userId, location) {
+			return
+		}
+
+		distance, err := partnerDistance(stores, userId, location)
+		if err != nil {
+			if errors.Is(err, store.ErrNoPartner) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "no partner linked"})
+				return
+			}
+			sugar.Errorw("Error retrieving partner location", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		if distance.NoLocation {
+			sugar.Info("Partner has no valid location yet")
+		} else {
+			sugar.Infow("Successfully calculated distance", "distance", *distance.Distance)
+		}
+		ctx.JSON(http.StatusOK, distance)
 	}
+}
 
-	userId, err := utils.GetUserIdByEmail(dbConn, userEmail)
-	if err != nil {
-		sugar.Errorw("Error retrieving user ID by email", "error", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+// CircleDistanceHandler works like DistanceHandler for circles. The submitted location is stored the same way, the
+// response has one entry for every other member of the circle.
+func CircleDistanceHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circleId, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid circle ID"})
+			return
+		}
+
+		location := models.Location{}
+		err = ctx.BindJSON(&location)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		circle, err := stores.Circles.GetCircle(circleId, userId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "circle not found"})
+				return
+			}
+			sugar.Errorw("Error retrieving circle", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		if !recordLocation(ctx, stores, sugar, userId, location) {
+			return
+		}
+
+		distances, err := memberDistances(stores.Locations, circle, userId, location)
+		if err != nil {
+			sugar.Errorw("Error calculating circle distances", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+		sugar.Infow("Successfully calculated circle distances", "circle_id", circle.ID, "members", len(distances))
+		ctx.JSON(http.StatusOK, gin.H{
+			"circle_id": circle.ID,
+			"distances": distances,
+		})
 	}
+}
 
-	validationErr := validateDistanceRequest(location, dbConn, userId)
+// recordLocation validates and stores the submitted location. Invalid locations are stored too, flagged as invalid,
+// except for duplicates of a location that was just stored, as sent by an app polling in place or retrying a request.
+// It writes the error response and returns false if the request cannot go on.
+func recordLocation(ctx *gin.Context, stores *store.Stores, sugar *zap.SugaredLogger, userId int, location models.Location) bool {
+	validationErr := validateDistanceRequest(location, stores.Locations, userId)
+	if isDuplicate(validationErr) {
+		sugar.Infow("Location was just recorded, not saving it again", "reason", validationErr)
+		return true
+	}
 	if validationErr != nil {
 		sugar.Errorw("Distance validation failed, inserting location into database as invalid", "error", validationErr)
 	} else {
 		sugar.Info("Successfully validated Location Request, saving to db and returning partner location to user")
 	}
 
-	err = insertLocationToDB(location, dbConn, userId, validationErr == nil)
+	err := insertLocationToDB(location, stores.Locations, userId, validationErr)
 	if err != nil {
 		sugar.Errorw("Error inserting location into database", "error", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
-		return
+		return false
 	}
 	if validationErr != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return false
+	}
+	return true
+}
+
+func InformationHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		info, retrievalErr := Information(stores.Users, userId)
+		if retrievalErr != nil {
+			sugar.Errorw("Error retrieving partner information", "error", retrievalErr)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+		sugar.Infow("Successfully retrieved partner information", "info", info)
+		ctx.JSON(http.StatusOK, info)
+	}
+}
+
+// LocationHistoryHandler returns the location history of the authenticated user
+func LocationHistoryHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		respondWithHistory(ctx, stores, sugar, userId)
+	}
+}
+
+// PartnerLocationHistoryHandler returns the location history of the partner linked to the authenticated user. The
+// history holds the same points as an export, so the partner has to share their track just the same.
+func PartnerLocationHistoryHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		partnerId, err := partnerSharingTrack(stores, userId)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNoPartner):
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "no partner linked"})
+			case errors.Is(err, errTrackNotShared):
+				ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("Error retrieving partner track sharing", "error", err)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
+
+		respondWithHistory(ctx, stores, sugar, partnerId)
+	}
+}
+
+func respondWithHistory(ctx *gin.Context, stores *store.Stores, sugar *zap.SugaredLogger, ownerId int) {
+	query, err := parseHistoryQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	partnerLocation, err := retrievePartnerLocation(dbConn, userId)
+	page, err := LocationHistory(stores.Locations, ownerId, query)
 	if err != nil {
-		sugar.Errorw("Error retrieving partner location", "error", err)
+		sugar.Errorw("Error retrieving location history", "error", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
 		return
 	}
+	ctx.JSON(http.StatusOK, page)
+}
+
+// TrackExportHandler streams the track of the authenticated user as GPX, GeoJSON or KML
+func TrackExportHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		respondWithTrack(ctx, stores, sugar, userId)
+	}
+}
+
+// PartnerTrackExportHandler works like TrackExportHandler for the track of the linked partner, if they agreed to share
+// it through TrackSharingHandler
+func PartnerTrackExportHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
 
-	distance := calculateDistance(location, partnerLocation.ToLocation())
-	sugar.Infow("Successfully calculated distance", "distance", distance)
-	ctx.JSON(http.StatusOK, gin.H{
-		"distance": distance,
-	})
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		partnerId, err := partnerSharingTrack(stores, userId)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNoPartner):
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "no partner linked"})
+			case errors.Is(err, errTrackNotShared):
+				ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				sugar.Errorw("Error retrieving partner track sharing", "error", err)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			}
+			return
+		}
+
+		respondWithTrack(ctx, stores, sugar, partnerId)
+	}
 }
 
-func InformationHandler(ctx *gin.Context) {
-	sugar, err := utils.SugarFromContext(ctx)
+func respondWithTrack(ctx *gin.Context, stores *store.Stores, sugar *zap.SugaredLogger, ownerId int) {
+	format := ctx.DefaultQuery("format", tracks.FormatGPX)
+	query, err := parseRangeQuery(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	dbConn, err := dbConnFromContext(ctx)
+	owner, err := stores.Users.GetUserInformation(ownerId)
 	if err != nil {
-		sugar.Errorw("Error retrieving database connection from context", "error", err)
+		sugar.Errorw("Error retrieving user information", "error", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
 		return
 	}
 
-	userEmail, err := emailFromContext(ctx)
+	writer, err := tracks.NewWriter(ctx.Writer, format, "Track of "+owner.FirstName)
 	if err != nil {
-		sugar.Errorw("Error retrieving email from context", "error", err)
+		if errors.Is(err, tracks.ErrUnknownFormat) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sugar.Errorw("Error starting track export", "error", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
 		return
 	}
 
-	info, retrievalErr := Information(dbConn, userEmail)
-	if retrievalErr != nil {
-		sugar.Errorw("Error retrieving partner information", "error", retrievalErr)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+	ctx.Header("Content-Type", tracks.ContentType(format))
+	ctx.Header("Content-Disposition", `attachment; filename="track-`+time.Now().UTC().Format("2006-01-02")+"."+format+`"`)
+	ctx.Status(http.StatusOK)
+	// The status has been sent with the first byte, errors from here on can only be logged
+	if err := WriteTrack(writer, stores.Locations, ownerId, query); err != nil {
+		sugar.Errorw("Error writing track export", "error", err)
 		return
 	}
-	sugar.Infow("Successfully retrieved partner information", "info", info)
-	ctx.JSON(http.StatusOK, info)
+	sugar.Infow("Successfully exported track", "format", format)
+}
+
+// TrackSharingHandler lets the authenticated user decide whether their partner can export their track
+func TrackSharingHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		sharing := models.TrackSharing{}
+		err = ctx.BindJSON(&sharing)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if sharing.Enabled == nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		if err := SetTrackSharing(ctx, stores, userId, *sharing.Enabled); err != nil {
+			sugar.Errorw("Error updating track sharing", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+		sugar.Infow("Updated track sharing", "enabled", *sharing.Enabled)
+		ctx.JSON(http.StatusOK, gin.H{"enabled": *sharing.Enabled})
+	}
+}
+
+// LocationBatchHandler stores locations the device recorded while it was offline. Every location is accepted or
+// rejected on its own, the response has one result per location.
+func LocationBatchHandler(stores *store.Stores) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sugar, err := utils.SugarFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		batch := models.LocationBatch{}
+		err = ctx.BindJSON(&batch)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId, err := userIdFromContext(ctx)
+		if err != nil {
+			sugar.Errorw("Error retrieving user ID from context", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		results, err := RecordBatch(stores.Locations, userId, batch)
+		if err != nil {
+			if errors.Is(err, errBatchSize) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			sugar.Errorw("Error recording location batch", "error", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "INTERNAL SERVER ERROR"})
+			return
+		}
+
+		accepted := 0
+		for _, result := range results {
+			if result.Accepted {
+				accepted++
+			}
+		}
+		sugar.Infow("Recorded location batch", "accepted", accepted, "rejected", len(results)-accepted)
+		ctx.JSON(http.StatusOK, gin.H{
+			"accepted": accepted,
+			"rejected": len(results) - accepted,
+			"results":  results,
+		})
+	}
 }
@@ -0,0 +1,288 @@
+package partner
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs the handler for a request of the user, as if the authentication middleware had let it through
+func serve(t *testing.T, handler gin.HandlerFunc, method string, route string, target string, userId int, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	engine := gin.New()
+	engine.Handle(method, route, func(ctx *gin.Context) {
+		ctx.Set("sugar", zap.NewNop().Sugar())
+		ctx.Set("claims", &models.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(userId)}})
+	}, handler)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, &payload)
+	request.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, target any) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), target); err != nil {
+		t.Fatalf("failed to decode response %q: %v", recorder.Body.String(), err)
+	}
+}
+
+func createUser(t *testing.T, stores *store.Stores, name string) int {
+	t.Helper()
+	userId, err := stores.Users.CreateUser(strings.ToLower(name)+"@example.com", name, []byte("hash"))
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", name, err)
+	}
+	return userId
+}
+
+func linkedUsers(t *testing.T, stores *store.Stores) (int, int) {
+	t.Helper()
+	alice := createUser(t, stores, "Alice")
+	bob := createUser(t, stores, "Bob")
+	if err := stores.Users.LinkUsers(alice, bob); err != nil {
+		t.Fatalf("failed to link users: %v", err)
+	}
+	return alice, bob
+}
+
+func insertLocation(t *testing.T, stores *store.Stores, userId int, location models.Location, createdAt time.Time) {
+	t.Helper()
+	if err := stores.Locations.InsertLocation(userId, location, createdAt, true, ""); err != nil {
+		t.Fatalf("failed to insert location: %v", err)
+	}
+}
+
+var (
+	munich = models.Location{Latitude: 48.1374, Longitude: 11.5755}
+	berlin = models.Location{Latitude: 52.5200, Longitude: 13.4050}
+)
+
+func TestDistanceHandlerWithoutPartner(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+
+	recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, munich)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNotFound, recorder.Code, recorder.Body.String())
+	}
+
+	// The location is stored even though there is no one to compare it with
+	location, err := stores.Locations.LatestValidLocation(alice)
+	if err != nil {
+		t.Fatalf("expected the location to be stored: %v", err)
+	}
+	if location.Latitude != munich.Latitude || location.Longitude != munich.Longitude {
+		t.Errorf("expected %v, got %v", munich, location.ToLocation())
+	}
+}
+
+func TestDistanceHandlerReturnsPartnerDistance(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, bob := linkedUsers(t, stores)
+	insertLocation(t, stores, bob, berlin, time.Now().Add(-time.Minute))
+
+	recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, munich)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	var distance models.PartnerDistance
+	decode(t, recorder, &distance)
+	if distance.PartnerFirstName != "Bob" {
+		t.Errorf("expected partner Bob, got %q", distance.PartnerFirstName)
+	}
+	if distance.NoLocation || distance.Distance == nil {
+		t.Fatalf("expected a distance, got %+v", distance)
+	}
+	if math.Abs(*distance.Distance-504) > 5 {
+		t.Errorf("expected about 504 km between Munich and Berlin, got %.1f", *distance.Distance)
+	}
+	if distance.Direction != "N" {
+		t.Errorf("expected Berlin to be north of Munich, got %q", distance.Direction)
+	}
+	if distance.StalenessSeconds == nil || *distance.StalenessSeconds < 60 {
+		t.Errorf("expected the partner location to be at least a minute old, got %v", distance.StalenessSeconds)
+	}
+}
+
+func TestDistanceHandlerWithPartnerWithoutLocation(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, _ := linkedUsers(t, stores)
+
+	recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, munich)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	var distance models.PartnerDistance
+	decode(t, recorder, &distance)
+	if !distance.NoLocation || distance.Distance != nil {
+		t.Errorf("expected the missing partner location to be flagged, got %+v", distance)
+	}
+}
+
+func TestDistanceHandlerStoresInvalidLocation(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, _ := linkedUsers(t, stores)
+
+	recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, models.Location{})
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	}
+
+	history, err := stores.Locations.LocationHistory(alice, models.LocationQuery{IncludeInvalid: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to retrieve history: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected the invalid location to be stored, got %d locations", len(history))
+	}
+	if history[0].IsValid || !strings.HasPrefix(history[0].ValidationReason, "null_island: ") {
+		t.Errorf("expected an invalid location rejected by the null island rule, got %+v", history[0])
+	}
+}
+
+func TestDistanceHandlerSkipsDuplicateLocation(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, bob := linkedUsers(t, stores)
+	insertLocation(t, stores, bob, berlin, time.Now().Add(-time.Minute))
+
+	// The app polls twice from the same spot within the duplicate window
+	for i := 0; i < 2; i++ {
+		recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, munich)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status %d for poll %d, got %d: %s", http.StatusOK, i, recorder.Code,
+				recorder.Body.String())
+		}
+		var distance models.PartnerDistance
+		decode(t, recorder, &distance)
+		if distance.Distance == nil {
+			t.Errorf("expected the partner distance for poll %d, got %+v", i, distance)
+		}
+	}
+
+	history, err := stores.Locations.LocationHistory(alice, models.LocationQuery{IncludeInvalid: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to retrieve history: %v", err)
+	}
+	if len(history) != 1 || !history[0].IsValid {
+		t.Errorf("expected the location to be stored once as valid, got %+v", history)
+	}
+
+	// A duplicate that also fails another rule is still rejected
+	inaccurate := munich
+	accuracy := 5000.0
+	inaccurate.Accuracy = &accuracy
+	recorder := serve(t, DistanceHandler(stores), http.MethodPost, "/distance", "/distance", alice, inaccurate)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestLocationHistoryHandlerPages(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		insertLocation(t, stores, alice, munich, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	recorder := serve(t, LocationHistoryHandler(stores), http.MethodGet, "/locations", "/locations?limit=2", alice, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var page models.LocationPage
+	decode(t, recorder, &page)
+	if len(page.Locations) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected a full first page with a cursor, got %+v", page)
+	}
+	if !page.Locations[0].CreatedAt.After(page.Locations[1].CreatedAt) {
+		t.Errorf("expected the newest location first, got %+v", page.Locations)
+	}
+
+	recorder = serve(t, LocationHistoryHandler(stores), http.MethodGet, "/locations",
+		"/locations?limit=2&cursor="+page.NextCursor, alice, nil)
+	var next models.LocationPage
+	decode(t, recorder, &next)
+	if len(next.Locations) != 1 || next.NextCursor != "" {
+		t.Fatalf("expected the last location without a cursor, got %+v", next)
+	}
+	if !next.Locations[0].CreatedAt.Before(page.Locations[1].CreatedAt) {
+		t.Errorf("expected the second page to continue after the first, got %+v", next.Locations)
+	}
+}
+
+func TestLocationHistoryHandlerRejectsInvalidQuery(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+
+	for _, target := range []string{"/locations?limit=0", "/locations?cursor=nope", "/locations?from=yesterday"} {
+		recorder := serve(t, LocationHistoryHandler(stores), http.MethodGet, "/locations", target, alice, nil)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+func TestPartnerLocationHistoryHandlerWithoutPartner(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice := createUser(t, stores, "Alice")
+
+	recorder := serve(t, PartnerLocationHistoryHandler(stores), http.MethodGet, "/partner/locations",
+		"/partner/locations", alice, nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d: %s", http.StatusNotFound, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestPartnerLocationHistoryHandlerNeedsTrackSharing(t *testing.T) {
+	stores := store.NewMemoryStores()
+	alice, bob := linkedUsers(t, stores)
+	insertLocation(t, stores, bob, berlin, time.Now().Add(-time.Minute))
+
+	recorder := serve(t, PartnerLocationHistoryHandler(stores), http.MethodGet, "/partner/locations",
+		"/partner/locations", alice, nil)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d without consent, got %d: %s", http.StatusForbidden, recorder.Code,
+			recorder.Body.String())
+	}
+
+	if err := stores.Users.SetTrackSharing(bob, true); err != nil {
+		t.Fatalf("failed to enable track sharing: %v", err)
+	}
+	recorder = serve(t, PartnerLocationHistoryHandler(stores), http.MethodGet, "/partner/locations",
+		"/partner/locations", alice, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var page models.LocationPage
+	decode(t, recorder, &page)
+	if len(page.Locations) != 1 {
+		t.Errorf("expected the location of the partner, got %+v", page.Locations)
+	}
+}
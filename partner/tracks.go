@@ -0,0 +1,73 @@
+package partner
+
+import (
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
+	"DistanceTrackerServer/tracks"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+)
+
+// trackPageSize is how many locations are read at once while a track is streamed
+const trackPageSize = 500
+
+var errTrackNotShared = errors.New("your partner does not share their track")
+
+// WriteTrack streams the locations of the user in the range of the query, oldest first, and finishes the document
+func WriteTrack(writer tracks.Writer, locations store.LocationStore, userId int, query models.LocationQuery) error {
+	query.OldestFirst = true
+	query.Limit = trackPageSize
+	for {
+		page, err := locations.LocationHistory(userId, query)
+		if err != nil {
+			return err
+		}
+		for _, location := range page {
+			if err := writer.WriteLocation(location); err != nil {
+				return err
+			}
+		}
+		if len(page) < trackPageSize {
+			return writer.Close()
+		}
+		last := page[len(page)-1]
+		query.Cursor = &models.LocationCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// partnerSharingTrack returns the ID of the partner of the user if the partner agreed to share their track. The
+// consent covers both the location history and the exports of the partner.
+func partnerSharingTrack(stores *store.Stores, userId int) (int, error) {
+	partnerId, err := stores.Users.GetPartnerId(userId)
+	if err != nil {
+		return 0, err
+	}
+	shares, err := stores.Users.SharesTrack(partnerId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve track sharing: %w", err)
+	}
+	if !shares {
+		return 0, errTrackNotShared
+	}
+	return partnerId, nil
+}
+
+// SetTrackSharing records whether the authenticated user lets their partner see their location history and export
+// their track
+func SetTrackSharing(ctx *gin.Context, stores *store.Stores, userId int, enabled bool) error {
+	if err := stores.Users.SetTrackSharing(userId, enabled); err != nil {
+		return err
+	}
+
+	details := "disabled"
+	if enabled {
+		details = "enabled"
+	}
+	return stores.Audit.RecordAuditEvent(models.AuditEvent{
+		UserID:    userId,
+		Event:     models.AuditTrackSharingChanged,
+		Details:   details,
+		IPAddress: ctx.ClientIP(),
+	})
+}
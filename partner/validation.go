@@ -0,0 +1,300 @@
+package partner
+
+import (
+	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// LocationCheck is a location to validate together with the valid locations recorded before it
+type LocationCheck struct {
+	Location   models.Location
+	RecordedAt time.Time
+	ReceivedAt time.Time
+	// Previous are the last valid locations of the user recorded before this one, newest first
+	Previous []models.LocationFromDB
+}
+
+// LocationValidator decides whether a location is plausible. Validate returns nil if it is, otherwise an error
+// explaining why not, which is stored as the validation reason of the location.
+type LocationValidator interface {
+	Validate(check LocationCheck) error
+}
+
+// ValidationRule is a LocationValidator that can be turned on and off by its name
+type ValidationRule interface {
+	LocationValidator
+	Name() string
+}
+
+// ValidationFailure is a rule a location did not pass
+type ValidationFailure struct {
+	Rule   string
+	Reason string
+}
+
+// ValidationError lists every rule a location did not pass
+type ValidationError struct {
+	Failures []ValidationFailure
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		reasons[i] = failure.Rule + ": " + failure.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// onlyFailed tells whether the named rule is the only one the location did not pass
+func (e *ValidationError) onlyFailed(rule string) bool {
+	for _, failure := range e.Failures {
+		if failure.Rule != rule {
+			return false
+		}
+	}
+	return len(e.Failures) > 0
+}
+
+// ValidationPipeline runs every rule, so the error names all the rules a location did not pass
+type ValidationPipeline []ValidationRule
+
+func (p ValidationPipeline) Validate(check LocationCheck) error {
+	var failures []ValidationFailure
+	for _, rule := range p {
+		if err := rule.Validate(check); err != nil {
+			failures = append(failures, ValidationFailure{Rule: rule.Name(), Reason: err.Error()})
+		}
+	}
+	if len(failures) > 0 {
+		return &ValidationError{Failures: failures}
+	}
+	return nil
+}
+
+// CoordinateRangeRule rejects coordinates outside of the valid latitude and longitude ranges
+type CoordinateRangeRule struct{}
+
+func (CoordinateRangeRule) Name() string { return "coordinates" }
+
+func (CoordinateRangeRule) Validate(check LocationCheck) error {
+	if check.Location.Latitude < -90 || check.Location.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if check.Location.Longitude < -180 || check.Location.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// NullIslandRule rejects locations at 0,0, which devices and apps report when they have no position at all
+type NullIslandRule struct {
+	ToleranceDegrees float64
+}
+
+func (NullIslandRule) Name() string { return "null_island" }
+
+func (r NullIslandRule) Validate(check LocationCheck) error {
+	if math.Abs(check.Location.Latitude) <= r.ToleranceDegrees && math.Abs(check.Location.Longitude) <= r.ToleranceDegrees {
+		return fmt.Errorf("location is at 0,0 which usually means the device had no position")
+	}
+	return nil
+}
+
+// DetailsRule checks the optional speed, heading and source a device can report with a location
+type DetailsRule struct{}
+
+func (DetailsRule) Name() string { return "details" }
+
+func (DetailsRule) Validate(check LocationCheck) error {
+	location := check.Location
+	if location.Speed != nil && *location.Speed < 0 {
+		return fmt.Errorf("speed must not be negative")
+	}
+	if location.Heading != nil && (*location.Heading < 0 || *location.Heading >= 360) {
+		return fmt.Errorf("heading must be at least 0 and less than 360 degrees")
+	}
+	switch location.Source {
+	case "", models.LocationSourceGPS, models.LocationSourceNetwork, models.LocationSourceManual:
+	default:
+		return fmt.Errorf("source must be %s, %s or %s", models.LocationSourceGPS, models.LocationSourceNetwork,
+			models.LocationSourceManual)
+	}
+	return nil
+}
+
+// AccuracyRule rejects fixes that are too inaccurate to say much about where someone is
+type AccuracyRule struct {
+	MaxMeters float64
+}
+
+func (AccuracyRule) Name() string { return "accuracy" }
+
+func (r AccuracyRule) Validate(check LocationCheck) error {
+	accuracy := check.Location.Accuracy
+	if accuracy == nil {
+		return nil
+	}
+	if *accuracy < 0 {
+		return fmt.Errorf("accuracy must not be negative")
+	}
+	if *accuracy > r.MaxMeters {
+		return fmt.Errorf("accuracy of %.0f m is too low, at most %.0f m are accepted", *accuracy, r.MaxMeters)
+	}
+	return nil
+}
+
+// TimestampRule rejects locations without a timestamp or recorded in the future, allowing for devices whose clock is
+// a little ahead
+type TimestampRule struct {
+	MaxClockSkew time.Duration
+}
+
+func (TimestampRule) Name() string { return "timestamp" }
+
+func (r TimestampRule) Validate(check LocationCheck) error {
+	if check.RecordedAt.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	if check.RecordedAt.After(check.ReceivedAt.Add(r.MaxClockSkew)) {
+		return fmt.Errorf("timestamp is in the future")
+	}
+	return nil
+}
+
+// DuplicateRule rejects a location that was already recorded at the same position within the window, as happens when
+// a request is retried or a batch is uploaded twice
+type DuplicateRule struct {
+	Window time.Duration
+}
+
+const duplicateRuleName = "duplicate"
+
+func (DuplicateRule) Name() string { return duplicateRuleName }
+
+func (r DuplicateRule) Validate(check LocationCheck) error {
+	for _, previous := range check.Previous {
+		samePosition := previous.Latitude == check.Location.Latitude && previous.Longitude == check.Location.Longitude
+		gap := check.RecordedAt.Sub(previous.CreatedAt)
+		if samePosition && gap <= r.Window && gap >= -r.Window {
+			return fmt.Errorf("same location as the one recorded at %s", previous.CreatedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// isDuplicate tells whether the location failed validation only for being recorded already
+func isDuplicate(validationErr error) bool {
+	var failed *ValidationError
+	return errors.As(validationErr, &failed) && failed.onlyFailed(duplicateRuleName)
+}
+
+// SpeedRule rejects locations the user could not have reached from their last valid location in time. The accuracy
+// of both locations is taken off the distance, so GPS jitter between fixes a few seconds apart does not look like
+// driving on the highway.
+type SpeedRule struct {
+	// MinPrevious is how many valid locations the user needs before their speed is checked
+	MinPrevious int
+	// MaxSpeedKmh is the limit for everyday movement
+	MaxSpeedKmh float64
+	// LongDistanceKm and beyond the user may be on a train or flight, up to MaxLongDistanceSpeedKmh
+	LongDistanceKm          float64
+	MaxLongDistanceSpeedKmh float64
+	// TeleportSpeedKmh and faster is rejected under any circumstance, probably spoofed
+	TeleportSpeedKmh float64
+}
+
+func (SpeedRule) Name() string { return "speed" }
+
+func (r SpeedRule) Validate(check LocationCheck) error {
+	if len(check.Previous) == 0 || len(check.Previous) < r.MinPrevious {
+		return nil
+	}
+	last := check.Previous[0]
+
+	newTimeDiff := check.RecordedAt.Sub(last.CreatedAt).Hours()
+	if newTimeDiff <= 0 {
+		return fmt.Errorf("location was not recorded after the last valid location")
+	}
+
+	newDistance := calculateDistance(last.ToLocation(), check.Location)
+	uncertainty := accuracyInKm(check.Location) + accuracyInKm(last.ToLocation())
+	newSpeed := math.Max(0, newDistance-uncertainty) / newTimeDiff
+
+	if newSpeed > r.TeleportSpeedKmh {
+		return fmt.Errorf("speed %.2f km/h is unreasonably high", newSpeed)
+	}
+	if newDistance > r.LongDistanceKm {
+		if newSpeed > r.MaxLongDistanceSpeedKmh {
+			return fmt.Errorf("high distance (%.2f km) but speed %.2f km/h exceeds realistic air travel", newDistance, newSpeed)
+		}
+		return nil
+	}
+	if newSpeed > r.MaxSpeedKmh {
+		return fmt.Errorf("new speed %.2f km/h exceeds maximum allowed speed of %.2f km/h", newSpeed, r.MaxSpeedKmh)
+	}
+	return nil
+}
+
+// accuracyInKm returns the reported accuracy of the location, locations without one are taken as exact
+func accuracyInKm(location models.Location) float64 {
+	if location.Accuracy == nil {
+		return 0
+	}
+	return *location.Accuracy / 1000
+}
+
+// validationRules returns every rule configured through the constants, in the order they run
+func validationRules() []ValidationRule {
+	return []ValidationRule{
+		CoordinateRangeRule{},
+		NullIslandRule{ToleranceDegrees: constants.ValidationNullIslandTolerance},
+		DetailsRule{},
+		AccuracyRule{MaxMeters: constants.ValidationMaxAccuracy},
+		TimestampRule{MaxClockSkew: constants.ValidationMaxClockSkew},
+		DuplicateRule{Window: constants.ValidationDuplicateWindow},
+		SpeedRule{
+			MinPrevious:             constants.ValidationMinPrevious,
+			MaxSpeedKmh:             constants.ValidationMaxSpeed,
+			LongDistanceKm:          constants.ValidationLongDistance,
+			MaxLongDistanceSpeedKmh: constants.ValidationMaxLongDistanceSpeed,
+			TeleportSpeedKmh:        constants.ValidationTeleportSpeed,
+		},
+	}
+}
+
+// NewValidationPipeline returns a pipeline of the named rules, or of every rule if no names are given
+func NewValidationPipeline(names []string) (ValidationPipeline, error) {
+	rules := validationRules()
+	if len(names) == 0 {
+		return rules, nil
+	}
+
+	byName := make(map[string]ValidationRule, len(rules))
+	for _, rule := range rules {
+		byName[rule.Name()] = rule
+	}
+	pipeline := make(ValidationPipeline, 0, len(names))
+	for _, name := range names {
+		rule, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown location validation rule %q", name)
+		}
+		pipeline = append(pipeline, rule)
+	}
+	return pipeline, nil
+}
+
+// InitLocationValidation sets up the rules listed in constants.ValidationRules, until it is called every rule runs
+func InitLocationValidation() error {
+	pipeline, err := NewValidationPipeline(constants.ValidationRules)
+	if err != nil {
+		return err
+	}
+	locationValidator = pipeline
+	return nil
+}
@@ -0,0 +1,258 @@
+package partner
+
+import (
+	"DistanceTrackerServer/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validationTest is a location check and the reason a rule should give, empty if the location passes
+type validationTest struct {
+	name   string
+	check  LocationCheck
+	reason string
+}
+
+func runValidationTests(t *testing.T, rule ValidationRule, tests []validationTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(rule.Name()+"/"+test.name, func(t *testing.T) {
+			err := rule.Validate(test.check)
+			switch {
+			case test.reason == "" && err != nil:
+				t.Errorf("expected the location to pass, got %v", err)
+			case test.reason != "" && err == nil:
+				t.Errorf("expected the location to fail with %q", test.reason)
+			case test.reason != "" && !strings.Contains(err.Error(), test.reason):
+				t.Errorf("expected a reason containing %q, got %q", test.reason, err.Error())
+			}
+		})
+	}
+}
+
+func float(value float64) *float64 {
+	return &value
+}
+
+// at returns the location moved by the given degrees, with the accuracy in meters if it is not zero
+func at(location models.Location, north float64, east float64, accuracy float64) models.Location {
+	location.Latitude += north
+	location.Longitude += east
+	if accuracy != 0 {
+		location.Accuracy = float(accuracy)
+	}
+	return location
+}
+
+// recorded returns the location as stored at the time
+func recorded(location models.Location, createdAt time.Time) models.LocationFromDB {
+	return models.LocationFromDB{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Accuracy:  location.Accuracy,
+		CreatedAt: createdAt,
+		IsValid:   true,
+	}
+}
+
+var validationNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// checkOf returns a check of the location recorded and received now
+func checkOf(location models.Location, previous ...models.LocationFromDB) LocationCheck {
+	return LocationCheck{Location: location, RecordedAt: validationNow, ReceivedAt: validationNow, Previous: previous}
+}
+
+func TestCoordinateRangeRule(t *testing.T) {
+	runValidationTests(t, CoordinateRangeRule{}, []validationTest{
+		{"munich", checkOf(munich), ""},
+		{"poles and date line", checkOf(models.Location{Latitude: -90, Longitude: 180}), ""},
+		{"latitude too high", checkOf(models.Location{Latitude: 90.1, Longitude: 0}), "latitude"},
+		{"latitude too low", checkOf(models.Location{Latitude: -91, Longitude: 0}), "latitude"},
+		{"longitude too high", checkOf(models.Location{Latitude: 0, Longitude: 180.5}), "longitude"},
+		{"longitude too low", checkOf(models.Location{Latitude: 0, Longitude: -181}), "longitude"},
+	})
+}
+
+func TestNullIslandRule(t *testing.T) {
+	runValidationTests(t, NullIslandRule{ToleranceDegrees: 1e-6}, []validationTest{
+		{"zero", checkOf(models.Location{}), "0,0"},
+		{"within tolerance", checkOf(models.Location{Latitude: 1e-7, Longitude: -1e-7}), "0,0"},
+		{"only latitude zero", checkOf(models.Location{Latitude: 0, Longitude: 11.5}), ""},
+		{"just outside tolerance", checkOf(models.Location{Latitude: 2e-6, Longitude: 0}), ""},
+	})
+}
+
+func TestDetailsRule(t *testing.T) {
+	with := func(change func(*models.Location)) LocationCheck {
+		location := munich
+		change(&location)
+		return checkOf(location)
+	}
+	runValidationTests(t, DetailsRule{}, []validationTest{
+		{"no details", checkOf(munich), ""},
+		{"all details", with(func(l *models.Location) {
+			l.Speed, l.Heading, l.Source = float(1.5), float(0), models.LocationSourceGPS
+		}), ""},
+		{"negative speed", with(func(l *models.Location) { l.Speed = float(-1) }), "speed"},
+		{"negative heading", with(func(l *models.Location) { l.Heading = float(-0.5) }), "heading"},
+		{"full circle heading", with(func(l *models.Location) { l.Heading = float(360) }), "heading"},
+		{"network source", with(func(l *models.Location) { l.Source = models.LocationSourceNetwork }), ""},
+		{"unknown source", with(func(l *models.Location) { l.Source = "bluetooth" }), "source"},
+	})
+}
+
+func TestAccuracyRule(t *testing.T) {
+	runValidationTests(t, AccuracyRule{MaxMeters: 1000}, []validationTest{
+		{"no accuracy", checkOf(munich), ""},
+		{"exact", checkOf(at(munich, 0, 0, 5)), ""},
+		{"at the limit", checkOf(at(munich, 0, 0, 1000)), ""},
+		{"too inaccurate", checkOf(at(munich, 0, 0, 1001)), "too low"},
+		{"negative", checkOf(at(munich, 0, 0, -1)), "negative"},
+	})
+}
+
+func TestTimestampRule(t *testing.T) {
+	recordedAt := func(recordedAt time.Time) LocationCheck {
+		check := checkOf(munich)
+		check.RecordedAt = recordedAt
+		return check
+	}
+	runValidationTests(t, TimestampRule{MaxClockSkew: 5 * time.Minute}, []validationTest{
+		{"now", recordedAt(validationNow), ""},
+		{"in the past", recordedAt(validationNow.Add(-24 * time.Hour)), ""},
+		{"clock a little ahead", recordedAt(validationNow.Add(5 * time.Minute)), ""},
+		{"in the future", recordedAt(validationNow.Add(5*time.Minute + time.Second)), "future"},
+		{"missing", recordedAt(time.Time{}), "required"},
+	})
+}
+
+func TestDuplicateRule(t *testing.T) {
+	runValidationTests(t, DuplicateRule{Window: 10 * time.Second}, []validationTest{
+		{"no previous", checkOf(munich), ""},
+		{"same position just before", checkOf(munich, recorded(munich, validationNow.Add(-5*time.Second))),
+			"same location"},
+		{"same position at the edge of the window",
+			checkOf(munich, recorded(munich, validationNow.Add(-10*time.Second))), "same location"},
+		// Batches are validated against locations recorded later too
+		{"same position just after", checkOf(munich, recorded(munich, validationNow.Add(5*time.Second))),
+			"same location"},
+		{"same position outside the window", checkOf(munich, recorded(munich, validationNow.Add(-11*time.Second))), ""},
+		{"older duplicate", checkOf(munich, recorded(at(munich, 0.001, 0, 0), validationNow.Add(-time.Second)),
+			recorded(munich, validationNow.Add(-2*time.Second))), "same location"},
+		{"moved a little", checkOf(munich, recorded(at(munich, 0.00001, 0, 0), validationNow.Add(-time.Second))), ""},
+	})
+}
+
+func TestSpeedRule(t *testing.T) {
+	rule := SpeedRule{
+		MinPrevious:             1,
+		MaxSpeedKmh:             150,
+		LongDistanceKm:          300,
+		MaxLongDistanceSpeedKmh: 900,
+		TeleportSpeedKmh:        1000,
+	}
+	// A degree of latitude is about 111.2 km
+	ago := func(duration time.Duration) time.Time {
+		return validationNow.Add(-duration)
+	}
+	runValidationTests(t, rule, []validationTest{
+		{"no previous", checkOf(munich), ""},
+		{"walking", checkOf(at(munich, 0.01, 0, 0), recorded(munich, ago(15*time.Minute))), ""},
+		{"driving too fast", checkOf(at(munich, 1, 0, 0), recorded(munich, ago(30*time.Minute))),
+			"exceeds maximum allowed speed"},
+		{"not after the last", checkOf(munich, recorded(munich, validationNow)), "not recorded after"},
+		{"only the newest previous counts", checkOf(at(munich, 0.01, 0, 0), recorded(munich, ago(15*time.Minute)),
+			recorded(berlin, ago(20*time.Minute))), ""},
+
+		// 1 km in 10 seconds is 360 km/h, unless both fixes could be off by 600 m
+		{"jitter without accuracy", checkOf(at(munich, 0.009, 0, 0), recorded(munich, ago(10*time.Second))),
+			"exceeds maximum allowed speed"},
+		{"jitter within accuracy",
+			checkOf(at(munich, 0.009, 0, 600), recorded(at(munich, 0, 0, 600), ago(10*time.Second))), ""},
+		{"jitter beyond accuracy",
+			checkOf(at(munich, 0.009, 0, 100), recorded(at(munich, 0, 0, 100), ago(10*time.Second))),
+			"exceeds maximum allowed speed"},
+
+		// 400 km/h is too fast on the road, but fine on a flight of more than 300 km
+		{"fast below the long distance", checkOf(at(munich, 2.6, 0, 0), recorded(munich, ago(289*time.Hour/400))),
+			"exceeds maximum allowed speed"},
+		{"fast beyond the long distance", checkOf(at(munich, 2.8, 0, 0), recorded(munich, ago(311*time.Hour/400))), ""},
+		{"flight", checkOf(berlin, recorded(munich, ago(time.Hour))), ""},
+		{"faster than a plane", checkOf(berlin, recorded(munich, ago(32*time.Minute))), "exceeds realistic air travel"},
+
+		// 1200 km/h is rejected whatever the distance
+		{"teleport below the long distance", checkOf(at(munich, 1.8, 0, 0), recorded(munich, ago(10*time.Minute))),
+			"unreasonably high"},
+		{"teleport beyond the long distance", checkOf(berlin, recorded(munich, ago(25*time.Minute))),
+			"unreasonably high"},
+	})
+
+	rule.MinPrevious = 2
+	teleport := func(previous ...models.LocationFromDB) LocationCheck {
+		return checkOf(berlin, previous...)
+	}
+	runValidationTests(t, rule, []validationTest{
+		{"fewer than MinPrevious", teleport(recorded(munich, ago(time.Minute))), ""},
+		{"MinPrevious reached", teleport(recorded(munich, ago(time.Minute)), recorded(munich, ago(time.Hour))),
+			"unreasonably high"},
+	})
+}
+
+func TestValidationPipelineNamesEveryFailedRule(t *testing.T) {
+	pipeline, err := NewValidationPipeline(nil)
+	if err != nil {
+		t.Fatalf("failed to create pipeline: %v", err)
+	}
+	if len(pipeline) != 7 {
+		t.Fatalf("expected every rule to run without names, got %d", len(pipeline))
+	}
+
+	location := models.Location{Accuracy: float(5000), Source: "bluetooth"}
+	var validationErr *ValidationError
+	if err := pipeline.Validate(checkOf(location)); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	var rules []string
+	for _, failure := range validationErr.Failures {
+		rules = append(rules, failure.Rule)
+	}
+	if strings.Join(rules, ",") != "null_island,details,accuracy" {
+		t.Errorf("expected the null island, details and accuracy rules to fail, got %v", rules)
+	}
+	if err := pipeline.Validate(checkOf(munich)); err != nil {
+		t.Errorf("expected Munich to pass, got %v", err)
+	}
+}
+
+func TestNewValidationPipeline(t *testing.T) {
+	for _, test := range []struct {
+		names []string
+		rules []string
+		err   string
+	}{
+		{nil, []string{"coordinates", "null_island", "details", "accuracy", "timestamp", "duplicate", "speed"}, ""},
+		{[]string{"speed", "coordinates"}, []string{"speed", "coordinates"}, ""},
+		{[]string{"accuracy", "altitude"}, nil, `unknown location validation rule "altitude"`},
+		{[]string{"Speed"}, nil, `unknown location validation rule "Speed"`},
+	} {
+		pipeline, err := NewValidationPipeline(test.names)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected %q for %v, got %v", test.err, test.names, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to create pipeline of %v: %v", test.names, err)
+		}
+		var rules []string
+		for _, rule := range pipeline {
+			rules = append(rules, rule.Name())
+		}
+		if strings.Join(rules, ",") != strings.Join(test.rules, ",") {
+			t.Errorf("expected the rules %v for %v, got %v", test.rules, test.names, rules)
+		}
+	}
+}
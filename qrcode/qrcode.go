@@ -0,0 +1,453 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The encoder only implements what we need for links: byte mode, error correction level M and versions 1 to 10,
+// which holds up to 213 bytes.
+
+var ErrTooLong = errors.New("content too long for a QR code")
+
+// formatBitsM are the two bits identifying error correction level M in the format information
+const formatBitsM = 0
+
+// blockLayout describes how the codewords of a version are split into error correction blocks at level M
+type blockLayout struct {
+	ecPerBlock   int
+	group1Blocks int
+	group1Data   int
+	group2Blocks int
+	group2Data   int
+}
+
+var layouts = [...]blockLayout{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+}
+
+// alignmentCenters are the row and column coordinates of the alignment patterns of each version
+var alignmentCenters = [...][]int{
+	1:  {},
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+const maxVersion = len(layouts) - 1
+
+func (l blockLayout) dataCodewords() int {
+	return l.group1Blocks*l.group1Data + l.group2Blocks*l.group2Data
+}
+
+// Code is an encoded QR code symbol
+type Code struct {
+	Version int
+	// Size is the number of modules per side, without the quiet zone
+	Size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module in column x and row y is dark
+func (c *Code) Dark(x int, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes the content in byte mode, using the smallest version it fits in
+func Encode(content []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if len(content) <= byteCapacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%d bytes: %w", len(content), ErrTooLong)
+	}
+
+	code := newCode(version)
+	code.drawFunctionPatterns()
+	code.drawCodewords(interleave(version, dataCodewords(version, content)))
+	code.applyBestMask()
+	return code, nil
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func byteCapacity(version int) int {
+	// 4 bits for the mode indicator and the character count
+	return (layouts[version].dataCodewords()*8 - 4 - countBits(version)) / 8
+}
+
+type bitBuffer struct {
+	bytes []byte
+	bits  int
+}
+
+func (b *bitBuffer) append(value int, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.bits%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if (value>>i)&1 == 1 {
+			b.bytes[len(b.bytes)-1] |= 0x80 >> (b.bits % 8)
+		}
+		b.bits++
+	}
+}
+
+// dataCodewords encodes the content as a byte mode segment and pads it to the capacity of the version
+func dataCodewords(version int, content []byte) []byte {
+	capacity := layouts[version].dataCodewords()
+
+	var buffer bitBuffer
+	buffer.append(0b0100, 4)
+	buffer.append(len(content), countBits(version))
+	for _, b := range content {
+		buffer.append(int(b), 8)
+	}
+	// Terminator of up to four zero bits, then zero bits up to the byte boundary
+	buffer.append(0, min(4, capacity*8-buffer.bits))
+	if buffer.bits%8 != 0 {
+		buffer.append(0, 8-buffer.bits%8)
+	}
+	for pad := 0xEC; len(buffer.bytes) < capacity; pad ^= 0xEC ^ 0x11 {
+		buffer.append(pad, 8)
+	}
+	return buffer.bytes
+}
+
+// interleave splits the data into blocks, adds the error correction codewords of each block and interleaves them
+func interleave(version int, data []byte) []byte {
+	layout := layouts[version]
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < layout.group1Blocks+layout.group2Blocks; i++ {
+		length := layout.group1Data
+		if i >= layout.group1Blocks {
+			length = layout.group2Data
+		}
+		block := data[offset : offset+length]
+		offset += length
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+len(ecBlocks)*layout.ecPerBlock)
+	for i := 0; i < max(layout.group1Data, layout.group2Data); i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	code := &Code{Version: version, Size: size}
+	code.modules = make([][]bool, size)
+	code.isFunction = make([][]bool, size)
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+		code.isFunction[y] = make([]bool, size)
+	}
+	return code
+}
+
+func (c *Code) setFunctionModule(x int, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunctionModule(6, i, i%2 == 0)
+		c.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators, drawn after the timing patterns which they overlap
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	// Alignment patterns, except where they would overlap a finder pattern
+	centers := alignmentCenters[c.Version]
+	last := len(centers) - 1
+	for i, x := range centers {
+		for j, y := range centers {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format information, the real bits are drawn once the mask is known
+	c.drawFormatBits(0)
+	c.drawVersionBits()
+}
+
+func (c *Code) drawFinderPattern(centerX int, centerY int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := centerX+dx, centerY+dy
+			if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+				continue
+			}
+			distance := max(abs(dx), abs(dy))
+			c.setFunctionModule(x, y, distance != 2 && distance != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignmentPattern(centerX int, centerY int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunctionModule(centerX+dx, centerY+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the error correction level and mask, protected by a BCH code
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBitsM<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+
+	// Around the top left finder pattern
+	for i := 0; i <= 5; i++ {
+		c.setFunctionModule(8, i, bit(bits, i))
+	}
+	c.setFunctionModule(8, 7, bit(bits, 6))
+	c.setFunctionModule(8, 8, bit(bits, 7))
+	c.setFunctionModule(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunctionModule(14-i, 8, bit(bits, i))
+	}
+
+	// Split between the other two finder patterns
+	for i := 0; i < 8; i++ {
+		c.setFunctionModule(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunctionModule(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunctionModule(8, c.Size-8, true)
+}
+
+// drawVersionBits draws both copies of the version number, which versions 7 and up carry
+func (c *Code) drawVersionBits() {
+	if c.Version < 7 {
+		return
+	}
+	remainder := c.Version
+	for i := 0; i < 12; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | remainder
+
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunctionModule(a, b, bit(bits, i))
+		c.setFunctionModule(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a time from the bottom right
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern is skipped entirely
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vertical := 0; vertical < c.Size; vertical++ {
+			y := vertical
+			if upward {
+				y = c.Size - 1 - vertical
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = bit(int(codewords[i/8]), 7-i%8)
+				i++
+			}
+		}
+	}
+}
+
+func maskApplies(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask flips the data modules the mask applies to, applying it twice undoes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskApplies(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty score
+func (c *Code) applyBestMask() {
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+}
+
+// penalty scores how hard the symbol is to read, following the four rules of the specification
+func (c *Code) penalty() int {
+	penalty := 0
+	for _, line := range c.lines() {
+		// Runs of five or more modules of the same color
+		run := 1
+		for i := 1; i <= len(line); i++ {
+			if i < len(line) && line[i] == line[i-1] {
+				run++
+				continue
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+			run = 1
+		}
+
+		// Patterns looking like a finder pattern, with four light modules on either side
+		for i := 0; i+7 <= len(line); i++ {
+			if !matchesFinder(line[i : i+7]) {
+				continue
+			}
+			if lightRun(line, i-4, i) || lightRun(line, i+7, i+11) {
+				penalty += 40
+			}
+		}
+	}
+
+	// Blocks of 2x2 modules of the same color
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				color := c.modules[y][x]
+				if c.modules[y][x+1] == color && c.modules[y+1][x] == color && c.modules[y+1][x+1] == color {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Deviation of the share of dark modules from 50%, in steps of 5%
+	total := c.Size * c.Size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// lines returns every row and every column
+func (c *Code) lines() [][]bool {
+	lines := make([][]bool, 0, 2*c.Size)
+	for y := 0; y < c.Size; y++ {
+		lines = append(lines, c.modules[y])
+	}
+	for x := 0; x < c.Size; x++ {
+		column := make([]bool, c.Size)
+		for y := 0; y < c.Size; y++ {
+			column[y] = c.modules[y][x]
+		}
+		lines = append(lines, column)
+	}
+	return lines
+}
+
+func matchesFinder(modules []bool) bool {
+	return modules[0] && !modules[1] && modules[2] && modules[3] && modules[4] && !modules[5] && modules[6]
+}
+
+// lightRun reports whether all modules in [from, to) are light, modules outside of the symbol count as light
+func lightRun(line []bool, from int, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func bit(value int, i int) bool {
+	return (value>>i)&1 == 1
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,522 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// The tables below are copied from the specification (ISO/IEC 18004) for error correction level M instead of being
+// taken from the encoder, so the tests catch a wrong entry in the encoder's tables as well.
+
+// specFormatBits are the format information strings of level M for masks 0 to 7, most significant bit first
+var specFormatBits = [8]string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+// specVersionBits are the version information strings, most significant bit first
+var specVersionBits = map[int]string{
+	7:  "000111110010010100",
+	8:  "001000010110111100",
+	9:  "001001101010011001",
+	10: "001010010011010011",
+}
+
+// specByteCapacity is how many bytes each version holds in byte mode
+var specByteCapacity = [...]int{1: 14, 2: 26, 3: 42, 4: 62, 5: 84, 6: 106, 7: 122, 8: 152, 9: 180, 10: 213}
+
+// specBlocks are the error correction codewords per block and the data codewords of every block of each version
+var specBlocks = [...]struct {
+	ec   int
+	data []int
+}{
+	1:  {10, []int{16}},
+	2:  {16, []int{28}},
+	3:  {26, []int{44}},
+	4:  {18, []int{32, 32}},
+	5:  {24, []int{43, 43}},
+	6:  {16, []int{27, 27, 27, 27}},
+	7:  {18, []int{31, 31, 31, 31}},
+	8:  {22, []int{38, 38, 39, 39}},
+	9:  {22, []int{36, 36, 36, 37, 37}},
+	10: {26, []int{43, 43, 43, 43, 44}},
+}
+
+var specAlignmentCenters = [...][]int{
+	1:  nil,
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+// specRemainderBits are the modules left over after the last codeword
+func specRemainderBits(version int) int {
+	if version >= 2 && version <= 6 {
+		return 7
+	}
+	return 0
+}
+
+// specMask reports whether the mask inverts the module in row i and column j
+func specMask(mask int, i int, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// gfTables returns the exponent and logarithm tables of GF(2^8) with the QR code polynomial
+func gfTables() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+// syndromesAreZero evaluates the block, data followed by error correction codewords, at the first ec powers of the
+// generator. A valid Reed-Solomon codeword is zero at all of them.
+func syndromesAreZero(block []byte, ec int) bool {
+	exp, log := gfTables()
+	for k := 0; k < ec; k++ {
+		var sum byte
+		for _, b := range block {
+			// Horner's scheme: sum = sum * 2^k + b
+			if sum != 0 {
+				sum = exp[log[sum]+k]
+			}
+			sum ^= b
+		}
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type grid [][]bool
+
+func newGrid(size int) grid {
+	g := make(grid, size)
+	for y := range g {
+		g[y] = make([]bool, size)
+	}
+	return g
+}
+
+func (g grid) mark(x0 int, y0 int, width int, height int) {
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			g[y][x] = true
+		}
+	}
+}
+
+// reservedModules returns the modules of the version that do not hold data
+func reservedModules(version int) grid {
+	size := 4*version + 17
+	reserved := newGrid(size)
+	// Finder patterns with their separators and format information, the bottom left one includes the dark module
+	reserved.mark(0, 0, 9, 9)
+	reserved.mark(size-8, 0, 8, 9)
+	reserved.mark(0, size-8, 9, 8)
+	// Timing patterns
+	reserved.mark(6, 0, 1, size)
+	reserved.mark(0, 6, size, 1)
+	centers := specAlignmentCenters[version]
+	for i, x := range centers {
+		for j, y := range centers {
+			if (i == 0 && j == 0) || (i == 0 && j == len(centers)-1) || (i == len(centers)-1 && j == 0) {
+				continue
+			}
+			reserved.mark(x-2, y-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		reserved.mark(size-11, 0, 3, 6)
+		reserved.mark(0, size-11, 6, 3)
+	}
+	return reserved
+}
+
+func readBits(code *Code, positions [][2]int) string {
+	var bits []byte
+	for _, position := range positions {
+		if code.Dark(position[0], position[1]) {
+			bits = append(bits, '1')
+		} else {
+			bits = append(bits, '0')
+		}
+	}
+	return string(bits)
+}
+
+// decodeMask reads both copies of the format information and returns the mask they name
+func decodeMask(code *Code) (int, error) {
+	size := code.Size
+	var first, second [][2]int
+	for k := 0; k < 15; k++ {
+		switch {
+		case k <= 5:
+			first = append(first, [2]int{k, 8})
+		case k == 6:
+			first = append(first, [2]int{7, 8})
+		case k == 7:
+			first = append(first, [2]int{8, 8})
+		case k == 8:
+			first = append(first, [2]int{8, 7})
+		default:
+			first = append(first, [2]int{8, 14 - k})
+		}
+		if k <= 6 {
+			second = append(second, [2]int{8, size - 1 - k})
+		} else {
+			second = append(second, [2]int{size - 15 + k, 8})
+		}
+	}
+
+	format, copied := readBits(code, first), readBits(code, second)
+	if format != copied {
+		return 0, fmt.Errorf("format information copies differ: %s and %s", format, copied)
+	}
+	for mask, bits := range specFormatBits {
+		if bits == format {
+			return mask, nil
+		}
+	}
+	return 0, fmt.Errorf("format information %s is not level M", format)
+}
+
+func checkVersionBits(code *Code) error {
+	if code.Version < 7 {
+		return nil
+	}
+	var bottomLeft, topRight [][2]int
+	// Read from the most significant bit, which is bit 17
+	for i := 17; i >= 0; i-- {
+		bottomLeft = append(bottomLeft, [2]int{i / 3, code.Size - 11 + i%3})
+		topRight = append(topRight, [2]int{code.Size - 11 + i%3, i / 3})
+	}
+	for _, bits := range []string{readBits(code, bottomLeft), readBits(code, topRight)} {
+		if bits != specVersionBits[code.Version] {
+			return fmt.Errorf("expected version information %s, got %s", specVersionBits[code.Version], bits)
+		}
+	}
+	return nil
+}
+
+func checkPatterns(code *Code) error {
+	size := code.Size
+	for _, origin := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := -1; dy <= 7; dy++ {
+			for dx := -1; dx <= 7; dx++ {
+				x, y := origin[0]+dx, origin[1]+dy
+				if x < 0 || y < 0 || x >= size || y >= size {
+					continue
+				}
+				distance := max(abs(dx-3), abs(dy-3))
+				if dark := distance != 2 && distance < 4; code.Dark(x, y) != dark {
+					return fmt.Errorf("finder pattern at %v is wrong at %d,%d", origin, x, y)
+				}
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if code.Dark(6, i) != (i%2 == 0) || code.Dark(i, 6) != (i%2 == 0) {
+			return fmt.Errorf("timing pattern is wrong at %d", i)
+		}
+	}
+	if !code.Dark(8, size-8) {
+		return errors.New("dark module is light")
+	}
+	return nil
+}
+
+// decode reads the content back from the symbol, checking everything a reader relies on along the way
+func decode(code *Code) ([]byte, error) {
+	version := code.Version
+	if code.Size != 4*version+17 {
+		return nil, fmt.Errorf("version %d has size %d", version, code.Size)
+	}
+	if err := checkPatterns(code); err != nil {
+		return nil, err
+	}
+	mask, err := decodeMask(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersionBits(code); err != nil {
+		return nil, err
+	}
+
+	// Read the data modules in zigzag order, two columns at a time from the bottom right, skipping the vertical
+	// timing pattern
+	reserved := reservedModules(version)
+	var bits []bool
+	upward := true
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for n := 0; n < code.Size; n++ {
+			y := n
+			if upward {
+				y = code.Size - 1 - n
+			}
+			for _, x := range []int{right, right - 1} {
+				if !reserved[y][x] {
+					bits = append(bits, code.Dark(x, y) != specMask(mask, y, x))
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	blocks := specBlocks[version]
+	total := 0
+	for _, length := range blocks.data {
+		total += length + blocks.ec
+	}
+	if len(bits) != total*8+specRemainderBits(version) {
+		return nil, fmt.Errorf("expected %d data modules, got %d", total*8+specRemainderBits(version), len(bits))
+	}
+	for _, remainder := range bits[total*8:] {
+		if remainder {
+			return nil, errors.New("remainder bits are not zero")
+		}
+	}
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 0x80 >> j
+			}
+		}
+	}
+
+	// Undo the interleaving: the n-th data codeword of every block, then the n-th error correction codeword of every
+	// block
+	dataBlocks := make([][]byte, len(blocks.data))
+	next := 0
+	for i := 0; i < blocks.data[len(blocks.data)-1]; i++ {
+		for b, length := range blocks.data {
+			if i < length {
+				dataBlocks[b] = append(dataBlocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	ecBlocks := make([][]byte, len(blocks.data))
+	for i := 0; i < blocks.ec; i++ {
+		for b := range blocks.data {
+			ecBlocks[b] = append(ecBlocks[b], codewords[next])
+			next++
+		}
+	}
+	var data []byte
+	for b := range dataBlocks {
+		if !syndromesAreZero(append(append([]byte{}, dataBlocks[b]...), ecBlocks[b]...), blocks.ec) {
+			return nil, fmt.Errorf("error correction of block %d is wrong", b)
+		}
+		data = append(data, dataBlocks[b]...)
+	}
+
+	return parseSegment(data, version)
+}
+
+// parseSegment reads the byte mode segment and checks the terminator and padding after it
+func parseSegment(data []byte, version int) ([]byte, error) {
+	position := 0
+	read := func(length int) int {
+		value := 0
+		for i := 0; i < length; i++ {
+			value <<= 1
+			if data[position/8]&(0x80>>(position%8)) != 0 {
+				value |= 1
+			}
+			position++
+		}
+		return value
+	}
+
+	if mode := read(4); mode != 0b0100 {
+		return nil, fmt.Errorf("expected byte mode, got mode %04b", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	length := read(countBits)
+	if position+length*8 > len(data)*8 {
+		return nil, fmt.Errorf("segment of %d bytes does not fit", length)
+	}
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(read(8))
+	}
+
+	if terminator := min(4, len(data)*8-position); read(terminator) != 0 {
+		return nil, errors.New("terminator is not zero")
+	}
+	if position%8 != 0 && read(8-position%8) != 0 {
+		return nil, errors.New("bits up to the byte boundary are not zero")
+	}
+	for i, pad := range data[position/8:] {
+		if expected := []byte{0xEC, 0x11}[i%2]; pad != expected {
+			return nil, fmt.Errorf("expected pad codeword %#x, got %#x", expected, pad)
+		}
+	}
+	return content, nil
+}
+
+func testContent(length int) []byte {
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(i*37 + 11)
+	}
+	return content
+}
+
+func TestEncodeDecodesForEveryVersion(t *testing.T) {
+	tests := []struct {
+		content []byte
+		version int
+	}{
+		{[]byte{}, 1},
+		{[]byte("distancetracker://link?code=ABCD2345"), 3},
+		{testContent(14), 1},
+		{testContent(15), 2},
+		{testContent(42), 3},
+		{testContent(62), 4},
+		{testContent(84), 5},
+		{testContent(106), 6},
+		{testContent(107), 7},
+		{testContent(152), 8},
+		{testContent(153), 9},
+		{testContent(181), 10},
+		{testContent(213), 10},
+	}
+	for _, test := range tests {
+		code, err := Encode(test.content)
+		if err != nil {
+			t.Errorf("%d bytes: failed to encode: %v", len(test.content), err)
+			continue
+		}
+		if code.Version != test.version {
+			t.Errorf("%d bytes: expected version %d, got %d", len(test.content), test.version, code.Version)
+		}
+		decoded, err := decode(code)
+		if err != nil {
+			t.Errorf("%d bytes in version %d: %v", len(test.content), code.Version, err)
+			continue
+		}
+		if !bytes.Equal(decoded, test.content) {
+			t.Errorf("%d bytes: decoded %q, expected %q", len(test.content), decoded, test.content)
+		}
+	}
+}
+
+func TestEveryMaskDecodes(t *testing.T) {
+	content := []byte("distancetracker://link?code=ABCD2345")
+	for _, version := range []int{3, 7} {
+		for mask := 0; mask < 8; mask++ {
+			code := newCode(version)
+			code.drawFunctionPatterns()
+			code.drawCodewords(interleave(version, dataCodewords(version, content)))
+			code.applyMask(mask)
+			code.drawFormatBits(mask)
+
+			decoded, err := decode(code)
+			if err != nil || !bytes.Equal(decoded, content) {
+				t.Errorf("version %d with mask %d: decoded %q (%v)", version, mask, decoded, err)
+			}
+		}
+	}
+}
+
+func TestEncodePicksMaskWithLowestPenalty(t *testing.T) {
+	content := testContent(100)
+	code, err := Encode(content)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	chosen, err := decodeMask(code)
+	if err != nil {
+		t.Fatalf("failed to read mask: %v", err)
+	}
+
+	chosenPenalty := code.penalty()
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(chosen)
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); penalty < chosenPenalty {
+			t.Errorf("mask %d has penalty %d, lower than %d of the chosen mask %d", mask, penalty, chosenPenalty, chosen)
+		}
+		code.applyMask(mask)
+		code.applyMask(chosen)
+		code.drawFormatBits(chosen)
+	}
+}
+
+func TestEncodeRejectsTooLongContent(t *testing.T) {
+	for _, length := range []int{214, 1000} {
+		code, err := Encode(testContent(length))
+		if !errors.Is(err, ErrTooLong) || code != nil {
+			t.Errorf("%d bytes: expected ErrTooLong, got %v", length, err)
+		}
+	}
+}
+
+func TestByteCapacityMatchesSpecification(t *testing.T) {
+	for version := 1; version <= maxVersion; version++ {
+		if capacity := byteCapacity(version); capacity != specByteCapacity[version] {
+			t.Errorf("version %d: expected a capacity of %d bytes, got %d", version, specByteCapacity[version], capacity)
+		}
+	}
+}
+
+func TestReedSolomonKnownCodewords(t *testing.T) {
+	// "HELLO WORLD" in version 1-M, the worked example of thonky.com's QR code tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if actual := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(actual, expected) {
+		t.Errorf("expected error correction codewords %v, got %v", expected, actual)
+	}
+}
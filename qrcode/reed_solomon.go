@@ -0,0 +1,45 @@
+package qrcode
+
+// gfMultiply multiplies two elements of GF(2^8) modulo the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x byte, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree without its leading coefficient, highest
+// power first
+func reedSolomonDivisor(degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+
+	// Multiply by (x - r^i) for i = 0 ... degree-1, with r = 0x02 the generator of the field
+	var root byte = 1
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return divisor
+}
+
+// reedSolomonRemainder returns the error correction codewords for the data
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	remainder := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[len(remainder)-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return remainder
+}
@@ -0,0 +1,55 @@
+package qrcode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// QuietZone is the number of light modules around the symbol that readers need to find it
+const QuietZone = 4
+
+// Image renders the symbol with its quiet zone, every module being scale pixels wide
+func (c *Code) Image(scale int) image.Image {
+	size := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+QuietZone)*scale+dx, (y+QuietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	return png.Encode(w, c.Image(scale))
+}
+
+// WriteSVG writes the symbol as a single path, one unit per module, so it scales to any size
+func (c *Code) WriteSVG(w io.Writer, scale int) error {
+	buffered := bufio.NewWriter(w)
+	size := c.Size + 2*QuietZone
+	fmt.Fprintf(buffered, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %d %d" width="%d" height="%d" `+
+		`shape-rendering="crispEdges">`+"\n", size, size, size*scale, size*scale)
+	fmt.Fprintf(buffered, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n"+`<path fill="#000000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(buffered, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone)
+			}
+		}
+	}
+	fmt.Fprint(buffered, `"/>`+"\n</svg>\n")
+	return buffered.Flush()
+}
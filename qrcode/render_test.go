@@ -0,0 +1,82 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePNG(t *testing.T) {
+	code, err := Encode([]byte("distancetracker://link?code=ABCD2345"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	const scale = 3
+	var buffer bytes.Buffer
+	if err := code.WritePNG(&buffer, scale); err != nil {
+		t.Fatalf("failed to write PNG: %v", err)
+	}
+
+	img, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	size := (code.Size + 2*QuietZone) * scale
+	if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+		t.Fatalf("expected %dx%d pixels, got %v", size, size, bounds)
+	}
+	for y := -QuietZone; y < code.Size+QuietZone; y++ {
+		for x := -QuietZone; x < code.Size+QuietZone; x++ {
+			dark := x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Dark(x, y)
+			// Check the last pixel of the module, so a module drawn one pixel short is noticed
+			r, _, _, _ := img.At((x+QuietZone+1)*scale-1, (y+QuietZone+1)*scale-1).RGBA()
+			if (r == 0) != dark {
+				t.Fatalf("module %d,%d should be dark %t", x, y, dark)
+			}
+		}
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	code, err := Encode([]byte("distancetracker://link?code=ABCD2345"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	var buffer bytes.Buffer
+	if err := code.WriteSVG(&buffer, 4); err != nil {
+		t.Fatalf("failed to write SVG: %v", err)
+	}
+
+	var svg struct {
+		ViewBox string `xml:"viewBox,attr"`
+		Width   int    `xml:"width,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal(buffer.Bytes(), &svg); err != nil {
+		t.Fatalf("failed to parse SVG: %v", err)
+	}
+	size := code.Size + 2*QuietZone
+	if svg.ViewBox != "0 0 "+strconv.Itoa(size)+" "+strconv.Itoa(size) || svg.Width != size*4 {
+		t.Errorf("expected a %d module view box %d pixels wide, got %q and %d", size, size*4, svg.ViewBox, svg.Width)
+	}
+
+	dark := 0
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				dark++
+				if !strings.Contains(svg.Path.D, "M"+strconv.Itoa(x+QuietZone)+","+strconv.Itoa(y+QuietZone)+"h") {
+					t.Fatalf("expected a square for the dark module %d,%d", x, y)
+				}
+			}
+		}
+	}
+	if squares := strings.Count(svg.Path.D, "M"); squares != dark {
+		t.Errorf("expected %d squares, got %d", dark, squares)
+	}
+}
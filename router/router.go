@@ -1,16 +1,18 @@
 package router
 
 import (
+	"DistanceTrackerServer/account"
 	"DistanceTrackerServer/auth"
+	"DistanceTrackerServer/circles"
 	"DistanceTrackerServer/constants"
 	"DistanceTrackerServer/database"
+	"DistanceTrackerServer/mailer"
 	"DistanceTrackerServer/partner"
+	"DistanceTrackerServer/store"
 	"DistanceTrackerServer/utils"
-	"database/sql"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
@@ -27,7 +29,49 @@ var (
 	login                     = auth.LoginHandler
 	accountLinkCreation       = auth.AccountLinkCreationHandler
 	accountLink               = auth.AccountLinkHandler
+	linkCodeQR                = auth.LinkCodeQRHandler
+	accountUnlink             = auth.AccountUnlinkHandler
+	linkRequests              = auth.LinkRequestsHandler
+	answerLinkRequest         = auth.LinkRequestAnswerHandler
+	refreshTokens             = auth.RefreshHandler
+	logout                    = auth.LogoutHandler
+	listSessions              = auth.ListSessionsHandler
+	revokeSession             = auth.RevokeSessionHandler
+	jwksHandler               = auth.JWKSHandler
+	forgotPassword            = auth.ForgotPasswordHandler
+	resetPassword             = auth.ResetPasswordHandler
+	verifyEmail               = auth.VerifyEmailHandler
+	resendVerification        = auth.ResendVerificationHandler
+	requireVerifiedEmail      = auth.RequireVerifiedEmail
+	twoFactorSetup            = auth.TwoFactorSetupHandler
+	twoFactorConfirm          = auth.TwoFactorConfirmHandler
+	twoFactorLogin            = auth.TwoFactorLoginHandler
+	deleteAccount             = auth.DeleteAccountHandler
+	updateProfile             = auth.UpdateProfileHandler
+	changeEmail               = auth.EmailChangeHandler
+	changePassword            = auth.ChangePasswordHandler
+	exportAccount             = account.ExportHandler
+	exportStatus              = account.ExportStatusHandler
+	exportDownload            = account.ExportDownloadHandler
+	startExportCleanup        = account.StartExportCleanup
+	newMailer                 = mailer.New
+	initKeyring               = auth.InitKeyring
+	initLocationValidation    = partner.InitLocationValidation
 	distanceHandler           = partner.DistanceHandler
+	circleDistanceHandler     = partner.CircleDistanceHandler
+	locationHistory           = partner.LocationHistoryHandler
+	partnerLocationHistory    = partner.PartnerLocationHistoryHandler
+	exportTrack               = partner.TrackExportHandler
+	uploadLocationBatch       = partner.LocationBatchHandler
+	exportPartnerTrack        = partner.PartnerTrackExportHandler
+	trackSharing              = partner.TrackSharingHandler
+	createCircle              = circles.CreateCircleHandler
+	listCircles               = circles.ListCirclesHandler
+	getCircle                 = circles.GetCircleHandler
+	deleteCircle              = circles.DeleteCircleHandler
+	createCircleInvite        = circles.CreateInviteHandler
+	joinCircle                = circles.JoinCircleHandler
+	removeCircleMember        = circles.RemoveMemberHandler
 	partnerInfomrationHandler = partner.InformationHandler
 	healthCheckHandler        = HealthCheckHandler
 )
@@ -60,14 +104,13 @@ func LogRequest() gin.HandlerFunc {
 	}
 }
 
-func AddRouterMiddleware(dbConn *sql.DB) gin.HandlerFunc {
+func AddRouterMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := uuid.New()
 		logger := log.With(zap.String("request_id", id.String()))
 		ctx.Set("logger", logger)
 		ctx.Set("sugar", logger.Sugar())
 		ctx.Set("request_id", id.String())
-		ctx.Set("dbConn", dbConn)
 		ctx.Next()
 	}
 }
@@ -81,35 +124,95 @@ func Init(logger *zap.Logger) *gin.Engine {
 	sugar := log.Sugar()
 
 	sugar.Info("intializing sql connection")
-	db, err := sql.Open("sqlite3", constants.DatabaseFile)
+	db, dialect, err := database.Open()
 	if err != nil {
 		sugar.Fatal("Failed to open database: ", err)
 	}
-	sugar.Info("Initializing database")
-	err = database.InitDatabase(db)
+	if constants.AutoMigrate {
+		sugar.Info("Initializing database")
+		err = database.InitDatabase(db, dialect)
+		if err != nil {
+			sugar.Fatal("Failed to initialize database: ", err)
+		}
+	}
+
+	stores := store.NewSQLStores(db, dialect)
+
+	sugar.Info("Loading JWT signing keys")
+	err = initKeyring(sugar)
+	if err != nil {
+		sugar.Fatal("Failed to load JWT signing keys: ", err)
+	}
+
+	err = initLocationValidation()
 	if err != nil {
-		sugar.Fatal("Failed to initialize database: ", err)
+		sugar.Fatal("Failed to configure location validation: ", err)
 	}
 
+	mail, err := newMailer(sugar)
+	if err != nil {
+		sugar.Fatal("Failed to initialize mailer: ", err)
+	}
+
+	startExportCleanup(stores, sugar)
+
 	sugar.Info("Initializing router")
 	router := gin.New()
 	err = router.SetTrustedProxies(nil)
 	if err != nil {
 		sugar.Fatal("Failed to set trusted proxies: ", err)
 	}
-	router.Use(addRouterMiddleware(db))
-	router.Use(interceptBannedIp())
-	router.Use(authenticateRequest())
+	router.Use(addRouterMiddleware())
+	router.Use(interceptBannedIp(stores))
+	router.Use(authenticateRequest(stores))
 	router.Use(logRequest())
 
 	sugar.Info("Registering routes")
 	router.GET("/healthcheck", healthCheckHandler)
-	router.POST("/register", register)
-	router.POST("/login", login)
-	router.POST("/account-link-creation", accountLinkCreation)
-	router.POST("/account-link", accountLink)
-	router.POST("/distance", distanceHandler)
-	router.GET("/partner-information", partnerInfomrationHandler)
+	router.GET("/.well-known/jwks.json", jwksHandler())
+	router.POST("/register", register(stores, mail))
+	router.POST("/login", login(stores))
+	router.POST("/login/2fa", twoFactorLogin(stores))
+	router.POST("/2fa/setup", twoFactorSetup(stores))
+	router.POST("/2fa/confirm", twoFactorConfirm(stores))
+	router.POST("/token/refresh", refreshTokens(stores))
+	router.POST("/logout", logout(stores))
+	router.POST("/password/forgot", forgotPassword(stores, mail))
+	router.POST("/password/reset", resetPassword(stores, mail))
+	router.POST("/verify-email", verifyEmail(stores))
+	router.POST("/verify-email/resend", resendVerification(stores, mail))
+	router.GET("/sessions", listSessions(stores))
+	router.DELETE("/sessions/:id", revokeSession(stores))
+	router.DELETE("/account", deleteAccount(stores))
+	router.PATCH("/account", updateProfile(stores))
+	router.POST("/account/email", changeEmail(stores, mail))
+	router.POST("/account/password", changePassword(stores, mail))
+	router.GET("/account/export", exportAccount(stores))
+	router.GET("/account/exports/:id", exportStatus(stores))
+	router.GET("/account/exports/:id/download", exportDownload(stores))
+	router.POST("/account-link-creation", requireVerifiedEmail(stores), accountLinkCreation(stores))
+	router.GET("/link-code/qr", requireVerifiedEmail(stores), linkCodeQR(stores))
+	router.POST("/account-link", requireVerifiedEmail(stores), accountLink(stores, mail))
+	router.GET("/link-requests", requireVerifiedEmail(stores), linkRequests(stores))
+	router.POST("/link-requests/:id/accept", requireVerifiedEmail(stores), answerLinkRequest(stores, mail, true))
+	router.POST("/link-requests/:id/reject", requireVerifiedEmail(stores), answerLinkRequest(stores, mail, false))
+	router.POST("/account-unlink", accountUnlink(stores, mail))
+	router.POST("/distance", requireVerifiedEmail(stores), distanceHandler(stores))
+	router.GET("/partner-information", partnerInfomrationHandler(stores))
+	router.GET("/locations", locationHistory(stores))
+	router.GET("/partner/locations", requireVerifiedEmail(stores), partnerLocationHistory(stores))
+	router.GET("/locations/export", exportTrack(stores))
+	router.POST("/locations/batch", requireVerifiedEmail(stores), uploadLocationBatch(stores))
+	router.GET("/partner/locations/export", requireVerifiedEmail(stores), exportPartnerTrack(stores))
+	router.PUT("/partner/track-sharing", trackSharing(stores))
+	router.POST("/circles", requireVerifiedEmail(stores), createCircle(stores))
+	router.GET("/circles", listCircles(stores))
+	router.POST("/circles/join", requireVerifiedEmail(stores), joinCircle(stores))
+	router.GET("/circles/:id", getCircle(stores))
+	router.DELETE("/circles/:id", deleteCircle(stores))
+	router.POST("/circles/:id/invites", requireVerifiedEmail(stores), createCircleInvite(stores))
+	router.DELETE("/circles/:id/members/:userId", removeCircleMember(stores))
+	router.POST("/circles/:id/distances", requireVerifiedEmail(stores), circleDistanceHandler(stores))
 
 	return router
 }
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+type memoryUser struct {
+	id            int
+	email         string
+	name          string
+	passwordHash  string
+	linkedAccount int
+	createdAt     time.Time
+	modifiedAt    time.Time
+	verifiedAt    *time.Time
+	sharesTrack   bool
+}
+
+type memoryLinkCode struct {
+	userId    int
+	code      uuid.UUID
+	shortCode string
+	createdAt time.Time
+}
+
+type memoryRejectedRequest struct {
+	userEmail  string
+	statusCode int
+	reason     string
+	ipAddress  string
+	createdAt  time.Time
+}
+
+type memoryBan struct {
+	reason       string
+	lastBannedAt time.Time
+	bannedLength float64
+	bannedUntil  time.Time
+	bannedTimes  int
+}
+
+type memoryPartnerLink struct {
+	id        int
+	userId    int
+	partnerId int
+	startedAt time.Time
+	endedAt   *time.Time
+	endedBy   *int
+	endReason string
+}
+
+type memoryRecoveryCode struct {
+	userId   int
+	codeHash string
+	used     bool
+}
+
+// MemoryStore keeps every table in process memory. It is meant for tests and local experiments, nothing is persisted.
+type MemoryStore struct {
+	mu               sync.Mutex
+	now              func() time.Time
+	users            map[int]*memoryUser
+	nextUserId       int
+	linkCodes        map[int]memoryLinkCode
+	locations        []models.LocationFromDB
+	nextLocationId   int
+	rejectedRequests []memoryRejectedRequest
+	bans             map[string]*memoryBan
+	refreshTokens    map[int]*models.RefreshToken
+	nextRefreshId    int
+	sessions         map[string]*models.Session
+	passwordResets   map[int]*models.PasswordResetToken
+	nextResetId      int
+	verifications    map[int]*models.EmailVerificationToken
+	nextVerifyId     int
+	totp             map[int]*models.TOTP
+	recoveryCodes    []memoryRecoveryCode
+	auditLog         []models.AuditEvent
+	dataExports      map[string]*models.DataExport
+	partnerLinks     []*memoryPartnerLink
+	linkRequests     []*models.LinkRequest
+	nextRequestId    int
+	circles          map[int]*memoryCircle
+	nextCircleId     int
+	circleMembers    []*memoryCircleMember
+	circleInvites    []*models.CircleInvite
+	nextInviteId     int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:            time.Now,
+		users:          map[int]*memoryUser{},
+		nextUserId:     1,
+		linkCodes:      map[int]memoryLinkCode{},
+		bans:           map[string]*memoryBan{},
+		refreshTokens:  map[int]*models.RefreshToken{},
+		sessions:       map[string]*models.Session{},
+		passwordResets: map[int]*models.PasswordResetToken{},
+		verifications:  map[int]*models.EmailVerificationToken{},
+		totp:           map[int]*models.TOTP{},
+		dataExports:    map[string]*models.DataExport{},
+		circles:        map[int]*memoryCircle{},
+	}
+}
+
+func NewMemoryStores() *Stores {
+	memoryStore := NewMemoryStore()
+	return &Stores{
+		Users:              memoryStore,
+		Locations:          memoryStore,
+		LinkCodes:          memoryStore,
+		LinkRequests:       memoryStore,
+		Circles:            memoryStore,
+		Bans:               memoryStore,
+		Refresh:            memoryStore,
+		Sessions:           memoryStore,
+		PasswordResets:     memoryStore,
+		EmailVerifications: memoryStore,
+		TwoFactor:          memoryStore,
+		Audit:              memoryStore,
+		DataExports:        memoryStore,
+	}
+}
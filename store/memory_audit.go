@@ -0,0 +1,33 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+)
+
+// recordAuditEvent must be called with the lock held
+func (s *MemoryStore) recordAuditEvent(event models.AuditEvent) {
+	event.ID = len(s.auditLog) + 1
+	event.CreatedAt = s.now()
+	s.auditLog = append(s.auditLog, event)
+}
+
+func (s *MemoryStore) RecordAuditEvent(event models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recordAuditEvent(event)
+	return nil
+}
+
+func (s *MemoryStore) AuditEventsForUser(userId int) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []models.AuditEvent{}
+	for _, event := range s.auditLog {
+		if event.UserID == userId {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) LogRejectedRequest(userEmail string, statusCode int, reason string, ipAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rejectedRequests = append(s.rejectedRequests, memoryRejectedRequest{
+		userEmail:  userEmail,
+		statusCode: statusCode,
+		reason:     reason,
+		ipAddress:  ipAddress,
+		createdAt:  s.now(),
+	})
+	return nil
+}
+
+func (s *MemoryStore) CountRecentRejections(ipAddress string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.now().Add(-window)
+	count := 0
+	for _, request := range s.rejectedRequests {
+		if request.ipAddress == ipAddress && !request.createdAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) BanIp(ipAddress string, reason string, initialLength time.Duration) (float64, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	ban, ok := s.bans[ipAddress]
+	if !ok {
+		s.bans[ipAddress] = &memoryBan{
+			reason:       reason,
+			lastBannedAt: now,
+			bannedLength: initialLength.Hours(),
+			bannedUntil:  now.Add(initialLength),
+			bannedTimes:  1,
+		}
+		return initialLength.Hours(), 1, nil
+	}
+
+	ban.bannedLength *= 2
+	ban.bannedTimes++
+	ban.lastBannedAt = now
+	ban.bannedUntil = now.Add(time.Duration(ban.bannedLength * float64(time.Hour)))
+	ban.reason += " | " + reason
+	return ban.bannedLength, ban.bannedTimes, nil
+}
+
+func (s *MemoryStore) ActiveBanUntil(ipAddress string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, ok := s.bans[ipAddress]
+	if !ok || !ban.bannedUntil.After(s.now()) {
+		return time.Time{}, fmt.Errorf("active ban for IP %s: %w", ipAddress, ErrNotFound)
+	}
+	return ban.bannedUntil, nil
+}
+
+func (s *MemoryStore) RejectedRequestsForEmail(userEmail string) ([]models.RejectedRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []models.RejectedRequest{}
+	for _, request := range s.rejectedRequests {
+		if request.userEmail == userEmail {
+			requests = append(requests, models.RejectedRequest{
+				StatusCode: request.statusCode,
+				Reason:     request.reason,
+				IPAddress:  request.ipAddress,
+				CreatedAt:  request.createdAt,
+			})
+		}
+	}
+	return requests, nil
+}
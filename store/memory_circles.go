@@ -0,0 +1,239 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type memoryCircle struct {
+	id        int
+	name      string
+	createdAt time.Time
+}
+
+type memoryCircleMember struct {
+	circleId int
+	userId   int
+	role     string
+	joinedAt time.Time
+}
+
+func (s *MemoryStore) CreateCircle(name string, ownerId int) (models.Circle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextCircleId++
+	circle := &memoryCircle{id: s.nextCircleId, name: name, createdAt: s.now()}
+	s.circles[circle.id] = circle
+	s.circleMembers = append(s.circleMembers, &memoryCircleMember{
+		circleId: circle.id,
+		userId:   ownerId,
+		role:     models.CircleRoleOwner,
+		joinedAt: circle.createdAt,
+	})
+	return models.Circle{ID: circle.id, Name: name, CreatedAt: circle.createdAt, Role: models.CircleRoleOwner}, nil
+}
+
+// circleMember must be called with the lock held
+func (s *MemoryStore) circleMember(circleId int, userId int) *memoryCircleMember {
+	for _, member := range s.circleMembers {
+		if member.circleId == circleId && member.userId == userId {
+			return member
+		}
+	}
+	return nil
+}
+
+// circleMembersOf must be called with the lock held. The members are sorted by when they joined.
+func (s *MemoryStore) circleMembersOf(circleId int) []*memoryCircleMember {
+	var members []*memoryCircleMember
+	for _, member := range s.circleMembers {
+		if member.circleId == circleId {
+			members = append(members, member)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].joinedAt.Equal(members[j].joinedAt) {
+			return members[i].userId < members[j].userId
+		}
+		return members[i].joinedAt.Before(members[j].joinedAt)
+	})
+	return members
+}
+
+func (s *MemoryStore) CirclesForUser(userId int) ([]models.Circle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	circles := []models.Circle{}
+	for _, member := range s.circleMembers {
+		if member.userId != userId {
+			continue
+		}
+		circle := s.circles[member.circleId]
+		circles = append(circles, models.Circle{ID: circle.id, Name: circle.name, CreatedAt: circle.createdAt, Role: member.role})
+	}
+	sort.Slice(circles, func(i, j int) bool {
+		return circles[i].ID < circles[j].ID
+	})
+	return circles, nil
+}
+
+func (s *MemoryStore) GetCircle(circleId int, userId int) (models.Circle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getCircle(circleId, userId)
+}
+
+// getCircle must be called with the lock held
+func (s *MemoryStore) getCircle(circleId int, userId int) (models.Circle, error) {
+	circle, ok := s.circles[circleId]
+	self := s.circleMember(circleId, userId)
+	if !ok || self == nil {
+		return models.Circle{}, fmt.Errorf("circle %d: %w", circleId, ErrNotFound)
+	}
+
+	result := models.Circle{ID: circle.id, Name: circle.name, CreatedAt: circle.createdAt, Role: self.role}
+	result.Members = []models.CircleMember{}
+	for _, member := range s.circleMembersOf(circleId) {
+		var firstName string
+		if user, ok := s.users[member.userId]; ok {
+			firstName = user.name
+		}
+		result.Members = append(result.Members, models.CircleMember{
+			UserID:    member.userId,
+			FirstName: firstName,
+			Role:      member.role,
+			JoinedAt:  member.joinedAt,
+		})
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) CreateCircleInvite(invite models.CircleInvite) (models.CircleInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.circleInvites {
+		if existing.ShortCode == invite.ShortCode {
+			return models.CircleInvite{}, fmt.Errorf("circle invite: %w", ErrConflict)
+		}
+	}
+	s.nextInviteId++
+	invite.ID = s.nextInviteId
+	invite.CreatedAt = s.now()
+	s.circleInvites = append(s.circleInvites, &invite)
+	return invite, nil
+}
+
+func (s *MemoryStore) RedeemCircleInvite(shortCode string, userId int, maxMembers int) (models.Circle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, invite := range s.circleInvites {
+		if invite.ShortCode != shortCode {
+			continue
+		}
+		if s.now().After(invite.ExpiresAt) {
+			s.circleInvites = append(s.circleInvites[:i], s.circleInvites[i+1:]...)
+			return models.Circle{}, fmt.Errorf("circle invite: %w", ErrExpired)
+		}
+		if s.circleMember(invite.CircleID, userId) != nil {
+			return models.Circle{}, fmt.Errorf("circle %d: %w", invite.CircleID, ErrIsMember)
+		}
+		if len(s.circleMembersOf(invite.CircleID)) >= maxMembers {
+			return models.Circle{}, fmt.Errorf("circle %d: %w", invite.CircleID, ErrCircleFull)
+		}
+
+		s.circleInvites = append(s.circleInvites[:i], s.circleInvites[i+1:]...)
+		s.circleMembers = append(s.circleMembers, &memoryCircleMember{
+			circleId: invite.CircleID,
+			userId:   userId,
+			role:     models.CircleRoleMember,
+			joinedAt: s.now(),
+		})
+		return s.getCircle(invite.CircleID, userId)
+	}
+	return models.Circle{}, fmt.Errorf("circle invite: %w", ErrNotFound)
+}
+
+// removeCircleMember must be called with the lock held
+func (s *MemoryStore) removeCircleMember(circleId int, userId int) error {
+	removed := false
+	members := s.circleMembers[:0]
+	for _, member := range s.circleMembers {
+		if member.circleId == circleId && member.userId == userId {
+			removed = true
+			continue
+		}
+		members = append(members, member)
+	}
+	s.circleMembers = members
+	if !removed {
+		return fmt.Errorf("member %d of circle %d: %w", userId, circleId, ErrNotFound)
+	}
+
+	remaining := s.circleMembersOf(circleId)
+	if len(remaining) == 0 {
+		s.deleteCircle(circleId)
+		return nil
+	}
+	for _, member := range remaining {
+		if member.role == models.CircleRoleOwner {
+			return nil
+		}
+	}
+	remaining[0].role = models.CircleRoleOwner
+	return nil
+}
+
+// deleteCircle must be called with the lock held
+func (s *MemoryStore) deleteCircle(circleId int) {
+	invites := s.circleInvites[:0]
+	for _, invite := range s.circleInvites {
+		if invite.CircleID != circleId {
+			invites = append(invites, invite)
+		}
+	}
+	s.circleInvites = invites
+
+	members := s.circleMembers[:0]
+	for _, member := range s.circleMembers {
+		if member.circleId != circleId {
+			members = append(members, member)
+		}
+	}
+	s.circleMembers = members
+	delete(s.circles, circleId)
+}
+
+// leaveCircles must be called with the lock held
+func (s *MemoryStore) leaveCircles(userId int) {
+	var circleIds []int
+	for _, member := range s.circleMembers {
+		if member.userId == userId {
+			circleIds = append(circleIds, member.circleId)
+		}
+	}
+	for _, circleId := range circleIds {
+		_ = s.removeCircleMember(circleId, userId)
+	}
+}
+
+func (s *MemoryStore) RemoveCircleMember(circleId int, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeCircleMember(circleId, userId)
+}
+
+func (s *MemoryStore) DeleteCircle(circleId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteCircle(circleId)
+	return nil
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"sort"
+)
+
+func (s *MemoryStore) CreateDataExport(export models.DataExport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dataExports[export.ID]; ok {
+		return fmt.Errorf("failed to insert data export: %s already exists", export.ID)
+	}
+	export.CreatedAt = s.now()
+	s.dataExports[export.ID] = &export
+	return nil
+}
+
+func (s *MemoryStore) GetDataExport(userId int, exportId string) (models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	export, ok := s.dataExports[exportId]
+	if !ok || export.UserID != userId {
+		return models.DataExport{}, fmt.Errorf("data export %s: %w", exportId, ErrNotFound)
+	}
+	return *export, nil
+}
+
+func (s *MemoryStore) ListDataExports(userId int) ([]models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exports []models.DataExport
+	for _, export := range s.dataExports {
+		if export.UserID == userId {
+			exports = append(exports, *export)
+		}
+	}
+	sort.SliceStable(exports, func(i, j int) bool {
+		return exports[i].CreatedAt.Before(exports[j].CreatedAt)
+	})
+	return exports, nil
+}
+
+func (s *MemoryStore) FinishDataExport(exportId string, status string, filePath string, errorMessage string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	export, ok := s.dataExports[exportId]
+	if !ok || export.Status != models.ExportPending {
+		return fmt.Errorf("pending data export %s: %w", exportId, ErrNotFound)
+	}
+	now := s.now()
+	export.Status = status
+	export.FilePath = filePath
+	export.Error = errorMessage
+	export.CompletedAt = &now
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredDataExports() ([]models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var exports []models.DataExport
+	for id, export := range s.dataExports {
+		if export.ExpiresAt.Before(now) {
+			exports = append(exports, *export)
+			delete(s.dataExports, id)
+		}
+	}
+	return exports, nil
+}
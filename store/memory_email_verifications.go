@@ -0,0 +1,89 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) CreateEmailVerificationToken(token models.EmailVerificationToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.verifications {
+		if existing.TokenHash == token.TokenHash {
+			return fmt.Errorf("failed to insert email verification token: token hash already exists")
+		}
+	}
+	now := s.now()
+	for _, existing := range s.verifications {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+
+	s.nextVerifyId++
+	token.ID = s.nextVerifyId
+	token.CreatedAt = now
+	token.UsedAt = nil
+	s.verifications[token.ID] = &token
+	return nil
+}
+
+func (s *MemoryStore) CountRecentEmailVerifications(userId int, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.now().Add(-window)
+	count := 0
+	for _, token := range s.verifications {
+		if token.UserID == userId && !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) VerifyEmail(tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var token *models.EmailVerificationToken
+	for _, existing := range s.verifications {
+		if existing.TokenHash == tokenHash {
+			token = existing
+		}
+	}
+	if token == nil || token.UsedAt != nil {
+		return 0, fmt.Errorf("email verification token: %w", ErrNotFound)
+	}
+	now := s.now()
+	if now.After(token.ExpiresAt) {
+		return 0, fmt.Errorf("email verification token: %w", ErrExpired)
+	}
+
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return 0, fmt.Errorf("user ID %d: %w", token.UserID, ErrNotFound)
+	}
+	if user.email != token.Email {
+		if other := s.userByEmail(token.Email); other != nil {
+			return 0, ErrEmailExists
+		}
+		user.email = token.Email
+		user.modifiedAt = now
+		for _, reset := range s.passwordResets {
+			if reset.UserID == user.id && reset.UsedAt == nil {
+				reset.UsedAt = &now
+			}
+		}
+	}
+	user.verifiedAt = &now
+
+	for _, existing := range s.verifications {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+	return token.UserID, nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (s *MemoryStore) ReplaceLinkCode(userId int, code uuid.UUID, shortCode string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return time.Time{}, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	for otherUserId, linkCode := range s.linkCodes {
+		if otherUserId == userId {
+			continue
+		}
+		if linkCode.code == code || linkCode.shortCode == shortCode {
+			return time.Time{}, fmt.Errorf("link code of user %d: %w", userId, ErrConflict)
+		}
+	}
+
+	createdAt := s.now()
+	s.linkCodes[userId] = memoryLinkCode{userId: userId, code: code, shortCode: shortCode, createdAt: createdAt}
+	return createdAt, nil
+}
+
+func (s *MemoryStore) GetUserLinkCode(userId int) (models.LinkCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	linkCode, ok := s.linkCodes[userId]
+	if !ok {
+		return models.LinkCode{}, fmt.Errorf("link code of user %d: %w", userId, ErrNotFound)
+	}
+	return models.LinkCode{Code: linkCode.code, ShortCode: linkCode.shortCode, CreatedAt: linkCode.createdAt}, nil
+}
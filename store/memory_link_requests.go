@@ -0,0 +1,127 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (s *MemoryStore) RedeemLinkCode(link models.AccountLink, requesterId int, maxAge time.Duration, requestLifetime time.Duration) (models.LinkRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ownerId, linkCode := range s.linkCodes {
+		matches := linkCode.code == link.PairUUID
+		if link.PairUUID == uuid.Nil {
+			matches = link.PairCode != "" && linkCode.shortCode == link.PairCode
+		}
+		if !matches {
+			continue
+		}
+		now := s.now()
+		if now.Sub(linkCode.createdAt) > maxAge {
+			delete(s.linkCodes, ownerId)
+			return models.LinkRequest{}, fmt.Errorf("link code: %w", ErrExpired)
+		}
+		if ownerId == requesterId {
+			return models.LinkRequest{}, fmt.Errorf("link code of user %d: %w", ownerId, ErrOwnLinkCode)
+		}
+		delete(s.linkCodes, ownerId)
+
+		s.nextRequestId++
+		request := &models.LinkRequest{
+			ID:          s.nextRequestId,
+			OwnerID:     ownerId,
+			RequesterID: requesterId,
+			Status:      models.LinkRequestPending,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(requestLifetime),
+		}
+		s.linkRequests = append(s.linkRequests, request)
+		return *request, nil
+	}
+	return models.LinkRequest{}, fmt.Errorf("link code: %w", ErrNotFound)
+}
+
+func (s *MemoryStore) PendingLinkRequests(userId int) ([]models.LinkRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	requests := []models.LinkRequest{}
+	for _, request := range s.linkRequests {
+		involved := request.OwnerID == userId || request.RequesterID == userId
+		if involved && request.Status == models.LinkRequestPending && request.ExpiresAt.After(now) {
+			requests = append(requests, *request)
+		}
+	}
+	return requests, nil
+}
+
+func (s *MemoryStore) LinkRequestsForUser(userId int) ([]models.LinkRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []models.LinkRequest{}
+	for _, request := range s.linkRequests {
+		if request.OwnerID == userId || request.RequesterID == userId {
+			requests = append(requests, *request)
+		}
+	}
+	return requests, nil
+}
+
+// pendingLinkRequest must be called with the lock held
+func (s *MemoryStore) pendingLinkRequest(requestId int, ownerId int) (*models.LinkRequest, error) {
+	for _, request := range s.linkRequests {
+		if request.ID != requestId || request.OwnerID != ownerId || request.Status != models.LinkRequestPending {
+			continue
+		}
+		if s.now().After(request.ExpiresAt) {
+			return nil, fmt.Errorf("link request %d: %w", requestId, ErrExpired)
+		}
+		return request, nil
+	}
+	return nil, fmt.Errorf("link request %d: %w", requestId, ErrNotFound)
+}
+
+func (s *MemoryStore) AcceptLinkRequest(requestId int, ownerId int) (models.LinkRequest, map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.pendingLinkRequest(requestId, ownerId)
+	if err != nil {
+		return models.LinkRequest{}, nil, err
+	}
+	owner, ok := s.users[request.OwnerID]
+	if !ok {
+		return models.LinkRequest{}, nil, fmt.Errorf("user ID %d: %w", request.OwnerID, ErrNotFound)
+	}
+	requester, ok := s.users[request.RequesterID]
+	if !ok {
+		return models.LinkRequest{}, nil, fmt.Errorf("user ID %d: %w", request.RequesterID, ErrNotFound)
+	}
+
+	now := s.now()
+	request.Status = models.LinkRequestAccepted
+	request.RespondedAt = &now
+	formerPartners := s.linkUsers(owner, requester)
+	delete(s.linkCodes, owner.id)
+	delete(s.linkCodes, requester.id)
+	return *request, formerPartners, nil
+}
+
+func (s *MemoryStore) RejectLinkRequest(requestId int, ownerId int) (models.LinkRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.pendingLinkRequest(requestId, ownerId)
+	if err != nil {
+		return models.LinkRequest{}, err
+	}
+	now := s.now()
+	request.Status = models.LinkRequestRejected
+	request.RespondedAt = &now
+	return *request, nil
+}
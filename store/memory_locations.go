@@ -0,0 +1,161 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// validLocationsNewestFirst must be called with the lock held
+func (s *MemoryStore) validLocationsNewestFirst(userId int) []models.LocationFromDB {
+	var locations []models.LocationFromDB
+	for _, location := range s.locations {
+		if location.UserID == userId && location.IsValid {
+			locations = append(locations, location)
+		}
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].CreatedAt.After(locations[j].CreatedAt)
+	})
+	return locations
+}
+
+func (s *MemoryStore) InsertLocation(userId int, location models.Location, createdAt time.Time, isValid bool, validationReason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextLocationId++
+	s.locations = append(s.locations, models.LocationFromDB{
+		ID:               s.nextLocationId,
+		UserID:           userId,
+		Latitude:         location.Latitude,
+		Longitude:        location.Longitude,
+		Accuracy:         location.Accuracy,
+		Altitude:         location.Altitude,
+		Speed:            location.Speed,
+		Heading:          location.Heading,
+		Source:           location.Source,
+		CreatedAt:        createdAt,
+		IsValid:          isValid,
+		ValidationReason: validationReason,
+	})
+	return nil
+}
+
+func (s *MemoryStore) InsertLocations(userId int, locations []models.LocationFromDB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, location := range locations {
+		s.nextLocationId++
+		location.ID = s.nextLocationId
+		location.UserID = userId
+		s.locations = append(s.locations, location)
+	}
+	return nil
+}
+
+func (s *MemoryStore) LatestValidLocation(userId int) (models.LocationFromDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locations := s.validLocationsNewestFirst(userId)
+	if len(locations) == 0 {
+		return models.LocationFromDB{}, fmt.Errorf("valid location for user ID %d: %w", userId, ErrNotFound)
+	}
+	return locations[0], nil
+}
+
+func (s *MemoryStore) LastValidLocations(userId int, n int) ([]models.LocationFromDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locations := s.validLocationsNewestFirst(userId)
+	if len(locations) > n {
+		locations = locations[:n]
+	}
+	return locations, nil
+}
+
+func (s *MemoryStore) LastValidLocationsUntil(userId int, until time.Time, n int) ([]models.LocationFromDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var locations []models.LocationFromDB
+	for _, location := range s.validLocationsNewestFirst(userId) {
+		if len(locations) == n {
+			break
+		}
+		if !location.CreatedAt.After(until) {
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+func (s *MemoryStore) CountLocations(userId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, location := range s.locations {
+		if location.UserID == userId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) LocationsAfter(userId int, afterId int, limit int) ([]models.LocationFromDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Locations are appended with increasing IDs, so they are already in order
+	var locations []models.LocationFromDB
+	for _, location := range s.locations {
+		if location.UserID == userId && location.ID > afterId {
+			locations = append(locations, location)
+			if len(locations) == limit {
+				break
+			}
+		}
+	}
+	return locations, nil
+}
+
+func (s *MemoryStore) LocationHistory(userId int, query models.LocationQuery) ([]models.LocationFromDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locations := []models.LocationFromDB{}
+	for _, location := range s.locations {
+		if location.UserID != userId || (!location.IsValid && !query.IncludeInvalid) {
+			continue
+		}
+		if !query.From.IsZero() && location.CreatedAt.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !location.CreatedAt.Before(query.To) {
+			continue
+		}
+		if !query.FollowsCursor(location) {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		first, second := locations[i], locations[j]
+		if query.OldestFirst {
+			first, second = second, first
+		}
+		if first.CreatedAt.Equal(second.CreatedAt) {
+			return first.ID > second.ID
+		}
+		return first.CreatedAt.After(second.CreatedAt)
+	})
+	if len(locations) > query.Limit {
+		locations = locations[:query.Limit]
+	}
+	return locations, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+)
+
+// endPartnerLink must be called with the lock held. It returns the ID of the former partner or 0.
+func (s *MemoryStore) endPartnerLink(userId int, endedBy int, reason string) int {
+	user, ok := s.users[userId]
+	if !ok || user.linkedAccount == 0 {
+		return 0
+	}
+	partnerId := user.linkedAccount
+	user.linkedAccount = 0
+	user.sharesTrack = false
+	if partner, ok := s.users[partnerId]; ok && partner.linkedAccount == userId {
+		partner.linkedAccount = 0
+		partner.sharesTrack = false
+	}
+
+	now := s.now()
+	for _, link := range s.partnerLinks {
+		samePair := (link.userId == userId && link.partnerId == partnerId) ||
+			(link.userId == partnerId && link.partnerId == userId)
+		if samePair && link.endedAt == nil {
+			link.endedAt = &now
+			link.endedBy = &endedBy
+			link.endReason = reason
+		}
+	}
+	return partnerId
+}
+
+func (s *MemoryStore) LinkUsers(userId int, partnerId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	partner, ok := s.users[partnerId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", partnerId, ErrNotFound)
+	}
+
+	s.linkUsers(user, partner)
+	return nil
+}
+
+// linkUsers must be called with the lock held. It returns the former partners whose pairing ended, keyed by the user
+// they were linked with.
+func (s *MemoryStore) linkUsers(user *memoryUser, partner *memoryUser) map[int]int {
+	formerPartners := map[int]int{}
+	for _, id := range []int{user.id, partner.id} {
+		formerPartner := s.endPartnerLink(id, user.id, models.LinkEndRelinked)
+		if formerPartner != 0 && formerPartner != user.id && formerPartner != partner.id {
+			formerPartners[id] = formerPartner
+		}
+	}
+	user.linkedAccount = partner.id
+	partner.linkedAccount = user.id
+	s.partnerLinks = append(s.partnerLinks, &memoryPartnerLink{
+		id:        len(s.partnerLinks) + 1,
+		userId:    user.id,
+		partnerId: partner.id,
+		startedAt: s.now(),
+	})
+	return formerPartners
+}
+
+func (s *MemoryStore) UnlinkPartner(userId int, endedBy int, reason string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	partnerId := s.endPartnerLink(userId, endedBy, reason)
+	if partnerId == 0 {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNoPartner)
+	}
+	return partnerId, nil
+}
+
+func (s *MemoryStore) PartnerLinks(userId int) ([]models.PartnerLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := []models.PartnerLink{}
+	for _, link := range s.partnerLinks {
+		if link.userId != userId && link.partnerId != userId {
+			continue
+		}
+		partnerLink := models.PartnerLink{
+			ID:        link.id,
+			PartnerID: link.partnerId,
+			StartedAt: link.startedAt,
+			EndedAt:   link.endedAt,
+			EndedBy:   link.endedBy,
+			EndReason: link.endReason,
+		}
+		if link.partnerId == userId {
+			partnerLink.PartnerID = link.userId
+		}
+		links = append(links, partnerLink)
+	}
+	return links, nil
+}
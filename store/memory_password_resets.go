@@ -0,0 +1,75 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) CreatePasswordResetToken(token models.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.passwordResets {
+		if existing.TokenHash == token.TokenHash {
+			return fmt.Errorf("failed to insert password reset token: token hash already exists")
+		}
+	}
+	s.nextResetId++
+	token.ID = s.nextResetId
+	token.CreatedAt = s.now()
+	token.UsedAt = nil
+	s.passwordResets[token.ID] = &token
+	return nil
+}
+
+func (s *MemoryStore) CountRecentPasswordResets(userId int, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.now().Add(-window)
+	count := 0
+	for _, token := range s.passwordResets {
+		if token.UserID == userId && !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) ResetPassword(tokenHash string, passwordHash []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var token *models.PasswordResetToken
+	for _, existing := range s.passwordResets {
+		if existing.TokenHash == tokenHash {
+			token = existing
+		}
+	}
+	if token == nil || token.UsedAt != nil {
+		return 0, fmt.Errorf("password reset token: %w", ErrNotFound)
+	}
+	now := s.now()
+	if now.After(token.ExpiresAt) {
+		return 0, fmt.Errorf("password reset token: %w", ErrExpired)
+	}
+
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return 0, fmt.Errorf("user ID %d: %w", token.UserID, ErrNotFound)
+	}
+	user.passwordHash = string(passwordHash)
+	user.modifiedAt = now
+	if user.verifiedAt == nil {
+		user.verifiedAt = &now
+	}
+
+	for _, existing := range s.passwordResets {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+	s.revokeUserSessions(token.UserID, "")
+	return token.UserID, nil
+}
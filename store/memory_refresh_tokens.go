@@ -0,0 +1,64 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+)
+
+// insertRefreshToken must be called with the lock held
+func (s *MemoryStore) insertRefreshToken(token models.RefreshToken) (int, error) {
+	for _, existing := range s.refreshTokens {
+		if existing.TokenHash == token.TokenHash {
+			return 0, fmt.Errorf("failed to insert refresh token: token hash already exists")
+		}
+	}
+	s.nextRefreshId++
+	token.ID = s.nextRefreshId
+	token.CreatedAt = s.now()
+	token.RevokedAt = nil
+	token.ReplacedBy = nil
+	s.refreshTokens[token.ID] = &token
+	return token.ID, nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.insertRefreshToken(token)
+	return err
+}
+
+func (s *MemoryStore) GetRefreshToken(tokenHash string) (models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return *token, nil
+		}
+	}
+	return models.RefreshToken{}, fmt.Errorf("refresh token: %w", ErrNotFound)
+}
+
+func (s *MemoryStore) RotateRefreshToken(oldTokenId int, newToken models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldToken, ok := s.refreshTokens[oldTokenId]
+	if !ok {
+		return fmt.Errorf("refresh token %d: %w", oldTokenId, ErrNotFound)
+	}
+	if oldToken.IsRevoked() {
+		return fmt.Errorf("refresh token %d: %w", oldTokenId, ErrRevoked)
+	}
+
+	newTokenId, err := s.insertRefreshToken(newToken)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	oldToken.RevokedAt = &now
+	oldToken.ReplacedBy = &newTokenId
+	return nil
+}
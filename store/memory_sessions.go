@@ -0,0 +1,91 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"sort"
+)
+
+func (s *MemoryStore) CreateSession(session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("failed to insert session: session %s already exists", session.ID)
+	}
+	now := s.now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.RevokedAt = nil
+	s.sessions[session.ID] = &session
+	return nil
+}
+
+func (s *MemoryStore) GetSession(sessionId string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return models.Session{}, fmt.Errorf("session %s: %w", sessionId, ErrNotFound)
+	}
+	return *session, nil
+}
+
+func (s *MemoryStore) ListActiveSessions(userId int) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userId && !session.IsRevoked() {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemoryStore) TouchSession(sessionId string, ipAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[sessionId]; ok && !session.IsRevoked() {
+		session.LastSeenAt = s.now()
+		session.IPAddress = ipAddress
+	}
+	return nil
+}
+
+// revokeUserSessions must be called with the lock held
+func (s *MemoryStore) revokeUserSessions(userId int, exceptSessionId string) {
+	now := s.now()
+	for _, session := range s.sessions {
+		if session.UserID == userId && session.ID != exceptSessionId && !session.IsRevoked() {
+			session.RevokedAt = &now
+		}
+	}
+	for _, token := range s.refreshTokens {
+		if token.UserID == userId && token.FamilyID != exceptSessionId && !token.IsRevoked() {
+			token.RevokedAt = &now
+		}
+	}
+}
+
+func (s *MemoryStore) RevokeSession(sessionId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if session, ok := s.sessions[sessionId]; ok && !session.IsRevoked() {
+		session.RevokedAt = &now
+	}
+	for _, token := range s.refreshTokens {
+		if token.FamilyID == sessionId && !token.IsRevoked() {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
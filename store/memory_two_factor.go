@@ -0,0 +1,103 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) GetTOTP(userId int) (models.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok {
+		return models.TOTP{}, fmt.Errorf("totp of user ID %d: %w", userId, ErrNotFound)
+	}
+	return *totp, nil
+}
+
+func (s *MemoryStore) SaveTOTPSecret(userId int, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.totp[userId]; ok && existing.IsConfirmed() {
+		return nil
+	}
+	s.totp[userId] = &models.TOTP{UserID: userId, Secret: secret, CreatedAt: s.now()}
+	return nil
+}
+
+func (s *MemoryStore) ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok || totp.IsConfirmed() {
+		return fmt.Errorf("unconfirmed totp of user ID %d: %w", userId, ErrNotFound)
+	}
+	now := s.now()
+	totp.ConfirmedAt = &now
+	totp.LastUsedStep = step
+
+	codes := s.recoveryCodes[:0]
+	for _, code := range s.recoveryCodes {
+		if code.userId != userId {
+			codes = append(codes, code)
+		}
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		codes = append(codes, memoryRecoveryCode{userId: userId, codeHash: codeHash})
+	}
+	s.recoveryCodes = codes
+	return nil
+}
+
+func (s *MemoryStore) UseTOTPStep(userId int, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok || !totp.IsConfirmed() || totp.LastUsedStep >= step {
+		return fmt.Errorf("totp step %d: %w", step, ErrAlreadyUsed)
+	}
+	totp.LastUsedStep = step
+	totp.FailedAttempts = 0
+	totp.LastFailedAt = nil
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(userId int, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.recoveryCodes {
+		code := &s.recoveryCodes[i]
+		if code.userId == userId && code.codeHash == codeHash && !code.used {
+			code.used = true
+			if totp, ok := s.totp[userId]; ok {
+				totp.FailedAttempts = 0
+				totp.LastFailedAt = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("recovery code: %w", ErrNotFound)
+}
+
+func (s *MemoryStore) RecordFailedTOTPAttempt(userId int, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok {
+		return 0, fmt.Errorf("totp of user ID %d: %w", userId, ErrNotFound)
+	}
+	now := s.now()
+	if totp.LastFailedAt == nil || totp.LastFailedAt.Before(now.Add(-window)) {
+		totp.FailedAttempts = 0
+	}
+	totp.FailedAttempts++
+	totp.LastFailedAt = &now
+	return totp.FailedAttempts, nil
+}
@@ -0,0 +1,276 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) userByEmail(email string) *memoryUser {
+	for _, user := range s.users {
+		if user.email == email {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateUser(email string, name string, passwordHash []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByEmail(email) != nil {
+		return 0, ErrEmailExists
+	}
+
+	now := s.now()
+	user := &memoryUser{
+		id:           s.nextUserId,
+		email:        email,
+		name:         name,
+		passwordHash: string(passwordHash),
+		createdAt:    now,
+		modifiedAt:   now,
+	}
+	s.users[user.id] = user
+	s.nextUserId++
+	return user.id, nil
+}
+
+func (s *MemoryStore) GetCredentials(email string) (int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByEmail(email)
+	if user == nil {
+		return 0, "", fmt.Errorf("user with email %s: %w", email, ErrNotFound)
+	}
+	return user.id, user.passwordHash, nil
+}
+
+func (s *MemoryStore) GetPasswordHash(userId int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return "", fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return user.passwordHash, nil
+}
+
+func (s *MemoryStore) GetUserIdByEmail(email string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByEmail(email)
+	if user == nil {
+		return 0, fmt.Errorf("user with email %s: %w", email, ErrNotFound)
+	}
+	return user.id, nil
+}
+
+func (s *MemoryStore) GetPartnerId(userId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	if user.linkedAccount == 0 {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNoPartner)
+	}
+	return user.linkedAccount, nil
+}
+
+func (s *MemoryStore) GetUserInformation(userId int) (models.UserInformation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return models.UserInformation{}, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return models.UserInformation{Email: user.email, FirstName: user.name}, nil
+}
+
+func (s *MemoryStore) GetAccount(userId int) (models.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return models.Account{}, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	account := models.Account{
+		ID:              user.id,
+		Email:           user.email,
+		FirstName:       user.name,
+		CreatedAt:       user.createdAt,
+		ModifiedAt:      user.modifiedAt,
+		EmailVerifiedAt: user.verifiedAt,
+		SharesTrack:     user.sharesTrack,
+	}
+	if user.linkedAccount != 0 {
+		linkedAccount := user.linkedAccount
+		account.LinkedAccount = &linkedAccount
+	}
+	return account, nil
+}
+
+func (s *MemoryStore) EmailVerifiedAt(userId int) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return user.verifiedAt, nil
+}
+
+func (s *MemoryStore) UpdateFirstName(userId int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	user.name = name
+	user.modifiedAt = s.now()
+	return nil
+}
+
+func (s *MemoryStore) SetTrackSharing(userId int, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	user.sharesTrack = enabled
+	user.modifiedAt = s.now()
+	return nil
+}
+
+func (s *MemoryStore) SharesTrack(userId int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return false, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return user.sharesTrack, nil
+}
+
+func (s *MemoryStore) ChangePassword(userId int, passwordHash []byte, keepSessionId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	now := s.now()
+	user.passwordHash = string(passwordHash)
+	user.modifiedAt = now
+
+	for _, token := range s.passwordResets {
+		if token.UserID == userId && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	s.revokeUserSessions(userId, keepSessionId)
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(userId int, audit models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+
+	s.endPartnerLink(userId, userId, models.LinkEndAccountDeleted)
+	s.leaveCircles(userId)
+	for _, other := range s.users {
+		if other.linkedAccount == userId {
+			other.linkedAccount = 0
+			other.sharesTrack = false
+		}
+	}
+
+	locations := s.locations[:0]
+	for _, location := range s.locations {
+		if location.UserID != userId {
+			locations = append(locations, location)
+		}
+	}
+	s.locations = locations
+
+	delete(s.linkCodes, userId)
+	invites := s.circleInvites[:0]
+	for _, invite := range s.circleInvites {
+		if invite.CreatedBy != userId {
+			invites = append(invites, invite)
+		}
+	}
+	s.circleInvites = invites
+	for id, token := range s.refreshTokens {
+		if token.UserID == userId {
+			delete(s.refreshTokens, id)
+		}
+	}
+	for id, session := range s.sessions {
+		if session.UserID == userId {
+			delete(s.sessions, id)
+		}
+	}
+	for id, token := range s.passwordResets {
+		if token.UserID == userId {
+			delete(s.passwordResets, id)
+		}
+	}
+	for id, token := range s.verifications {
+		if token.UserID == userId {
+			delete(s.verifications, id)
+		}
+	}
+	recoveryCodes := s.recoveryCodes[:0]
+	for _, code := range s.recoveryCodes {
+		if code.userId != userId {
+			recoveryCodes = append(recoveryCodes, code)
+		}
+	}
+	s.recoveryCodes = recoveryCodes
+	delete(s.totp, userId)
+	linkRequests := s.linkRequests[:0]
+	for _, request := range s.linkRequests {
+		if request.OwnerID != userId && request.RequesterID != userId {
+			linkRequests = append(linkRequests, request)
+		}
+	}
+	s.linkRequests = linkRequests
+	for id, export := range s.dataExports {
+		if export.UserID == userId {
+			delete(s.dataExports, id)
+		}
+	}
+
+	for i := range s.rejectedRequests {
+		if s.rejectedRequests[i].userEmail == user.email {
+			s.rejectedRequests[i].userEmail = "deleted"
+		}
+	}
+
+	audit.UserID = userId
+	s.recordAuditEvent(audit)
+	delete(s.users, userId)
+	return nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"DistanceTrackerServer/database"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLStore implements every store on top of database/sql. Queries are written with '?' placeholders and rebound
+// through the dialect, so the same implementation serves SQLite and PostgreSQL.
+type SQLStore struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func NewSQLStore(dbConn *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{db: dbConn, dialect: dialect}
+}
+
+func NewSQLStores(dbConn *sql.DB, dialect database.Dialect) *Stores {
+	sqlStore := NewSQLStore(dbConn, dialect)
+	return &Stores{
+		Users:              sqlStore,
+		Locations:          sqlStore,
+		LinkCodes:          sqlStore,
+		LinkRequests:       sqlStore,
+		Circles:            sqlStore,
+		Bans:               sqlStore,
+		Refresh:            sqlStore,
+		Sessions:           sqlStore,
+		PasswordResets:     sqlStore,
+		EmailVerifications: sqlStore,
+		TwoFactor:          sqlStore,
+		Audit:              sqlStore,
+		DataExports:        sqlStore,
+	}
+}
+
+func (s *SQLStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.dialect.Rebind(query), args...)
+}
+
+func (s *SQLStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.dialect.Rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.dialect.Rebind(query), args...)
+}
+
+// sqlTx rebinds queries like SQLStore does, but runs them inside a transaction
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect database.Dialect
+}
+
+func (t *sqlTx) exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.Exec(t.dialect.Rebind(query), args...)
+}
+
+func (t *sqlTx) query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.Query(t.dialect.Rebind(query), args...)
+}
+
+func (t *sqlTx) queryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRow(t.dialect.Rebind(query), args...)
+}
+
+// inTransaction runs fn inside a transaction which is committed if fn returns nil and rolled back otherwise
+func (s *SQLStore) inTransaction(fn func(tx *sqlTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err = fn(&sqlTx{tx: tx, dialect: s.dialect}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rollbackErr))
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func closeRows(rows *sql.Rows) {
+	err := rows.Close()
+	if err != nil {
+		fmt.Printf("Error closing rows: %v\n", err)
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"fmt"
+)
+
+func insertAuditEvent(tx *sqlTx, event models.AuditEvent) error {
+	query := `INSERT INTO audit_log (user_id, event, details, ip_address) VALUES (?, ?, ?, ?)`
+	_, err := tx.exec(query, event.UserID, event.Event, event.Details, event.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) RecordAuditEvent(event models.AuditEvent) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		return insertAuditEvent(tx, event)
+	})
+}
+
+func (s *SQLStore) AuditEventsForUser(userId int) ([]models.AuditEvent, error) {
+	query := `SELECT id, event, details, ip_address, created_at FROM audit_log WHERE user_id = ? ORDER BY created_at, id`
+	rows, err := s.query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit events: %w", err)
+	}
+	defer closeRows(rows)
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		event := models.AuditEvent{UserID: userId}
+		if err := rows.Scan(&event.ID, &event.Event, &event.Details, &event.IPAddress, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
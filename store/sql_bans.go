@@ -0,0 +1,86 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) LogRejectedRequest(userEmail string, statusCode int, reason string, ipAddress string) error {
+	loggingQuery := `INSERT INTO rejected_requests(user_email, status_code, reason, ip_address) VALUES (?, ?, ?, ?)`
+	_, err := s.exec(loggingQuery, userEmail, statusCode, reason, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to log rejected request: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CountRecentRejections(ipAddress string, window time.Duration) (int, error) {
+	var count int
+	countRejectionQuery := `SELECT COUNT(*) FROM rejected_requests WHERE ip_address = ? AND created_at >= ` + s.dialect.SecondsFromNow("?")
+	err := s.queryRow(countRejectionQuery, ipAddress, -int(window.Seconds())).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rejected requests for IP %s: %w", ipAddress, err)
+	}
+	return count, nil
+}
+
+func (s *SQLStore) BanIp(ipAddress string, reason string, initialLength time.Duration) (float64, int, error) {
+	// A single upsert keeps concurrent bans of the same IP from different replicas consistent. Column references in
+	// the update refer to the existing row, so the ban length doubles on every repeated ban.
+	var bannedLength float64
+	var bannedTimes int
+	banQuery := `
+		INSERT INTO banned_ips (ip_address, reason, banned_length, banned_until)
+		VALUES (?, ?, ?, ` + s.dialect.SecondsFromNow("?") + `)
+		ON CONFLICT (ip_address) DO UPDATE SET
+			banned_length = banned_ips.banned_length * 2,
+			banned_times = banned_ips.banned_times + 1,
+			last_banned_at = ` + s.dialect.Now() + `,
+			banned_until = ` + s.dialect.SecondsFromNow("banned_ips.banned_length * 2 * 3600") + `,
+			reason = banned_ips.reason || ' | ' || ?
+		RETURNING banned_length, banned_times`
+	err := s.queryRow(banQuery, ipAddress, reason, initialLength.Hours(), int(initialLength.Seconds()), reason).
+		Scan(&bannedLength, &bannedTimes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to ban IP %s: %w", ipAddress, err)
+	}
+	return bannedLength, bannedTimes, nil
+}
+
+func (s *SQLStore) ActiveBanUntil(ipAddress string) (time.Time, error) {
+	var bannedUntil sql.NullTime
+	query := `SELECT banned_until FROM banned_ips WHERE ip_address = ? AND banned_until > ` + s.dialect.Now() + ` LIMIT 1`
+	err := s.queryRow(query, ipAddress).Scan(&bannedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, fmt.Errorf("active ban for IP %s: %w", ipAddress, ErrNotFound)
+		}
+		return time.Time{}, fmt.Errorf("failed to check if IP %s is banned: %w", ipAddress, err)
+	}
+	if !bannedUntil.Valid {
+		return time.Time{}, fmt.Errorf("banned_until field is not valid for IP %s", ipAddress)
+	}
+	return bannedUntil.Time, nil
+}
+
+func (s *SQLStore) RejectedRequestsForEmail(userEmail string) ([]models.RejectedRequest, error) {
+	query := `SELECT status_code, reason, ip_address, created_at FROM rejected_requests WHERE user_email = ? ORDER BY created_at`
+	rows, err := s.query(query, userEmail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve rejected requests: %w", err)
+	}
+	defer closeRows(rows)
+
+	requests := []models.RejectedRequest{}
+	for rows.Next() {
+		var request models.RejectedRequest
+		if err := rows.Scan(&request.StatusCode, &request.Reason, &request.IPAddress, &request.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rejected request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) CreateCircle(name string, ownerId int) (models.Circle, error) {
+	circle := models.Circle{Name: name, Role: models.CircleRoleOwner}
+	err := s.inTransaction(func(tx *sqlTx) error {
+		err := tx.queryRow("INSERT INTO circles (name) VALUES (?) RETURNING id, created_at", name).Scan(&circle.ID, &circle.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert circle: %w", err)
+		}
+
+		_, err = tx.exec("INSERT INTO circle_members (circle_id, user_id, role) VALUES (?, ?, ?)", circle.ID, ownerId, models.CircleRoleOwner)
+		if err != nil {
+			return fmt.Errorf("failed to insert circle owner: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Circle{}, err
+	}
+	return circle, nil
+}
+
+func (s *SQLStore) CirclesForUser(userId int) ([]models.Circle, error) {
+	query := `
+		SELECT c.id, c.name, c.created_at, m.role FROM circles c
+		JOIN circle_members m ON m.circle_id = c.id
+		WHERE m.user_id = ?
+		ORDER BY c.created_at, c.id`
+	rows, err := s.query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve circles: %w", err)
+	}
+	defer closeRows(rows)
+
+	circles := []models.Circle{}
+	for rows.Next() {
+		var circle models.Circle
+		if err := rows.Scan(&circle.ID, &circle.Name, &circle.CreatedAt, &circle.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan circle: %w", err)
+		}
+		circles = append(circles, circle)
+	}
+	return circles, rows.Err()
+}
+
+func (s *SQLStore) GetCircle(circleId int, userId int) (models.Circle, error) {
+	var circle models.Circle
+	query := `
+		SELECT c.id, c.name, c.created_at, m.role FROM circles c
+		JOIN circle_members m ON m.circle_id = c.id
+		WHERE c.id = ? AND m.user_id = ?`
+	err := s.queryRow(query, circleId, userId).Scan(&circle.ID, &circle.Name, &circle.CreatedAt, &circle.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Circle{}, fmt.Errorf("circle %d: %w", circleId, ErrNotFound)
+		}
+		return models.Circle{}, fmt.Errorf("failed to retrieve circle: %w", err)
+	}
+
+	query = `
+		SELECT m.user_id, u.name, m.role, m.joined_at FROM circle_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.circle_id = ?
+		ORDER BY m.joined_at, m.user_id`
+	rows, err := s.query(query, circleId)
+	if err != nil {
+		return models.Circle{}, fmt.Errorf("failed to retrieve circle members: %w", err)
+	}
+	defer closeRows(rows)
+
+	circle.Members = []models.CircleMember{}
+	for rows.Next() {
+		var member models.CircleMember
+		if err := rows.Scan(&member.UserID, &member.FirstName, &member.Role, &member.JoinedAt); err != nil {
+			return models.Circle{}, fmt.Errorf("failed to scan circle member: %w", err)
+		}
+		circle.Members = append(circle.Members, member)
+	}
+	return circle, rows.Err()
+}
+
+func (s *SQLStore) CreateCircleInvite(invite models.CircleInvite) (models.CircleInvite, error) {
+	query := `INSERT INTO circle_invites (circle_id, created_by, short_code, expires_at) VALUES (?, ?, ?, ?)
+		RETURNING id, created_at`
+	err := s.queryRow(query, invite.CircleID, invite.CreatedBy, invite.ShortCode, invite.ExpiresAt.UTC()).
+		Scan(&invite.ID, &invite.CreatedAt)
+	if err != nil {
+		if s.dialect.IsUniqueViolation(err) {
+			return models.CircleInvite{}, fmt.Errorf("circle invite: %w", ErrConflict)
+		}
+		return models.CircleInvite{}, fmt.Errorf("failed to insert circle invite: %w", err)
+	}
+	return invite, nil
+}
+
+func (s *SQLStore) RedeemCircleInvite(shortCode string, userId int, maxMembers int) (models.Circle, error) {
+	var circleId int
+	expired := false
+	err := s.inTransaction(func(tx *sqlTx) error {
+		// Deleting the invite is the first statement, so of two concurrent redemptions only one finds it
+		var expiresAt time.Time
+		query := "DELETE FROM circle_invites WHERE short_code = ? RETURNING circle_id, expires_at"
+		err := tx.queryRow(query, shortCode).Scan(&circleId, &expiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("circle invite: %w", ErrNotFound)
+			}
+			return fmt.Errorf("failed to use up circle invite: %w", err)
+		}
+		if time.Now().After(expiresAt) {
+			// Commit the deletion, expired invites are of no use anymore
+			expired = true
+			return nil
+		}
+
+		// Lock the circle first, so concurrent redemptions count its members one after another instead of all
+		// seeing the last free place
+		err = tx.queryRow("SELECT id FROM circles WHERE id = ?"+tx.dialect.ForUpdate(), circleId).Scan(&circleId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("circle %d: %w", circleId, ErrNotFound)
+			}
+			return fmt.Errorf("failed to lock circle: %w", err)
+		}
+
+		var members int
+		err = tx.queryRow("SELECT COUNT(*) FROM circle_members WHERE circle_id = ?", circleId).Scan(&members)
+		if err != nil {
+			return fmt.Errorf("failed to count circle members: %w", err)
+		}
+		if members >= maxMembers {
+			return fmt.Errorf("circle %d: %w", circleId, ErrCircleFull)
+		}
+
+		_, err = tx.exec("INSERT INTO circle_members (circle_id, user_id, role) VALUES (?, ?, ?)", circleId, userId, models.CircleRoleMember)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return fmt.Errorf("circle %d: %w", circleId, ErrIsMember)
+			}
+			return fmt.Errorf("failed to insert circle member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Circle{}, err
+	}
+	if expired {
+		return models.Circle{}, fmt.Errorf("circle invite: %w", ErrExpired)
+	}
+	return s.GetCircle(circleId, userId)
+}
+
+// removeCircleMember removes the user from the circle, hands the circle over if the last owner left and deletes it
+// once nobody is left
+func removeCircleMember(tx *sqlTx, circleId int, userId int) error {
+	res, err := tx.exec("DELETE FROM circle_members WHERE circle_id = ? AND user_id = ?", circleId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to remove circle member: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check removed circle member: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("member %d of circle %d: %w", userId, circleId, ErrNotFound)
+	}
+
+	var members, owners int
+	query := `SELECT COUNT(*), COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0) FROM circle_members WHERE circle_id = ?`
+	err = tx.queryRow(query, models.CircleRoleOwner, circleId).Scan(&members, &owners)
+	if err != nil {
+		return fmt.Errorf("failed to count circle members: %w", err)
+	}
+	if members == 0 {
+		return deleteCircle(tx, circleId)
+	}
+	if owners > 0 {
+		return nil
+	}
+
+	query = `UPDATE circle_members SET role = ? WHERE circle_id = ? AND user_id = (
+		SELECT user_id FROM circle_members WHERE circle_id = ? ORDER BY joined_at, user_id LIMIT 1)`
+	_, err = tx.exec(query, models.CircleRoleOwner, circleId, circleId)
+	if err != nil {
+		return fmt.Errorf("failed to hand over circle: %w", err)
+	}
+	return nil
+}
+
+func deleteCircle(tx *sqlTx, circleId int) error {
+	deletions := []struct {
+		query       string
+		description string
+	}{
+		{"DELETE FROM circle_invites WHERE circle_id = ?", "delete circle invites"},
+		{"DELETE FROM circle_members WHERE circle_id = ?", "delete circle members"},
+		{"DELETE FROM circles WHERE id = ?", "delete circle"},
+	}
+	for _, deletion := range deletions {
+		if _, err := tx.exec(deletion.query, circleId); err != nil {
+			return fmt.Errorf("failed to %s: %w", deletion.description, err)
+		}
+	}
+	return nil
+}
+
+// leaveCircles removes the user from every circle they are a member of
+func leaveCircles(tx *sqlTx, userId int) error {
+	rows, err := tx.query("SELECT circle_id FROM circle_members WHERE user_id = ?", userId)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve circles: %w", err)
+	}
+	var circleIds []int
+	for rows.Next() {
+		var circleId int
+		if err := rows.Scan(&circleId); err != nil {
+			closeRows(rows)
+			return fmt.Errorf("failed to scan circle: %w", err)
+		}
+		circleIds = append(circleIds, circleId)
+	}
+	closeRows(rows)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to retrieve circles: %w", err)
+	}
+
+	for _, circleId := range circleIds {
+		if err := removeCircleMember(tx, circleId, userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) RemoveCircleMember(circleId int, userId int) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		return removeCircleMember(tx, circleId, userId)
+	})
+}
+
+func (s *SQLStore) DeleteCircle(circleId int) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		return deleteCircle(tx, circleId)
+	})
+}
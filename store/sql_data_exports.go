@@ -0,0 +1,94 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const dataExportColumns = `id, user_id, format, status, file_path, error, created_at, completed_at, expires_at`
+
+func scanDataExport(scanner interface{ Scan(...any) error }) (models.DataExport, error) {
+	var export models.DataExport
+	err := scanner.Scan(&export.ID, &export.UserID, &export.Format, &export.Status, &export.FilePath, &export.Error,
+		&export.CreatedAt, &export.CompletedAt, &export.ExpiresAt)
+	return export, err
+}
+
+func (s *SQLStore) CreateDataExport(export models.DataExport) error {
+	query := `INSERT INTO data_exports (id, user_id, format, status, expires_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.exec(query, export.ID, export.UserID, export.Format, export.Status, export.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert data export: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetDataExport(userId int, exportId string) (models.DataExport, error) {
+	query := `SELECT ` + dataExportColumns + ` FROM data_exports WHERE id = ? AND user_id = ?`
+	export, err := scanDataExport(s.queryRow(query, exportId, userId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DataExport{}, fmt.Errorf("data export %s: %w", exportId, ErrNotFound)
+		}
+		return models.DataExport{}, fmt.Errorf("failed to retrieve data export: %w", err)
+	}
+	return export, nil
+}
+
+func (s *SQLStore) ListDataExports(userId int) ([]models.DataExport, error) {
+	rows, err := s.query(`SELECT `+dataExportColumns+` FROM data_exports WHERE user_id = ? ORDER BY created_at`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve data exports: %w", err)
+	}
+	defer closeRows(rows)
+
+	var exports []models.DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %w", err)
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+func (s *SQLStore) FinishDataExport(exportId string, status string, filePath string, errorMessage string) error {
+	query := `UPDATE data_exports SET status = ?, file_path = ?, error = ?, completed_at = ` + s.dialect.Now() + `
+		WHERE id = ? AND status = ?`
+	result, err := s.exec(query, status, filePath, errorMessage, exportId, models.ExportPending)
+	if err != nil {
+		return fmt.Errorf("failed to update data export: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update data export: %w", err)
+	}
+	if affected == 0 {
+		// The account was deleted while the export was generated
+		return fmt.Errorf("pending data export %s: %w", exportId, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteExpiredDataExports() ([]models.DataExport, error) {
+	query := `DELETE FROM data_exports WHERE expires_at < ? RETURNING ` + dataExportColumns
+	rows, err := s.query(query, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired data exports: %w", err)
+	}
+	defer closeRows(rows)
+
+	var exports []models.DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %w", err)
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) CreateEmailVerificationToken(token models.EmailVerificationToken) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		_, err := tx.exec(`UPDATE email_verification_tokens SET used_at = `+s.dialect.Now()+` WHERE user_id = ? AND used_at IS NULL`, token.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate email verification tokens: %w", err)
+		}
+
+		query := `INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at) VALUES (?, ?, ?, ?)`
+		_, err = tx.exec(query, token.UserID, token.Email, token.TokenHash, token.ExpiresAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert email verification token: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) CountRecentEmailVerifications(userId int, window time.Duration) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM email_verification_tokens WHERE user_id = ? AND created_at >= ?`
+	err := s.queryRow(query, userId, time.Now().Add(-window).UTC()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count email verification tokens: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLStore) VerifyEmail(tokenHash string) (int, error) {
+	var userId int
+	err := s.inTransaction(func(tx *sqlTx) error {
+		var email string
+		var expiresAt time.Time
+		query := `UPDATE email_verification_tokens SET used_at = ` + s.dialect.Now() + ` 
+			WHERE token_hash = ? AND used_at IS NULL RETURNING user_id, email, expires_at`
+		err := tx.queryRow(query, tokenHash).Scan(&userId, &email, &expiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("email verification token: %w", ErrNotFound)
+			}
+			return fmt.Errorf("failed to use email verification token: %w", err)
+		}
+		if time.Now().After(expiresAt) {
+			return fmt.Errorf("email verification token: %w", ErrExpired)
+		}
+
+		var currentEmail string
+		err = tx.queryRow("SELECT email FROM users WHERE id = ?", userId).Scan(&currentEmail)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+			}
+			return fmt.Errorf("failed to query user: %w", err)
+		}
+
+		if currentEmail == email {
+			_, err = tx.exec(`UPDATE users SET email_verified_at = `+s.dialect.Now()+` WHERE id = ?`, userId)
+			if err != nil {
+				return fmt.Errorf("failed to mark email as verified: %w", err)
+			}
+		} else {
+			query := `UPDATE users SET email = ?, email_verified_at = ` + s.dialect.Now() + `, modified_at = ` + s.dialect.Now() + ` WHERE id = ?`
+			_, err = tx.exec(query, email, userId)
+			if err != nil {
+				if s.dialect.IsUniqueViolation(err) {
+					return ErrEmailExists
+				}
+				return fmt.Errorf("failed to change email: %w", err)
+			}
+			_, err = tx.exec(`UPDATE password_reset_tokens SET used_at = `+s.dialect.Now()+` WHERE user_id = ? AND used_at IS NULL`, userId)
+			if err != nil {
+				return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+			}
+		}
+
+		_, err = tx.exec(`UPDATE email_verification_tokens SET used_at = `+s.dialect.Now()+` WHERE user_id = ? AND used_at IS NULL`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate email verification tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (s *SQLStore) ReplaceLinkCode(userId int, code uuid.UUID, shortCode string) (time.Time, error) {
+	// A single upsert, so concurrent requests of the same user cannot both find the old code gone and insert a new one
+	query := `
+		INSERT INTO link_code (user_id, code, short_code) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			code = excluded.code,
+			short_code = excluded.short_code,
+			created_at = ` + s.dialect.Now() + `
+		RETURNING created_at`
+	var createdAt time.Time
+	err := s.queryRow(query, userId, code, shortCode).Scan(&createdAt)
+	if err != nil {
+		if s.dialect.IsUniqueViolation(err) {
+			// The short code belongs to someone else
+			return time.Time{}, fmt.Errorf("link code of user %d: %w", userId, ErrConflict)
+		}
+		return time.Time{}, fmt.Errorf("failed to replace link code: %w", err)
+	}
+	return createdAt, nil
+}
+
+func (s *SQLStore) GetUserLinkCode(userId int) (models.LinkCode, error) {
+	var linkCode models.LinkCode
+	query := "SELECT code, COALESCE(short_code, ''), created_at FROM link_code WHERE user_id = ?"
+	err := s.queryRow(query, userId).Scan(&linkCode.Code, &linkCode.ShortCode, &linkCode.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LinkCode{}, fmt.Errorf("link code of user %d: %w", userId, ErrNotFound)
+		}
+		return models.LinkCode{}, fmt.Errorf("failed to find link code: %w", err)
+	}
+	return linkCode, nil
+}
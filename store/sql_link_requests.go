@@ -0,0 +1,150 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const linkRequestColumns = `id, owner_id, requester_id, status, created_at, expires_at, responded_at`
+
+func scanLinkRequest(scanner interface{ Scan(...any) error }) (models.LinkRequest, error) {
+	var request models.LinkRequest
+	err := scanner.Scan(&request.ID, &request.OwnerID, &request.RequesterID, &request.Status, &request.CreatedAt,
+		&request.ExpiresAt, &request.RespondedAt)
+	return request, err
+}
+
+func (s *SQLStore) RedeemLinkCode(link models.AccountLink, requesterId int, maxAge time.Duration, requestLifetime time.Duration) (models.LinkRequest, error) {
+	var request models.LinkRequest
+	expired := false
+	err := s.inTransaction(func(tx *sqlTx) error {
+		// Deleting the code is the first statement, so of two concurrent redemptions only one finds the code
+		var ownerId int
+		var createdAt time.Time
+		query, code := "DELETE FROM link_code WHERE code = ? RETURNING user_id, created_at", any(link.PairUUID)
+		if link.PairUUID == uuid.Nil {
+			query, code = "DELETE FROM link_code WHERE short_code = ? RETURNING user_id, created_at", link.PairCode
+		}
+		err := tx.queryRow(query, code).Scan(&ownerId, &createdAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("link code: %w", ErrNotFound)
+			}
+			return fmt.Errorf("failed to use up link code: %w", err)
+		}
+		if time.Since(createdAt) > maxAge {
+			// Commit the deletion, expired codes are of no use anymore
+			expired = true
+			return nil
+		}
+		if ownerId == requesterId {
+			return fmt.Errorf("link code of user %d: %w", ownerId, ErrOwnLinkCode)
+		}
+
+		query = `INSERT INTO link_requests (owner_id, requester_id, status, expires_at) VALUES (?, ?, ?, ?)
+			RETURNING ` + linkRequestColumns
+		expiresAt := time.Now().Add(requestLifetime).UTC()
+		request, err = scanLinkRequest(tx.queryRow(query, ownerId, requesterId, models.LinkRequestPending, expiresAt))
+		if err != nil {
+			return fmt.Errorf("failed to insert link request: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.LinkRequest{}, err
+	}
+	if expired {
+		return models.LinkRequest{}, fmt.Errorf("link code: %w", ErrExpired)
+	}
+	return request, nil
+}
+
+func (s *SQLStore) listLinkRequests(query string, args ...any) ([]models.LinkRequest, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve link requests: %w", err)
+	}
+	defer closeRows(rows)
+
+	requests := []models.LinkRequest{}
+	for rows.Next() {
+		request, err := scanLinkRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan link request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+func (s *SQLStore) PendingLinkRequests(userId int) ([]models.LinkRequest, error) {
+	query := `SELECT ` + linkRequestColumns + ` FROM link_requests 
+		WHERE (owner_id = ? OR requester_id = ?) AND status = ? AND expires_at > ?
+		ORDER BY created_at, id`
+	return s.listLinkRequests(query, userId, userId, models.LinkRequestPending, time.Now().UTC())
+}
+
+func (s *SQLStore) LinkRequestsForUser(userId int) ([]models.LinkRequest, error) {
+	query := `SELECT ` + linkRequestColumns + ` FROM link_requests WHERE owner_id = ? OR requester_id = ? ORDER BY created_at, id`
+	return s.listLinkRequests(query, userId, userId)
+}
+
+// answerLinkRequest moves a pending request of the owner to the new status
+func answerLinkRequest(tx *sqlTx, requestId int, ownerId int, status string) (models.LinkRequest, error) {
+	query := `UPDATE link_requests SET status = ?, responded_at = ` + tx.dialect.Now() + ` 
+		WHERE id = ? AND owner_id = ? AND status = ? RETURNING ` + linkRequestColumns
+	request, err := scanLinkRequest(tx.queryRow(query, status, requestId, ownerId, models.LinkRequestPending))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LinkRequest{}, fmt.Errorf("link request %d: %w", requestId, ErrNotFound)
+		}
+		return models.LinkRequest{}, fmt.Errorf("failed to answer link request: %w", err)
+	}
+	if time.Now().After(request.ExpiresAt) {
+		return models.LinkRequest{}, fmt.Errorf("link request %d: %w", requestId, ErrExpired)
+	}
+	return request, nil
+}
+
+func (s *SQLStore) AcceptLinkRequest(requestId int, ownerId int) (models.LinkRequest, map[int]int, error) {
+	var request models.LinkRequest
+	var formerPartners map[int]int
+	err := s.inTransaction(func(tx *sqlTx) error {
+		var err error
+		request, err = answerLinkRequest(tx, requestId, ownerId, models.LinkRequestAccepted)
+		if err != nil {
+			return err
+		}
+		formerPartners, err = linkUsers(tx, ownerId, request.RequesterID)
+		if err != nil {
+			return err
+		}
+		// Neither of them needs their old link codes anymore
+		_, err = tx.exec("DELETE FROM link_code WHERE user_id IN (?, ?)", ownerId, request.RequesterID)
+		if err != nil {
+			return fmt.Errorf("failed to delete link codes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.LinkRequest{}, nil, err
+	}
+	return request, formerPartners, nil
+}
+
+func (s *SQLStore) RejectLinkRequest(requestId int, ownerId int) (models.LinkRequest, error) {
+	var request models.LinkRequest
+	err := s.inTransaction(func(tx *sqlTx) error {
+		var err error
+		request, err = answerLinkRequest(tx, requestId, ownerId, models.LinkRequestRejected)
+		return err
+	})
+	if err != nil {
+		return models.LinkRequest{}, err
+	}
+	return request, nil
+}
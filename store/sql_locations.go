@@ -0,0 +1,201 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	locationColumns = `id, latitude, longitude, accuracy, altitude, speed, heading, source, created_at, is_valid,
+		validation_reason`
+	insertLocationQuery = `
+		INSERT INTO locations (user_id, latitude, longitude, accuracy, altitude, speed, heading, source, created_at,
+			is_valid, validation_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+)
+
+func scanLocation(scanner interface{ Scan(...any) error }, userId int) (models.LocationFromDB, error) {
+	location := models.LocationFromDB{UserID: userId}
+	err := scanner.Scan(&location.ID, &location.Latitude, &location.Longitude, &location.Accuracy, &location.Altitude,
+		&location.Speed, &location.Heading, &location.Source, &location.CreatedAt, &location.IsValid,
+		&location.ValidationReason)
+	return location, err
+}
+
+// insertLocationArgs returns the arguments for insertLocationQuery
+func insertLocationArgs(userId int, location models.Location, createdAt time.Time, isValid bool, validationReason string) []any {
+	return []any{userId, location.Latitude, location.Longitude, location.Accuracy, location.Altitude, location.Speed,
+		location.Heading, location.Source, createdAt.UTC(), isValid, validationReason}
+}
+
+func (s *SQLStore) InsertLocation(userId int, location models.Location, createdAt time.Time, isValid bool, validationReason string) error {
+	_, err := s.exec(insertLocationQuery, insertLocationArgs(userId, location, createdAt, isValid, validationReason)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert location into database: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) InsertLocations(userId int, locations []models.LocationFromDB) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		for _, location := range locations {
+			args := insertLocationArgs(userId, location.ToLocation(), location.CreatedAt, location.IsValid,
+				location.ValidationReason)
+			_, err := tx.exec(insertLocationQuery, args...)
+			if err != nil {
+				return fmt.Errorf("failed to insert location into database: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) LatestValidLocation(userId int) (models.LocationFromDB, error) {
+	query := `
+		SELECT ` + locationColumns + ` FROM locations 
+		WHERE user_id = ? AND is_valid = TRUE
+		ORDER BY created_at DESC 
+		LIMIT 1`
+
+	location, err := scanLocation(s.queryRow(query, userId), userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LocationFromDB{}, fmt.Errorf("valid location for user ID %d: %w", userId, ErrNotFound)
+		}
+		return models.LocationFromDB{}, fmt.Errorf("failed to scan location: %w", err)
+	}
+	return location, nil
+}
+
+func (s *SQLStore) LastValidLocations(userId int, n int) ([]models.LocationFromDB, error) {
+	query := `
+		SELECT ` + locationColumns + ` FROM locations 
+        WHERE user_id = ? AND is_valid = TRUE
+        ORDER BY created_at DESC 
+        LIMIT ?`
+	rows, err := s.query(query, userId, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last %d locations for user %d: %w", n, userId, err)
+	}
+	defer closeRows(rows)
+
+	var locations []models.LocationFromDB
+	for rows.Next() {
+		loc, err := scanLocation(rows, userId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, rows.Err()
+}
+
+func (s *SQLStore) LastValidLocationsUntil(userId int, until time.Time, n int) ([]models.LocationFromDB, error) {
+	query := `
+		SELECT ` + locationColumns + ` FROM locations
+		WHERE user_id = ? AND is_valid = TRUE AND created_at <= ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`
+	rows, err := s.query(query, userId, until.UTC(), n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last %d locations until %s for user %d: %w", n, until, userId, err)
+	}
+	defer closeRows(rows)
+
+	var locations []models.LocationFromDB
+	for rows.Next() {
+		loc, err := scanLocation(rows, userId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
+
+func (s *SQLStore) CountLocations(userId int) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM locations WHERE user_id = ?", userId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count locations for user %d: %w", userId, err)
+	}
+	return count, nil
+}
+
+func (s *SQLStore) LocationsAfter(userId int, afterId int, limit int) ([]models.LocationFromDB, error) {
+	query := `
+		SELECT ` + locationColumns + ` FROM locations
+		WHERE user_id = ? AND id > ?
+		ORDER BY id
+		LIMIT ?`
+	rows, err := s.query(query, userId, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve locations for user %d: %w", userId, err)
+	}
+	defer closeRows(rows)
+
+	var locations []models.LocationFromDB
+	for rows.Next() {
+		loc, err := scanLocation(rows, userId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, rows.Err()
+}
+
+func (s *SQLStore) LocationHistory(userId int, query models.LocationQuery) ([]models.LocationFromDB, error) {
+	createdAt, at := s.dialect.Timestamp("created_at"), s.dialect.Timestamp("?")
+	conditions := []string{"user_id = ?"}
+	args := []any{userId}
+	if !query.IncludeInvalid {
+		conditions = append(conditions, "is_valid = TRUE")
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, createdAt+" >= "+at)
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, createdAt+" < "+at)
+		args = append(args, query.To.UTC())
+	}
+	order, comparison := "DESC", "<"
+	if query.OldestFirst {
+		order, comparison = "ASC", ">"
+	}
+	if query.Cursor != nil {
+		conditions = append(conditions, "("+createdAt+" "+comparison+" "+at+" OR ("+createdAt+" = "+at+" AND id "+
+			comparison+" ?))")
+		args = append(args, query.Cursor.CreatedAt.UTC(), query.Cursor.CreatedAt.UTC(), query.Cursor.ID)
+	}
+	args = append(args, query.Limit)
+
+	statement := `
+		SELECT ` + locationColumns + ` FROM locations
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + createdAt + ` ` + order + `, id ` + order + `
+		LIMIT ?`
+	rows, err := s.query(statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve location history for user %d: %w", userId, err)
+	}
+	defer closeRows(rows)
+
+	locations := []models.LocationFromDB{}
+	for rows.Next() {
+		loc, err := scanLocation(rows, userId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, rows.Err()
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// endPartnerLink unlinks the user and their partner and ends the pairing in the link history. It returns the ID of
+// the former partner or ErrNoPartner.
+func endPartnerLink(tx *sqlTx, userId int, endedBy int, reason string) (int, error) {
+	var partnerId *int
+	err := tx.queryRow("SELECT linked_account FROM users WHERE id = ?", userId).Scan(&partnerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to query partner ID by user ID: %w", err)
+	}
+	if partnerId == nil {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNoPartner)
+	}
+
+	// Only unlink the pairing we read, if a concurrent transaction changed it in the meantime we must not touch it
+	query := `UPDATE users SET linked_account = NULL, share_track = FALSE
+		WHERE (id = ? AND linked_account = ?) OR (id = ? AND linked_account = ?)`
+	res, err := tx.exec(query, userId, *partnerId, *partnerId, userId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove linked account: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check removed linked account: %w", err)
+	}
+	if affected == 0 {
+		return 0, fmt.Errorf("unlink user ID %d: %w", userId, ErrConflict)
+	}
+
+	query = `UPDATE partner_links SET ended_at = ` + tx.dialect.Now() + `, ended_by = ?, end_reason = ?
+		WHERE ended_at IS NULL AND ((user_id = ? AND partner_id = ?) OR (user_id = ? AND partner_id = ?))`
+	_, err = tx.exec(query, endedBy, reason, userId, *partnerId, *partnerId, userId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to end partner link: %w", err)
+	}
+	return *partnerId, nil
+}
+
+// linkUsers ends the previous pairings of both users, links them and starts a new entry in the link history. It
+// returns the former partners whose pairing ended, keyed by the user they were linked with.
+func linkUsers(tx *sqlTx, userId int, partnerId int) (map[int]int, error) {
+	formerPartners := map[int]int{}
+	for _, id := range []int{userId, partnerId} {
+		formerPartner, err := endPartnerLink(tx, id, userId, models.LinkEndRelinked)
+		if err != nil && !errors.Is(err, ErrNoPartner) {
+			return nil, err
+		}
+		if err == nil && formerPartner != userId && formerPartner != partnerId {
+			formerPartners[id] = formerPartner
+		}
+	}
+
+	// Both users are unlinked now. If a concurrent transaction linked one of them in the meantime the update skips
+	// that row and we give up instead of overwriting the other pairing, the unique index on linked_account does the
+	// same for anyone pointing at them.
+	query := `UPDATE users SET linked_account = CASE WHEN id = ? THEN ? ELSE ? END
+		WHERE id IN (?, ?) AND linked_account IS NULL`
+	res, err := tx.exec(query, userId, partnerId, userId, userId, partnerId)
+	if err != nil {
+		if tx.dialect.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("link user ID %d with %d: %w", userId, partnerId, ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to link accounts: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check linked accounts: %w", err)
+	}
+	if affected != 2 {
+		return nil, fmt.Errorf("link user ID %d with %d: %w", userId, partnerId, ErrConflict)
+	}
+
+	_, err = tx.exec(`INSERT INTO partner_links (user_id, partner_id) VALUES (?, ?)`, userId, partnerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record partner link: %w", err)
+	}
+	return formerPartners, nil
+}
+
+func (s *SQLStore) LinkUsers(userId int, partnerId int) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		_, err := linkUsers(tx, userId, partnerId)
+		return err
+	})
+}
+
+func (s *SQLStore) UnlinkPartner(userId int, endedBy int, reason string) (int, error) {
+	var partnerId int
+	err := s.inTransaction(func(tx *sqlTx) error {
+		var err error
+		partnerId, err = endPartnerLink(tx, userId, endedBy, reason)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return partnerId, nil
+}
+
+func (s *SQLStore) PartnerLinks(userId int) ([]models.PartnerLink, error) {
+	query := `
+		SELECT id, user_id, partner_id, started_at, ended_at, ended_by, end_reason FROM partner_links
+		WHERE user_id = ? OR partner_id = ?
+		ORDER BY started_at, id`
+	rows, err := s.query(query, userId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve partner links: %w", err)
+	}
+	defer closeRows(rows)
+
+	links := []models.PartnerLink{}
+	for rows.Next() {
+		var link models.PartnerLink
+		var firstUserId int
+		err := rows.Scan(&link.ID, &firstUserId, &link.PartnerID, &link.StartedAt, &link.EndedAt, &link.EndedBy, &link.EndReason)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan partner link: %w", err)
+		}
+		if link.PartnerID == userId {
+			link.PartnerID = firstUserId
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
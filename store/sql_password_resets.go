@@ -0,0 +1,66 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) CreatePasswordResetToken(token models.PasswordResetToken) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, ip_address, expires_at) VALUES (?, ?, ?, ?)`
+	_, err := s.exec(query, token.UserID, token.TokenHash, token.IPAddress, token.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CountRecentPasswordResets(userId int, window time.Duration) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM password_reset_tokens WHERE user_id = ? AND created_at >= ?`
+	err := s.queryRow(query, userId, time.Now().Add(-window).UTC()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLStore) ResetPassword(tokenHash string, passwordHash []byte) (int, error) {
+	var userId int
+	err := s.inTransaction(func(tx *sqlTx) error {
+		// Marking the token as used first means two concurrent resets with the same token cannot both succeed
+		var expiresAt time.Time
+		query := `UPDATE password_reset_tokens SET used_at = ` + s.dialect.Now() + ` 
+			WHERE token_hash = ? AND used_at IS NULL RETURNING user_id, expires_at`
+		err := tx.queryRow(query, tokenHash).Scan(&userId, &expiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("password reset token: %w", ErrNotFound)
+			}
+			return fmt.Errorf("failed to use password reset token: %w", err)
+		}
+		if time.Now().After(expiresAt) {
+			return fmt.Errorf("password reset token: %w", ErrExpired)
+		}
+
+		// The reset token was mailed to the user, so using it proves they own the email as well
+		_, err = tx.exec(`UPDATE users SET password = ?, modified_at = `+s.dialect.Now()+`, 
+			email_verified_at = COALESCE(email_verified_at, `+s.dialect.Now()+`) WHERE id = ?`, string(passwordHash), userId)
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		_, err = tx.exec(`UPDATE password_reset_tokens SET used_at = `+s.dialect.Now()+` WHERE user_id = ? AND used_at IS NULL`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+		}
+
+		return revokeUserSessions(tx, userId, "")
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
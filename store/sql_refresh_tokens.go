@@ -0,0 +1,64 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (s *SQLStore) CreateRefreshToken(token models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)`
+	_, err := s.exec(query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetRefreshToken(tokenHash string) (models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, replaced_by 
+		FROM refresh_tokens WHERE token_hash = ?`
+
+	var token models.RefreshToken
+	err := s.queryRow(query, tokenHash).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.RevokedAt, &token.ReplacedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("refresh token: %w", ErrNotFound)
+		}
+		return models.RefreshToken{}, fmt.Errorf("failed to retrieve refresh token: %w", err)
+	}
+	return token, nil
+}
+
+func (s *SQLStore) RotateRefreshToken(oldTokenId int, newToken models.RefreshToken) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		// Revoking first means two concurrent rotations of the same token cannot both succeed
+		res, err := tx.exec(`UPDATE refresh_tokens SET revoked_at = `+s.dialect.Now()+` WHERE id = ? AND revoked_at IS NULL`, oldTokenId)
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh token: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check revoked refresh token: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("refresh token %d: %w", oldTokenId, ErrRevoked)
+		}
+
+		var newTokenId int
+		insertQuery := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?) RETURNING id`
+		err = tx.queryRow(insertQuery, newToken.UserID, newToken.FamilyID, newToken.TokenHash, newToken.ExpiresAt.UTC()).Scan(&newTokenId)
+		if err != nil {
+			return fmt.Errorf("failed to insert rotated refresh token: %w", err)
+		}
+
+		_, err = tx.exec(`UPDATE refresh_tokens SET replaced_by = ? WHERE id = ?`, newTokenId, oldTokenId)
+		if err != nil {
+			return fmt.Errorf("failed to link rotated refresh token: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (s *SQLStore) CreateSession(session models.Session) error {
+	query := `INSERT INTO sessions (id, user_id, device_name, user_agent, ip_address) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.exec(query, session.ID, session.UserID, session.DeviceName, session.UserAgent, session.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetSession(sessionId string) (models.Session, error) {
+	query := `
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_seen_at, revoked_at 
+		FROM sessions WHERE id = ?`
+
+	var session models.Session
+	err := s.queryRow(query, sessionId).Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent,
+		&session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("session %s: %w", sessionId, ErrNotFound)
+		}
+		return models.Session{}, fmt.Errorf("failed to retrieve session: %w", err)
+	}
+	return session, nil
+}
+
+func (s *SQLStore) ListActiveSessions(userId int) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_seen_at 
+		FROM sessions WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC`
+	rows, err := s.query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve sessions for user %d: %w", userId, err)
+	}
+	defer closeRows(rows)
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLStore) TouchSession(sessionId string, ipAddress string) error {
+	query := `UPDATE sessions SET last_seen_at = ` + s.dialect.Now() + `, ip_address = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := s.exec(query, ipAddress, sessionId)
+	if err != nil {
+		return fmt.Errorf("failed to update session last seen: %w", err)
+	}
+	return nil
+}
+
+// revokeUserSessions revokes every session of the user together with their refresh tokens. The session exceptSessionId
+// is kept, pass an empty string to revoke all of them.
+func revokeUserSessions(tx *sqlTx, userId int, exceptSessionId string) error {
+	query := `UPDATE sessions SET revoked_at = ` + tx.dialect.Now() + ` WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`
+	_, err := tx.exec(query, userId, exceptSessionId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions of user %d: %w", userId, err)
+	}
+	query = `UPDATE refresh_tokens SET revoked_at = ` + tx.dialect.Now() + ` WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL`
+	_, err = tx.exec(query, userId, exceptSessionId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens of user %d: %w", userId, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) RevokeSession(sessionId string) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		_, err := tx.exec(`UPDATE sessions SET revoked_at = `+s.dialect.Now()+` WHERE id = ? AND revoked_at IS NULL`, sessionId)
+		if err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+		_, err = tx.exec(`UPDATE refresh_tokens SET revoked_at = `+s.dialect.Now()+` WHERE family_id = ? AND revoked_at IS NULL`, sessionId)
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens of session: %w", err)
+		}
+		return nil
+	})
+}
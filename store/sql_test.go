@@ -0,0 +1,544 @@
+package store
+
+import (
+	"DistanceTrackerServer/database"
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postgresPlaceholders runs on SQLite but rebinds queries the way Postgres does, so the $1, $2, ... code path of
+// every query is exercised without a Postgres server. SQLite reads $1 as a named parameter, which the driver binds by
+// position like Postgres.
+type postgresPlaceholders struct {
+	database.SQLite
+}
+
+func (postgresPlaceholders) Rebind(query string) string {
+	return database.Postgres{}.Rebind(query)
+}
+
+var testDialects = map[string]database.Dialect{
+	"sqlite":               database.SQLite{},
+	"postgresPlaceholders": postgresPlaceholders{},
+}
+
+// newTestSQLStore returns a store on a fresh, fully migrated SQLite database
+func newTestSQLStore(t *testing.T, dialect database.Dialect) *SQLStore {
+	t.Helper()
+	dbConn, err := sql.Open(database.SQLiteDriver, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = dbConn.Close()
+	})
+	if _, err := database.MigrateUp(dbConn, dialect); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return NewSQLStore(dbConn, dialect)
+}
+
+// forEachDialect runs the test once for every dialect code path on its own database
+func forEachDialect(t *testing.T, test func(t *testing.T, s *SQLStore)) {
+	for name, dialect := range testDialects {
+		t.Run(name, func(t *testing.T) {
+			test(t, newTestSQLStore(t, dialect))
+		})
+	}
+}
+
+func createTestUser(t *testing.T, s *SQLStore, email string) int {
+	t.Helper()
+	userId, err := s.CreateUser(email, "Test", []byte("hash"))
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", email, err)
+	}
+	return userId
+}
+
+func TestSQLCreateUserRejectsDuplicateEmail(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		userId := createTestUser(t, s, "alice@example.com")
+
+		_, err := s.CreateUser("alice@example.com", "Other", []byte("hash"))
+		if !errors.Is(err, ErrEmailExists) {
+			t.Fatalf("expected ErrEmailExists, got %v", err)
+		}
+
+		id, _, err := s.GetCredentials("alice@example.com")
+		if err != nil || id != userId {
+			t.Errorf("expected the first user to keep the email, got %d (%v)", id, err)
+		}
+	})
+}
+
+func TestSQLBans(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		for i := 0; i < 3; i++ {
+			if err := s.LogRejectedRequest("alice@example.com", 401, "wrong password", "10.0.0.1"); err != nil {
+				t.Fatalf("failed to log rejected request: %v", err)
+			}
+		}
+		count, err := s.CountRecentRejections("10.0.0.1", time.Hour)
+		if err != nil || count != 3 {
+			t.Fatalf("expected 3 recent rejections, got %d (%v)", count, err)
+		}
+		count, err = s.CountRecentRejections("10.0.0.2", time.Hour)
+		if err != nil || count != 0 {
+			t.Fatalf("expected no rejections for another IP, got %d (%v)", count, err)
+		}
+
+		if _, err := s.ActiveBanUntil("10.0.0.1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected no active ban yet, got %v", err)
+		}
+
+		length, times, err := s.BanIp("10.0.0.1", "first", 15*time.Minute)
+		if err != nil || length != 0.25 || times != 1 {
+			t.Fatalf("expected a first ban of 0.25 hours, got %v hours, %d times (%v)", length, times, err)
+		}
+		until, err := s.ActiveBanUntil("10.0.0.1")
+		if err != nil {
+			t.Fatalf("expected an active ban: %v", err)
+		}
+		if remaining := time.Until(until); remaining < 14*time.Minute || remaining > 16*time.Minute {
+			t.Errorf("expected the ban to last about 15 minutes, it ends in %s", remaining)
+		}
+
+		// Repeated bans double the length, the upsert refers to the existing row
+		length, times, err = s.BanIp("10.0.0.1", "second", 15*time.Minute)
+		if err != nil || length != 0.5 || times != 2 {
+			t.Fatalf("expected a second ban of 0.5 hours, got %v hours, %d times (%v)", length, times, err)
+		}
+		until, err = s.ActiveBanUntil("10.0.0.1")
+		if err != nil {
+			t.Fatalf("expected an active ban: %v", err)
+		}
+		if remaining := time.Until(until); remaining < 29*time.Minute || remaining > 31*time.Minute {
+			t.Errorf("expected the doubled ban to last about 30 minutes, it ends in %s", remaining)
+		}
+	})
+}
+
+func TestSQLReplaceLinkCode(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+
+		code := uuid.New()
+		if _, err := s.ReplaceLinkCode(alice, code, "ABCD2345"); err != nil {
+			t.Fatalf("failed to create link code: %v", err)
+		}
+		linkCode, err := s.GetUserLinkCode(alice)
+		if err != nil || linkCode.Code != code || linkCode.ShortCode != "ABCD2345" {
+			t.Fatalf("expected the new link code, got %+v (%v)", linkCode, err)
+		}
+
+		// Short codes are unique across users
+		if _, err := s.ReplaceLinkCode(bob, uuid.New(), "ABCD2345"); !errors.Is(err, ErrConflict) {
+			t.Fatalf("expected ErrConflict for a taken short code, got %v", err)
+		}
+		if _, err := s.GetUserLinkCode(bob); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the conflicting code to be rolled back, got %v", err)
+		}
+	})
+}
+
+func TestSQLReplaceLinkCodeKeepsPairing(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+		if err := s.LinkUsers(alice, bob); err != nil {
+			t.Fatalf("failed to link users: %v", err)
+		}
+
+		// Every concurrent replacement succeeds and the last one wins
+		const replacements = 8
+		errs := make([]error, replacements)
+		var wg sync.WaitGroup
+		for i := 0; i < replacements; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = s.ReplaceLinkCode(alice, uuid.New(), "CODE"+strconv.Itoa(1000+i))
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("replacement %d failed: %v", i, err)
+			}
+		}
+		if _, err := s.GetUserLinkCode(alice); err != nil {
+			t.Errorf("expected a link code, got %v", err)
+		}
+
+		if partnerId, err := s.GetPartnerId(alice); err != nil || partnerId != bob {
+			t.Errorf("expected alice to stay linked with bob, got %d (%v)", partnerId, err)
+		}
+		links, err := s.PartnerLinks(alice)
+		if err != nil || len(links) != 1 || links[0].EndedAt != nil {
+			t.Errorf("expected the pairing to stay open, got %+v (%v)", links, err)
+		}
+	})
+}
+
+func TestSQLRedeemLinkCode(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+		carol := createTestUser(t, s, "carol@example.com")
+		code := uuid.New()
+		if _, err := s.ReplaceLinkCode(alice, code, "ABCD2345"); err != nil {
+			t.Fatalf("failed to create link code: %v", err)
+		}
+
+		_, err := s.RedeemLinkCode(models.AccountLink{PairUUID: code}, alice, time.Hour, time.Hour)
+		if !errors.Is(err, ErrOwnLinkCode) {
+			t.Fatalf("expected ErrOwnLinkCode, got %v", err)
+		}
+
+		request, err := s.RedeemLinkCode(models.AccountLink{PairCode: "ABCD2345"}, bob, time.Hour, time.Hour)
+		if err != nil {
+			t.Fatalf("failed to redeem link code: %v", err)
+		}
+		if request.OwnerID != alice || request.RequesterID != bob || request.Status != models.LinkRequestPending {
+			t.Errorf("expected a pending request of bob to alice, got %+v", request)
+		}
+
+		_, err = s.RedeemLinkCode(models.AccountLink{PairUUID: code}, carol, time.Hour, time.Hour)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected a redeemed code to be gone, got %v", err)
+		}
+
+		// Expired codes are used up as well
+		if _, err := s.ReplaceLinkCode(carol, uuid.New(), "EFGH2345"); err != nil {
+			t.Fatalf("failed to create link code: %v", err)
+		}
+		_, err = s.RedeemLinkCode(models.AccountLink{PairCode: "EFGH2345"}, bob, -time.Second, time.Hour)
+		if !errors.Is(err, ErrExpired) {
+			t.Fatalf("expected ErrExpired, got %v", err)
+		}
+		_, err = s.RedeemLinkCode(models.AccountLink{PairCode: "EFGH2345"}, bob, time.Hour, time.Hour)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected an expired code to be used up, got %v", err)
+		}
+	})
+}
+
+func TestSQLLinkAndUnlinkUsers(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+
+		if err := s.LinkUsers(alice, bob); err != nil {
+			t.Fatalf("failed to link users: %v", err)
+		}
+		partnerId, err := s.GetPartnerId(bob)
+		if err != nil || partnerId != alice {
+			t.Fatalf("expected bob to be linked with alice, got %d (%v)", partnerId, err)
+		}
+
+		partnerId, err = s.UnlinkPartner(bob, bob, models.LinkEndUnlinked)
+		if err != nil || partnerId != alice {
+			t.Fatalf("expected to unlink alice, got %d (%v)", partnerId, err)
+		}
+		if _, err := s.GetPartnerId(alice); !errors.Is(err, ErrNoPartner) {
+			t.Errorf("expected alice to be unlinked, got %v", err)
+		}
+		if _, err := s.UnlinkPartner(bob, bob, models.LinkEndUnlinked); !errors.Is(err, ErrNoPartner) {
+			t.Errorf("expected ErrNoPartner when unlinking twice, got %v", err)
+		}
+
+		links, err := s.PartnerLinks(alice)
+		if err != nil || len(links) != 1 {
+			t.Fatalf("expected one pairing in the history, got %d (%v)", len(links), err)
+		}
+		if links[0].PartnerID != bob || links[0].EndedAt == nil || links[0].EndReason != models.LinkEndUnlinked {
+			t.Errorf("expected the pairing with bob to be ended, got %+v", links[0])
+		}
+	})
+}
+
+func TestSQLAcceptLinkRequestReturnsFormerPartners(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+		carol := createTestUser(t, s, "carol@example.com")
+		if err := s.LinkUsers(bob, carol); err != nil {
+			t.Fatalf("failed to link users: %v", err)
+		}
+		if _, err := s.ReplaceLinkCode(alice, uuid.New(), "ABCD2345"); err != nil {
+			t.Fatalf("failed to create link code: %v", err)
+		}
+		request, err := s.RedeemLinkCode(models.AccountLink{PairCode: "ABCD2345"}, bob, time.Hour, time.Hour)
+		if err != nil {
+			t.Fatalf("failed to redeem link code: %v", err)
+		}
+
+		_, formerPartners, err := s.AcceptLinkRequest(request.ID, alice)
+		if err != nil {
+			t.Fatalf("failed to accept link request: %v", err)
+		}
+		if len(formerPartners) != 1 || formerPartners[bob] != carol {
+			t.Errorf("expected carol as the former partner of bob, got %v", formerPartners)
+		}
+		if _, err := s.GetPartnerId(carol); !errors.Is(err, ErrNoPartner) {
+			t.Errorf("expected carol to be unlinked, got %v", err)
+		}
+	})
+}
+
+func TestSQLLocationHistory(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			location := models.Location{Latitude: 48 + float64(i)/100, Longitude: 11}
+			valid, reason := i != 2, ""
+			if !valid {
+				reason = "speed: too fast"
+			}
+			if err := s.InsertLocation(alice, location, start.Add(time.Duration(i)*time.Minute), valid, reason); err != nil {
+				t.Fatalf("failed to insert location: %v", err)
+			}
+		}
+
+		history, err := s.LocationHistory(alice, models.LocationQuery{Limit: 10})
+		if err != nil || len(history) != 4 {
+			t.Fatalf("expected the 4 valid locations, got %d (%v)", len(history), err)
+		}
+		if !history[0].CreatedAt.Equal(start.Add(4 * time.Minute)) {
+			t.Errorf("expected the newest location first, got %s", history[0].CreatedAt)
+		}
+
+		history, err = s.LocationHistory(alice, models.LocationQuery{IncludeInvalid: true, Limit: 10})
+		if err != nil || len(history) != 5 {
+			t.Fatalf("expected all 5 locations, got %d (%v)", len(history), err)
+		}
+		if history[2].IsValid || history[2].ValidationReason != "speed: too fast" {
+			t.Errorf("expected the invalid location with its reason, got %+v", history[2])
+		}
+
+		query := models.LocationQuery{
+			From:        start.Add(time.Minute),
+			To:          start.Add(4 * time.Minute),
+			OldestFirst: true,
+			Limit:       10,
+		}
+		history, err = s.LocationHistory(alice, query)
+		if err != nil || len(history) != 2 {
+			t.Fatalf("expected 2 valid locations in the range, got %d (%v)", len(history), err)
+		}
+		if !history[0].CreatedAt.Equal(start.Add(time.Minute)) || !history[1].CreatedAt.Equal(start.Add(3*time.Minute)) {
+			t.Errorf("expected the range to include from and exclude to, got %s and %s", history[0].CreatedAt,
+				history[1].CreatedAt)
+		}
+
+		query = models.LocationQuery{IncludeInvalid: true, Limit: 2}
+		query.Cursor = &models.LocationCursor{CreatedAt: start.Add(3 * time.Minute), ID: 4}
+		history, err = s.LocationHistory(alice, query)
+		if err != nil || len(history) != 2 {
+			t.Fatalf("expected a page of 2 locations after the cursor, got %d (%v)", len(history), err)
+		}
+		if history[0].ID != 3 || history[1].ID != 2 {
+			t.Errorf("expected locations 3 and 2 after the cursor, got %d and %d", history[0].ID, history[1].ID)
+		}
+	})
+}
+
+func TestSQLLocationHistoryPagesThroughLegacyTimestamps(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		noon := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+		// Older versions and CURRENT_TIMESTAMP stored other formats than the driver does, as text they sort apart
+		// from the same time written by the driver
+		for _, createdAt := range []string{
+			"2025-06-01 12:00:00",
+			"2025-06-01T12:00:00Z",
+			"2025-06-01 13:00:00+01:00",
+			"2025-06-01T11:59:59Z",
+			"2025-06-01 12:00:00.5",
+		} {
+			_, err := s.exec(`INSERT INTO locations (user_id, latitude, longitude, created_at, is_valid)
+				VALUES (?, 48, 11, ?, TRUE)`, alice, createdAt)
+			if err != nil {
+				t.Fatalf("failed to insert location at %s: %v", createdAt, err)
+			}
+		}
+		for _, createdAt := range []time.Time{noon, noon, noon.Add(-time.Second), noon.Add(time.Second)} {
+			if err := s.InsertLocation(alice, models.Location{Latitude: 48, Longitude: 11}, createdAt, true, ""); err != nil {
+				t.Fatalf("failed to insert location: %v", err)
+			}
+		}
+
+		// By time, then by ID: 11:59:59 (4, 8), 12:00:00 (1, 2, 3, 6, 7), 12:00:00.5 (5), 12:00:01 (9)
+		oldestFirst := []int{4, 8, 1, 2, 3, 6, 7, 5, 9}
+		for _, reversed := range []bool{false, true} {
+			expected := make([]int, len(oldestFirst))
+			for i, id := range oldestFirst {
+				if reversed {
+					i = len(oldestFirst) - 1 - i
+				}
+				expected[i] = id
+			}
+
+			var ids []int
+			query := models.LocationQuery{OldestFirst: !reversed, Limit: 2}
+			for page := 0; page < len(expected); page++ {
+				history, err := s.LocationHistory(alice, query)
+				if err != nil {
+					t.Fatalf("failed to retrieve location history: %v", err)
+				}
+				if len(history) == 0 {
+					break
+				}
+				for _, location := range history {
+					ids = append(ids, location.ID)
+				}
+				last := history[len(history)-1]
+				query.Cursor = &models.LocationCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(expected) {
+				t.Errorf("expected the pages to hold %v oldest first %t, got %v", expected, !reversed, ids)
+			}
+		}
+
+		history, err := s.LocationHistory(alice, models.LocationQuery{From: noon, To: noon.Add(time.Second), Limit: 10})
+		if err != nil || len(history) != 6 {
+			t.Errorf("expected the 6 locations from noon to include every format, got %d (%v)", len(history), err)
+		}
+	})
+}
+
+func TestSQLLastValidLocationsUntil(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			location := models.Location{Latitude: 48 + float64(i)/100, Longitude: 11}
+			if err := s.InsertLocation(alice, location, start.Add(time.Duration(i)*time.Minute), i != 1, ""); err != nil {
+				t.Fatalf("failed to insert location: %v", err)
+			}
+		}
+
+		// The location recorded at the time itself counts, the invalid one does not
+		locations, err := s.LastValidLocationsUntil(alice, start.Add(3*time.Minute), 3)
+		if err != nil || len(locations) != 3 {
+			t.Fatalf("expected 3 locations, got %d (%v)", len(locations), err)
+		}
+		for i, minutes := range []int{3, 2, 0} {
+			if !locations[i].CreatedAt.Equal(start.Add(time.Duration(minutes) * time.Minute)) {
+				t.Errorf("expected location %d to be recorded at minute %d, got %s", i, minutes, locations[i].CreatedAt)
+			}
+		}
+
+		locations, err = s.LastValidLocationsUntil(alice, start.Add(-time.Second), 3)
+		if err != nil || len(locations) != 0 {
+			t.Errorf("expected no locations before the first one, got %d (%v)", len(locations), err)
+		}
+	})
+}
+
+func TestSQLTwoFactor(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		alice := createTestUser(t, s, "alice@example.com")
+		if err := s.SaveTOTPSecret(alice, "SECRET"); err != nil {
+			t.Fatalf("failed to save totp secret: %v", err)
+		}
+		if err := s.UseTOTPStep(alice, 100); !errors.Is(err, ErrAlreadyUsed) {
+			t.Fatalf("expected codes of an unconfirmed enrollment to be refused, got %v", err)
+		}
+		if err := s.ConfirmTOTP(alice, 100, []string{"first", "second"}); err != nil {
+			t.Fatalf("failed to confirm totp: %v", err)
+		}
+
+		for _, step := range []int64{100, 99} {
+			if err := s.UseTOTPStep(alice, step); !errors.Is(err, ErrAlreadyUsed) {
+				t.Errorf("expected step %d to be used up, got %v", step, err)
+			}
+		}
+		for attempt := 1; attempt <= 3; attempt++ {
+			if attempts, err := s.RecordFailedTOTPAttempt(alice, time.Hour); err != nil || attempts != attempt {
+				t.Fatalf("expected %d failed attempts, got %d (%v)", attempt, attempts, err)
+			}
+		}
+		if attempts, err := s.RecordFailedTOTPAttempt(alice, 0); err != nil || attempts != 1 {
+			t.Errorf("expected failures outside the window to be forgotten, got %d (%v)", attempts, err)
+		}
+
+		if err := s.UseTOTPStep(alice, 101); err != nil {
+			t.Fatalf("failed to use the next step: %v", err)
+		}
+		totp, err := s.GetTOTP(alice)
+		if err != nil || totp.LastUsedStep != 101 || totp.FailedAttempts != 0 || totp.LastFailedAt != nil {
+			t.Errorf("expected step 101 to be used and the failures reset, got %+v (%v)", totp, err)
+		}
+
+		if err := s.UseRecoveryCode(alice, "first"); err != nil {
+			t.Fatalf("failed to use recovery code: %v", err)
+		}
+		for _, codeHash := range []string{"first", "unknown"} {
+			if err := s.UseRecoveryCode(alice, codeHash); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected recovery code %s to be refused, got %v", codeHash, err)
+			}
+		}
+	})
+}
+
+func TestSQLConcurrentCircleInvitesRespectMemberLimit(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, s *SQLStore) {
+		owner := createTestUser(t, s, "owner@example.com")
+		circle, err := s.CreateCircle("Family", owner)
+		if err != nil {
+			t.Fatalf("failed to create circle: %v", err)
+		}
+
+		const maxMembers, invites = 3, 10
+		users := make([]int, invites)
+		for i := range users {
+			users[i] = createTestUser(t, s, "member"+strconv.Itoa(i)+"@example.com")
+			invite := models.CircleInvite{CircleID: circle.ID, CreatedBy: owner, ShortCode: "CODE" + strconv.Itoa(1000+i),
+				ExpiresAt: time.Now().Add(time.Hour)}
+			if _, err := s.CreateCircleInvite(invite); err != nil {
+				t.Fatalf("failed to create invite: %v", err)
+			}
+		}
+
+		errs := make([]error, invites)
+		var wg sync.WaitGroup
+		for i := range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = s.RedeemCircleInvite("CODE"+strconv.Itoa(1000+i), users[i], maxMembers)
+			}()
+		}
+		wg.Wait()
+
+		joined := 0
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				joined++
+			case !errors.Is(err, ErrCircleFull):
+				t.Errorf("user %d: expected ErrCircleFull, got %v", i, err)
+			}
+		}
+		if joined != maxMembers-1 {
+			t.Errorf("expected %d users to join besides the owner, %d joined", maxMembers-1, joined)
+		}
+		circle, err = s.GetCircle(circle.ID, owner)
+		if err != nil || len(circle.Members) != maxMembers {
+			t.Errorf("expected %d members, got %d (%v)", maxMembers, len(circle.Members), err)
+		}
+	})
+}
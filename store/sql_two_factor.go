@@ -0,0 +1,133 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) GetTOTP(userId int) (models.TOTP, error) {
+	query := `
+		SELECT user_id, secret, created_at, confirmed_at, last_used_step, failed_attempts, last_failed_at 
+		FROM user_totp WHERE user_id = ?`
+
+	var totp models.TOTP
+	err := s.queryRow(query, userId).Scan(&totp.UserID, &totp.Secret, &totp.CreatedAt, &totp.ConfirmedAt,
+		&totp.LastUsedStep, &totp.FailedAttempts, &totp.LastFailedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, fmt.Errorf("totp of user ID %d: %w", userId, ErrNotFound)
+		}
+		return models.TOTP{}, fmt.Errorf("failed to retrieve totp: %w", err)
+	}
+	return totp, nil
+}
+
+func (s *SQLStore) SaveTOTPSecret(userId int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET 
+			secret = excluded.secret,
+			created_at = ` + s.dialect.Now() + `,
+			last_used_step = 0,
+			failed_attempts = 0,
+			last_failed_at = NULL
+		WHERE user_totp.confirmed_at IS NULL`
+	_, err := s.exec(query, userId, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		res, err := tx.exec(`UPDATE user_totp SET confirmed_at = `+s.dialect.Now()+`, last_used_step = ? 
+			WHERE user_id = ? AND confirmed_at IS NULL`, step, userId)
+		if err != nil {
+			return fmt.Errorf("failed to confirm totp: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check confirmed totp: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("unconfirmed totp of user ID %d: %w", userId, ErrNotFound)
+		}
+
+		_, err = tx.exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to delete old recovery codes: %w", err)
+		}
+		for _, codeHash := range recoveryCodeHashes {
+			_, err = tx.exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userId, codeHash)
+			if err != nil {
+				return fmt.Errorf("failed to insert recovery code: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) UseTOTPStep(userId int, step int64) error {
+	// The condition on last_used_step makes the check and the update atomic
+	query := `UPDATE user_totp SET last_used_step = ?, failed_attempts = 0, last_failed_at = NULL 
+		WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?`
+	res, err := s.exec(query, step, userId, step)
+	if err != nil {
+		return fmt.Errorf("failed to use totp step: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check used totp step: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("totp step %d: %w", step, ErrAlreadyUsed)
+	}
+	return nil
+}
+
+func (s *SQLStore) UseRecoveryCode(userId int, codeHash string) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		res, err := tx.exec(`UPDATE recovery_codes SET used_at = `+s.dialect.Now()+` 
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, userId, codeHash)
+		if err != nil {
+			return fmt.Errorf("failed to use recovery code: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check used recovery code: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("recovery code: %w", ErrNotFound)
+		}
+
+		_, err = tx.exec(`UPDATE user_totp SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = ?`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to reset failed totp attempts: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) RecordFailedTOTPAttempt(userId int, window time.Duration) (int, error) {
+	now := time.Now().UTC()
+	query := `
+		UPDATE user_totp SET 
+			failed_attempts = CASE WHEN last_failed_at IS NULL OR last_failed_at < ? THEN 1 ELSE failed_attempts + 1 END,
+			last_failed_at = ?
+		WHERE user_id = ? 
+		RETURNING failed_attempts`
+
+	var attempts int
+	err := s.queryRow(query, now.Add(-window), now, userId).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("totp of user ID %d: %w", userId, ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to record failed totp attempt: %w", err)
+	}
+	return attempts, nil
+}
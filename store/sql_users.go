@@ -0,0 +1,242 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLStore) CreateUser(email string, name string, passwordHash []byte) (int, error) {
+	var userId int
+	err := s.queryRow("INSERT INTO users(email, name, password) VALUES(?, ?, ?) RETURNING id",
+		email, name, string(passwordHash)).Scan(&userId)
+	if err != nil {
+		if s.dialect.IsUniqueViolation(err) {
+			return 0, ErrEmailExists
+		}
+		return 0, fmt.Errorf("failed to insert user: %w", err)
+	}
+	return userId, nil
+}
+
+func (s *SQLStore) GetCredentials(email string) (int, string, error) {
+	var userId int
+	var passwordHash string
+	err := s.queryRow("SELECT id, password FROM users WHERE email = ?", email).Scan(&userId, &passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", fmt.Errorf("user with email %s: %w", email, ErrNotFound)
+		}
+		return 0, "", fmt.Errorf("failed to query user credentials: %w", err)
+	}
+	return userId, passwordHash, nil
+}
+
+func (s *SQLStore) GetPasswordHash(userId int) (string, error) {
+	var passwordHash string
+	err := s.queryRow("SELECT password FROM users WHERE id = ?", userId).Scan(&passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return "", fmt.Errorf("failed to query password hash: %w", err)
+	}
+	return passwordHash, nil
+}
+
+func (s *SQLStore) GetUserIdByEmail(email string) (int, error) {
+	var userId int
+	err := s.queryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user with email %s: %w", email, ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to query user ID by email: %w", err)
+	}
+	return userId, nil
+}
+
+func (s *SQLStore) GetPartnerId(userId int) (int, error) {
+	var partnerId *int
+	err := s.queryRow("SELECT linked_account FROM users WHERE id = ?", userId).Scan(&partnerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to query partner ID by user ID: %w", err)
+	}
+	if partnerId == nil {
+		return 0, fmt.Errorf("user ID %d: %w", userId, ErrNoPartner)
+	}
+	return *partnerId, nil
+}
+
+func (s *SQLStore) GetUserInformation(userId int) (models.UserInformation, error) {
+	var userInfo models.UserInformation
+	err := s.queryRow("SELECT email, name FROM users WHERE id = ?", userId).Scan(&userInfo.Email, &userInfo.FirstName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserInformation{}, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return models.UserInformation{}, fmt.Errorf("failed to retrieve user information: %w", err)
+	}
+	return userInfo, nil
+}
+
+func (s *SQLStore) GetAccount(userId int) (models.Account, error) {
+	account := models.Account{ID: userId}
+	query := `SELECT email, name, linked_account, created_at, modified_at, email_verified_at, share_track FROM users WHERE id = ?`
+	err := s.queryRow(query, userId).Scan(&account.Email, &account.FirstName, &account.LinkedAccount,
+		&account.CreatedAt, &account.ModifiedAt, &account.EmailVerifiedAt, &account.SharesTrack)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Account{}, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return models.Account{}, fmt.Errorf("failed to retrieve account: %w", err)
+	}
+	return account, nil
+}
+
+func (s *SQLStore) EmailVerifiedAt(userId int) (*time.Time, error) {
+	var verifiedAt *time.Time
+	err := s.queryRow("SELECT email_verified_at FROM users WHERE id = ?", userId).Scan(&verifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to retrieve email verification: %w", err)
+	}
+	return verifiedAt, nil
+}
+
+func (s *SQLStore) UpdateFirstName(userId int, name string) error {
+	res, err := s.exec(`UPDATE users SET name = ?, modified_at = `+s.dialect.Now()+` WHERE id = ?`, name, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update first name: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check updated user: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLStore) SetTrackSharing(userId int, enabled bool) error {
+	res, err := s.exec(`UPDATE users SET share_track = ?, modified_at = `+s.dialect.Now()+` WHERE id = ?`, enabled, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update track sharing: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check updated user: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLStore) SharesTrack(userId int) (bool, error) {
+	var shares bool
+	err := s.queryRow("SELECT share_track FROM users WHERE id = ?", userId).Scan(&shares)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+		return false, fmt.Errorf("failed to retrieve track sharing: %w", err)
+	}
+	return shares, nil
+}
+
+func (s *SQLStore) ChangePassword(userId int, passwordHash []byte, keepSessionId string) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		res, err := tx.exec(`UPDATE users SET password = ?, modified_at = `+s.dialect.Now()+` WHERE id = ?`, string(passwordHash), userId)
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check updated user: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+		}
+
+		_, err = tx.exec(`UPDATE password_reset_tokens SET used_at = `+s.dialect.Now()+` WHERE user_id = ? AND used_at IS NULL`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+		}
+
+		return revokeUserSessions(tx, userId, keepSessionId)
+	})
+}
+
+func (s *SQLStore) DeleteUser(userId int, audit models.AuditEvent) error {
+	return s.inTransaction(func(tx *sqlTx) error {
+		var email string
+		err := tx.queryRow("SELECT email FROM users WHERE id = ?", userId).Scan(&email)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("user ID %d: %w", userId, ErrNotFound)
+			}
+			return fmt.Errorf("failed to query user: %w", err)
+		}
+
+		_, err = endPartnerLink(tx, userId, userId, models.LinkEndAccountDeleted)
+		if err != nil && !errors.Is(err, ErrNoPartner) {
+			return err
+		}
+		if err = leaveCircles(tx, userId); err != nil {
+			return err
+		}
+
+		// Children first, so the foreign keys on users are never violated
+		deletions := []struct {
+			query       string
+			description string
+		}{
+			{"UPDATE users SET linked_account = NULL, share_track = FALSE WHERE linked_account = ?", "unlink partner"},
+			{"DELETE FROM locations WHERE user_id = ?", "delete locations"},
+			{"DELETE FROM link_code WHERE user_id = ?", "delete link codes"},
+			{"DELETE FROM circle_invites WHERE created_by = ?", "delete circle invites"},
+			{"DELETE FROM refresh_tokens WHERE user_id = ?", "delete refresh tokens"},
+			{"DELETE FROM sessions WHERE user_id = ?", "delete sessions"},
+			{"DELETE FROM password_reset_tokens WHERE user_id = ?", "delete password reset tokens"},
+			{"DELETE FROM email_verification_tokens WHERE user_id = ?", "delete email verification tokens"},
+			{"DELETE FROM recovery_codes WHERE user_id = ?", "delete recovery codes"},
+			{"DELETE FROM user_totp WHERE user_id = ?", "delete totp"},
+			{"DELETE FROM data_exports WHERE user_id = ?", "delete data exports"},
+		}
+		for _, deletion := range deletions {
+			if _, err = tx.exec(deletion.query, userId); err != nil {
+				return fmt.Errorf("failed to %s: %w", deletion.description, err)
+			}
+		}
+
+		_, err = tx.exec("DELETE FROM link_requests WHERE owner_id = ? OR requester_id = ?", userId, userId)
+		if err != nil {
+			return fmt.Errorf("failed to delete link requests: %w", err)
+		}
+
+		_, err = tx.exec("UPDATE rejected_requests SET user_email = 'deleted' WHERE user_email = ?", email)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize rejected requests: %w", err)
+		}
+
+		audit.UserID = userId
+		if err = insertAuditEvent(tx, audit); err != nil {
+			return err
+		}
+
+		_, err = tx.exec("DELETE FROM users WHERE id = ?", userId)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+}
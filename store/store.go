@@ -0,0 +1,225 @@
+package store
+
+import (
+	"DistanceTrackerServer/models"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrEmailExists = errors.New("email already exists")
+	ErrNoPartner   = errors.New("no partner linked")
+	ErrRevoked     = errors.New("already revoked")
+	ErrExpired     = errors.New("expired")
+	ErrAlreadyUsed = errors.New("already used")
+	ErrOwnLinkCode = errors.New("own link code")
+	ErrIsMember    = errors.New("already a member")
+	ErrCircleFull  = errors.New("circle is full")
+	// ErrConflict is returned when a concurrent change got in the way, retrying the operation may succeed
+	ErrConflict = errors.New("conflicting concurrent change")
+)
+
+type UserStore interface {
+	CreateUser(email string, name string, passwordHash []byte) (int, error)
+	GetCredentials(email string) (int, string, error)
+	GetPasswordHash(userId int) (string, error)
+	GetUserIdByEmail(email string) (int, error)
+	GetPartnerId(userId int) (int, error)
+	GetUserInformation(userId int) (models.UserInformation, error)
+	// GetAccount returns the users row of the user without the password hash
+	GetAccount(userId int) (models.Account, error)
+	// UpdateFirstName returns ErrNotFound for unknown users
+	UpdateFirstName(userId int, name string) error
+	// SetTrackSharing records whether the user lets their partner see their location history and export their track,
+	// it returns ErrNotFound for unknown users. The consent is withdrawn whenever the pairing ends.
+	SetTrackSharing(userId int, enabled bool) error
+	// SharesTrack reports whether the user lets their partner see their location history and export their track
+	SharesTrack(userId int) (bool, error)
+	// ChangePassword sets the new password, uses up outstanding reset tokens and revokes every session of the user
+	// except keepSessionId
+	ChangePassword(userId int, passwordHash []byte, keepSessionId string) error
+	// LinkUsers pairs both users and starts a new entry in the link history. Any pairing either of them was in before
+	// is ended first, so no one is left pointing at a partner that moved on.
+	LinkUsers(userId int, partnerId int) error
+	// UnlinkPartner unlinks the user and their partner in one transaction and ends the pairing in the link history
+	// with the reason. It returns the ID of the former partner, or ErrNoPartner if the user had none.
+	UnlinkPartner(userId int, endedBy int, reason string) (int, error)
+	// PartnerLinks returns the link history of the user, oldest first
+	PartnerLinks(userId int) ([]models.PartnerLink, error)
+	// EmailVerifiedAt returns when the user verified their email, or nil if they have not yet
+	EmailVerifiedAt(userId int) (*time.Time, error)
+	// DeleteUser removes the user and everything that belongs to them in one transaction: the partner is unlinked,
+	// locations, link codes, link requests, sessions, data exports and every kind of token are deleted and rejected
+	// requests are anonymized. The audit event is recorded in the same transaction.
+	DeleteUser(userId int, audit models.AuditEvent) error
+}
+
+type LocationStore interface {
+	// InsertLocation stores a location, the validation reason explains why an invalid location was rejected
+	InsertLocation(userId int, location models.Location, createdAt time.Time, isValid bool, validationReason string) error
+	// InsertLocations stores the locations with their validity in one transaction, either all of them or none
+	InsertLocations(userId int, locations []models.LocationFromDB) error
+	LatestValidLocation(userId int) (models.LocationFromDB, error)
+	LastValidLocations(userId int, n int) ([]models.LocationFromDB, error)
+	// LastValidLocationsUntil returns the n newest valid locations of the user recorded at or before the time, newest
+	// first
+	LastValidLocationsUntil(userId int, until time.Time, n int) ([]models.LocationFromDB, error)
+	CountLocations(userId int) (int, error)
+	// LocationsAfter pages through every location of the user, valid or not, in the order they were stored. Pass the
+	// ID of the last location of the previous page, or 0 for the first page.
+	LocationsAfter(userId int, afterId int, limit int) ([]models.LocationFromDB, error)
+	// LocationHistory returns up to query.Limit locations of the user in the time range of the query
+	LocationHistory(userId int, query models.LocationQuery) ([]models.LocationFromDB, error)
+}
+
+type LinkCodeStore interface {
+	// ReplaceLinkCode replaces the link code of the user, their current pairing stays until a link request of the new
+	// code is accepted, and returns when the new code was created. It returns ErrConflict if the short code is taken, a
+	// retry with a new short code may succeed.
+	ReplaceLinkCode(userId int, code uuid.UUID, shortCode string) (time.Time, error)
+	// GetUserLinkCode returns the link code the user created or ErrNotFound
+	GetUserLinkCode(userId int) (models.LinkCode, error)
+}
+
+type LinkRequestStore interface {
+	// RedeemLinkCode uses up the link code, found by its UUID or otherwise its short code, and creates a pending
+	// request of the requester to the code owner in one transaction, so each code is redeemed at most once. Unknown
+	// codes return ErrNotFound. Codes older than maxAge return ErrExpired and are used up anyway, the requester's own
+	// code returns ErrOwnLinkCode and stays valid.
+	RedeemLinkCode(link models.AccountLink, requesterId int, maxAge time.Duration,
+		requestLifetime time.Duration) (models.LinkRequest, error)
+	// PendingLinkRequests returns the unexpired pending requests the user received or sent
+	PendingLinkRequests(userId int) ([]models.LinkRequest, error)
+	// LinkRequestsForUser returns every request the user received or sent, oldest first
+	LinkRequestsForUser(userId int) ([]models.LinkRequest, error)
+	// AcceptLinkRequest accepts a pending request the owner received, links both accounts and removes their link
+	// codes in the same transaction. Unknown, answered or foreign requests return ErrNotFound, expired ones ErrExpired
+	// and ErrConflict is returned if one of them was linked by a concurrent request. Pairings either of them was in
+	// before are ended, the former partners are returned keyed by the owner or requester they were linked with.
+	AcceptLinkRequest(requestId int, ownerId int) (models.LinkRequest, map[int]int, error)
+	// RejectLinkRequest rejects a pending request the owner received, with the same errors as AcceptLinkRequest
+	RejectLinkRequest(requestId int, ownerId int) (models.LinkRequest, error)
+}
+
+type CircleStore interface {
+	// CreateCircle creates the circle with the user as its owner
+	CreateCircle(name string, ownerId int) (models.Circle, error)
+	// CirclesForUser returns the circles the user is a member of together with the role of the user, without members
+	CirclesForUser(userId int) ([]models.Circle, error)
+	// GetCircle returns the circle with its members and the role of the user, ErrNotFound if the user is no member
+	GetCircle(circleId int, userId int) (models.Circle, error)
+	// CreateCircleInvite stores the invite, it returns ErrConflict if the short code is taken. Invites use the short
+	// code format of link codes but live in their own table, a circle has many of them while link_code holds one code
+	// per user.
+	CreateCircleInvite(invite models.CircleInvite) (models.CircleInvite, error)
+	// RedeemCircleInvite uses up the invite and adds the user to its circle in one transaction. Unknown codes return
+	// ErrNotFound and expired ones ErrExpired, they are used up anyway. Members of the circle get ErrIsMember and full
+	// circles ErrCircleFull, then the invite stays valid.
+	RedeemCircleInvite(shortCode string, userId int, maxMembers int) (models.Circle, error)
+	// RemoveCircleMember removes the user from the circle or returns ErrNotFound. If the last owner leaves, the
+	// longest standing member becomes owner, and the circle is deleted together with its last member.
+	RemoveCircleMember(circleId int, userId int) error
+	// DeleteCircle deletes the circle with its members and invites
+	DeleteCircle(circleId int) error
+}
+
+type BanStore interface {
+	LogRejectedRequest(userEmail string, statusCode int, reason string, ipAddress string) error
+	CountRecentRejections(ipAddress string, window time.Duration) (int, error)
+	// BanIp bans an IP for the initial length, or doubles the ban length if the IP has been banned before.
+	// It returns the new ban length in hours and how often the IP has been banned.
+	BanIp(ipAddress string, reason string, initialLength time.Duration) (float64, int, error)
+	ActiveBanUntil(ipAddress string) (time.Time, error)
+	RejectedRequestsForEmail(userEmail string) ([]models.RejectedRequest, error)
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(token models.RefreshToken) error
+	GetRefreshToken(tokenHash string) (models.RefreshToken, error)
+	// RotateRefreshToken revokes the old token and stores its replacement atomically. If the old token has already
+	// been revoked ErrRevoked is returned and the replacement is not stored.
+	RotateRefreshToken(oldTokenId int, newToken models.RefreshToken) error
+}
+
+type SessionStore interface {
+	CreateSession(session models.Session) error
+	GetSession(sessionId string) (models.Session, error)
+	ListActiveSessions(userId int) ([]models.Session, error)
+	TouchSession(sessionId string, ipAddress string) error
+	// RevokeSession revokes the session together with every refresh token issued for it
+	RevokeSession(sessionId string) error
+}
+
+type PasswordResetStore interface {
+	CreatePasswordResetToken(token models.PasswordResetToken) error
+	CountRecentPasswordResets(userId int, window time.Duration) (int, error)
+	// ResetPassword uses up the reset token and sets the new password, which also verifies the email of the user.
+	// Every other outstanding reset token of the user is used up too and every session is revoked. Unknown or already
+	// used tokens return ErrNotFound, expired tokens ErrExpired. It returns the ID of the user whose password was
+	// reset.
+	ResetPassword(tokenHash string, passwordHash []byte) (int, error)
+}
+
+type EmailVerificationStore interface {
+	// CreateEmailVerificationToken stores the token and uses up every outstanding token of the user, so only the
+	// newest mail can be used
+	CreateEmailVerificationToken(token models.EmailVerificationToken) error
+	CountRecentEmailVerifications(userId int, window time.Duration) (int, error)
+	// VerifyEmail uses up the verification token and marks its email as the verified email of the user. If the token
+	// was issued for a new address the email of the user is changed and outstanding password reset tokens, which were
+	// mailed to the old address, are used up. Unknown or used tokens return ErrNotFound, expired tokens ErrExpired
+	// and ErrEmailExists is returned if another account took the address in the meantime. It returns the ID of the
+	// verified user.
+	VerifyEmail(tokenHash string) (int, error)
+}
+
+type TwoFactorStore interface {
+	// GetTOTP returns the TOTP enrollment of the user or ErrNotFound
+	GetTOTP(userId int) (models.TOTP, error)
+	// SaveTOTPSecret starts a new enrollment, replacing any unconfirmed one. A confirmed enrollment is not replaced.
+	SaveTOTPSecret(userId int, secret string) error
+	// ConfirmTOTP enables the enrollment and replaces the recovery codes of the user
+	ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records the time step of an accepted code. Codes of the same or an earlier step return
+	// ErrAlreadyUsed, so every code only works once.
+	UseTOTPStep(userId int, step int64) error
+	// UseRecoveryCode uses up the recovery code, unknown or used codes return ErrNotFound
+	UseRecoveryCode(userId int, codeHash string) error
+	// RecordFailedTOTPAttempt counts a wrong second factor and returns the number of failures within the window
+	RecordFailedTOTPAttempt(userId int, window time.Duration) (int, error)
+}
+
+type AuditStore interface {
+	RecordAuditEvent(event models.AuditEvent) error
+	AuditEventsForUser(userId int) ([]models.AuditEvent, error)
+}
+
+type DataExportStore interface {
+	CreateDataExport(export models.DataExport) error
+	// GetDataExport returns the export if it belongs to the user, ErrNotFound otherwise
+	GetDataExport(userId int, exportId string) (models.DataExport, error)
+	ListDataExports(userId int) ([]models.DataExport, error)
+	// FinishDataExport stores the outcome of a pending export, status is either ExportReady or ExportFailed
+	FinishDataExport(exportId string, status string, filePath string, errorMessage string) error
+	// DeleteExpiredDataExports removes every export past its expiry and returns them, so their files can be removed
+	DeleteExpiredDataExports() ([]models.DataExport, error)
+}
+
+// Stores bundles every store the handlers depend on, so a single value can be injected at router setup.
+type Stores struct {
+	Users              UserStore
+	Locations          LocationStore
+	LinkCodes          LinkCodeStore
+	LinkRequests       LinkRequestStore
+	Circles            CircleStore
+	Bans               BanStore
+	Refresh            RefreshTokenStore
+	Sessions           SessionStore
+	PasswordResets     PasswordResetStore
+	EmailVerifications EmailVerificationStore
+	TwoFactor          TwoFactorStore
+	Audit              AuditStore
+	DataExports        DataExportStore
+}
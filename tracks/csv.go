@@ -0,0 +1,44 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVWriter writes locations as CSV rows, including invalid points and why they were rejected
+type CSVWriter struct {
+	writer *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) (*CSVWriter, error) {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"id", "latitude", "longitude", "created_at", "is_valid", "validation_reason"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write csv header: %w", err)
+	}
+	return &CSVWriter{writer: writer}, nil
+}
+
+func (c *CSVWriter) WriteLocation(location models.LocationFromDB) error {
+	err := c.writer.Write([]string{
+		strconv.Itoa(location.ID),
+		strconv.FormatFloat(location.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(location.Longitude, 'f', -1, 64),
+		location.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatBool(location.IsValid),
+		location.ValidationReason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write csv row: %w", err)
+	}
+	return nil
+}
+
+func (c *CSVWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
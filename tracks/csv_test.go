@@ -0,0 +1,49 @@
+package tracks
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	locations := trackLocations()
+	// Commas, quotes and line breaks end up in the field, not in new columns or rows
+	locations[2].ValidationReason = invalidReason + "\nsecond line"
+
+	var buffer bytes.Buffer
+	writer, err := NewCSVWriter(&buffer)
+	if err != nil {
+		t.Fatalf("failed to create csv writer: %v", err)
+	}
+	for _, location := range locations {
+		if err := writer.WriteLocation(location); err != nil {
+			t.Fatalf("failed to write location %d: %v", location.ID, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close csv writer: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	expected := [][]string{
+		{"id", "latitude", "longitude", "created_at", "is_valid", "validation_reason"},
+		{"1", "48.1374", "11.5755", "2025-06-01T12:00:00Z", "true", ""},
+		{"2", "48.1384", "11.5755", "2025-06-01T12:01:00Z", "true", ""},
+		{"3", "52.52", "13.405", "2025-06-01T12:02:00Z", "false", locations[2].ValidationReason},
+		{"4", "48.1404", "11.5755", "2025-06-01T12:03:00Z", "true", ""},
+		{"5", "48.1414", "11.5755", "2025-06-01T12:04:00Z", "true", ""},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d: %q", len(expected), len(rows), rows)
+	}
+	for i := range expected {
+		if strings.Join(rows[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("expected row %d to be %q, got %q", i, expected[i], rows[i])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type geoJSONPoint struct {
+	Type       string            `json:"type"`
+	Geometry   geoJSONGeometry   `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONProperties struct {
+	Time             string `json:"time"`
+	IsValid          bool   `json:"is_valid"`
+	ValidationReason string `json:"validation_reason,omitempty"`
+}
+
+type geoJSONLineProperties struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// GeoJSONWriter writes locations as a GeoJSON FeatureCollection. The valid track is a LineString, invalid points are
+// Point features annotated with the validation reason. Coordinates are written as they come, so arbitrarily long
+// histories can be streamed.
+type GeoJSONWriter struct {
+	w        io.Writer
+	lines    lineBuilder
+	features int
+}
+
+func NewGeoJSONWriter(w io.Writer, name string) (*GeoJSONWriter, error) {
+	encodedName, err := json.Marshal(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode geojson name: %w", err)
+	}
+	_, err = io.WriteString(w, `{"type":"FeatureCollection","name":`+string(encodedName)+`,"features":[`+"\n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write geojson header: %w", err)
+	}
+	g := &GeoJSONWriter{w: w}
+	g.lines.format = g
+	return g, nil
+}
+
+func (g *GeoJSONWriter) WriteLocation(location models.LocationFromDB) error {
+	return g.lines.add(location)
+}
+
+func (g *GeoJSONWriter) Close() error {
+	if err := g.lines.finish(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(g.w, "\n]}\n"); err != nil {
+		return fmt.Errorf("failed to write geojson footer: %w", err)
+	}
+	return nil
+}
+
+// startFeature separates the feature from the previous one
+func (g *GeoJSONWriter) startFeature(feature string) error {
+	if g.features > 0 {
+		feature = ",\n" + feature
+	}
+	g.features++
+	if _, err := io.WriteString(g.w, feature); err != nil {
+		return fmt.Errorf("failed to write geojson feature: %w", err)
+	}
+	return nil
+}
+
+func (g *GeoJSONWriter) startLine(first models.LocationFromDB) error {
+	return g.startFeature(`{"type":"Feature","geometry":{"type":"LineString","coordinates":[` + geoJSONPosition(first))
+}
+
+func (g *GeoJSONWriter) extendLine(location models.LocationFromDB) error {
+	if _, err := io.WriteString(g.w, ","+geoJSONPosition(location)); err != nil {
+		return fmt.Errorf("failed to write geojson coordinates: %w", err)
+	}
+	return nil
+}
+
+func (g *GeoJSONWriter) endLine(first models.LocationFromDB, last models.LocationFromDB) error {
+	properties, err := json.Marshal(geoJSONLineProperties{
+		StartTime: first.CreatedAt.UTC().Format(time.RFC3339),
+		EndTime:   last.CreatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode geojson line properties: %w", err)
+	}
+	if _, err = io.WriteString(g.w, `]},"properties":`+string(properties)+"}"); err != nil {
+		return fmt.Errorf("failed to write geojson line: %w", err)
+	}
+	return nil
+}
+
+func (g *GeoJSONWriter) writePoint(location models.LocationFromDB) error {
+	feature, err := json.Marshal(geoJSONPoint{
+		Type: "Feature",
+		Geometry: geoJSONGeometry{
+			Type:        "Point",
+			Coordinates: [2]float64{location.Longitude, location.Latitude},
+		},
+		Properties: geoJSONProperties{
+			Time:             location.CreatedAt.UTC().Format(time.RFC3339),
+			IsValid:          location.IsValid,
+			ValidationReason: location.ValidationReason,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode geojson point: %w", err)
+	}
+	return g.startFeature(string(feature))
+}
+
+// geoJSONPosition formats the location as a GeoJSON position, which puts the longitude first
+func geoJSONPosition(location models.LocationFromDB) string {
+	return "[" + strconv.FormatFloat(location.Longitude, 'f', -1, 64) + "," +
+		strconv.FormatFloat(location.Latitude, 'f', -1, 64) + "]"
+}
@@ -0,0 +1,105 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/json"
+	"testing"
+)
+
+type geoJSONDocument struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Features []struct {
+		Type     string `json:"type"`
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			Time             string `json:"time"`
+			StartTime        string `json:"start_time"`
+			EndTime          string `json:"end_time"`
+			IsValid          *bool  `json:"is_valid"`
+			ValidationReason string `json:"validation_reason"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+func parseGeoJSON(t *testing.T, locations []models.LocationFromDB) geoJSONDocument {
+	t.Helper()
+	var document geoJSONDocument
+	if err := json.Unmarshal(writeTrack(t, FormatGeoJSON, locations), &document); err != nil {
+		t.Fatalf("failed to parse GeoJSON: %v", err)
+	}
+	if document.Type != "FeatureCollection" || document.Name != trackName {
+		t.Errorf("expected a FeatureCollection named %q, got %q named %q", trackName, document.Type, document.Name)
+	}
+	return document
+}
+
+// positions returns the GeoJSON positions of the locations, longitude first
+func positions(locations ...models.LocationFromDB) [][2]float64 {
+	result := make([][2]float64, len(locations))
+	for i, location := range locations {
+		result[i] = [2]float64{location.Longitude, location.Latitude}
+	}
+	return result
+}
+
+func TestGeoJSONWriter(t *testing.T) {
+	locations := trackLocations()
+	features := parseGeoJSON(t, locations).Features
+	if len(features) != 3 {
+		t.Fatalf("expected a line, the invalid point and another line, got %+v", features)
+	}
+
+	for i, expected := range []struct {
+		geometry    string
+		coordinates any
+		start, end  string
+	}{
+		{"LineString", positions(locations[0], locations[1]), "2025-06-01T12:00:00Z", "2025-06-01T12:01:00Z"},
+		{"Point", positions(locations[2])[0], "", ""},
+		// The track stays connected around the invalid point
+		{"LineString", positions(locations[1], locations[3], locations[4]), "2025-06-01T12:01:00Z",
+			"2025-06-01T12:04:00Z"},
+	} {
+		feature := features[i]
+		coordinates, err := json.Marshal(expected.coordinates)
+		if err != nil {
+			t.Fatalf("failed to encode coordinates: %v", err)
+		}
+		if feature.Type != "Feature" || feature.Geometry.Type != expected.geometry {
+			t.Errorf("expected feature %d to be a %s, got %+v", i, expected.geometry, feature)
+		}
+		if string(feature.Geometry.Coordinates) != string(coordinates) {
+			t.Errorf("expected feature %d at %s, got %s", i, coordinates, feature.Geometry.Coordinates)
+		}
+		if feature.Properties.StartTime != expected.start || feature.Properties.EndTime != expected.end {
+			t.Errorf("expected feature %d from %q to %q, got %+v", i, expected.start, expected.end, feature.Properties)
+		}
+	}
+
+	invalid := features[1].Properties
+	if invalid.IsValid == nil || *invalid.IsValid || invalid.ValidationReason != invalidReason ||
+		invalid.Time != "2025-06-01T12:02:00Z" {
+		t.Errorf("expected the invalid point at 12:02 with reason %q, got %+v", invalidReason, invalid)
+	}
+}
+
+func TestGeoJSONWriterWithSingleLocation(t *testing.T) {
+	features := parseGeoJSON(t, trackLocations()[:1]).Features
+	if len(features) != 1 || features[0].Geometry.Type != "Point" {
+		t.Fatalf("expected a single point, got %+v", features)
+	}
+	properties := features[0].Properties
+	if properties.IsValid == nil || !*properties.IsValid || properties.ValidationReason != "" {
+		t.Errorf("expected a valid point without reason, got %+v", properties)
+	}
+}
+
+func TestGeoJSONWriterWithoutLocations(t *testing.T) {
+	if features := parseGeoJSON(t, nil).Features; len(features) != 0 {
+		t.Errorf("expected no features, got %+v", features)
+	}
+}
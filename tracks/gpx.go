@@ -0,0 +1,91 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	gpxHeader = xml.Header + `<gpx version="1.1" creator="DistanceTrackerServer" xmlns="http://www.topografix.com/GPX/1/1">` + "\n"
+	gpxFooter = "</trkseg></trk>\n</gpx>\n"
+)
+
+type gpxPoint struct {
+	XMLName     xml.Name `xml:"trkpt"`
+	Latitude    float64  `xml:"lat,attr"`
+	Longitude   float64  `xml:"lon,attr"`
+	Elevation   *float64 `xml:"ele,omitempty"`
+	Time        string   `xml:"time"`
+	Description string   `xml:"desc,omitempty"`
+	Type        string   `xml:"type,omitempty"`
+}
+
+// GPXWriter writes locations as a single GPX 1.1 track. Points are written as they come, so arbitrarily long
+// histories can be streamed. Invalid points are put into track segments of their own, typed as invalid and described
+// with the validation reason, so they are not connected to the valid track.
+type GPXWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	// points and invalidSegment describe the open track segment
+	points         int
+	invalidSegment bool
+}
+
+func NewGPXWriter(w io.Writer, name string) (*GPXWriter, error) {
+	var escapedName strings.Builder
+	if err := xml.EscapeText(&escapedName, []byte(name)); err != nil {
+		return nil, fmt.Errorf("failed to escape gpx track name: %w", err)
+	}
+	_, err := io.WriteString(w, gpxHeader+"<trk><name>"+escapedName.String()+"</name><trkseg>\n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write gpx header: %w", err)
+	}
+	return &GPXWriter{w: w, encoder: xml.NewEncoder(w)}, nil
+}
+
+func (g *GPXWriter) WriteLocation(location models.LocationFromDB) error {
+	if g.points > 0 && g.invalidSegment == location.IsValid {
+		if err := g.encoder.Flush(); err != nil {
+			return fmt.Errorf("failed to flush gpx points: %w", err)
+		}
+		if _, err := io.WriteString(g.w, "</trkseg><trkseg>\n"); err != nil {
+			return fmt.Errorf("failed to start gpx track segment: %w", err)
+		}
+		g.points = 0
+	}
+	g.invalidSegment = !location.IsValid
+	g.points++
+
+	point := gpxPoint{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Elevation: location.Altitude,
+		Time:      location.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if !location.IsValid {
+		point.Description = location.ValidationReason
+		point.Type = "invalid"
+	}
+	err := g.encoder.Encode(point)
+	if err != nil {
+		return fmt.Errorf("failed to write gpx point: %w", err)
+	}
+	if _, err = io.WriteString(g.w, "\n"); err != nil {
+		return fmt.Errorf("failed to write gpx point: %w", err)
+	}
+	return nil
+}
+
+func (g *GPXWriter) Close() error {
+	if err := g.encoder.Flush(); err != nil {
+		return fmt.Errorf("failed to flush gpx points: %w", err)
+	}
+	if _, err := io.WriteString(g.w, gpxFooter); err != nil {
+		return fmt.Errorf("failed to write gpx footer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package tracks
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+type gpxDocument struct {
+	XMLName xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version string   `xml:"version,attr"`
+	Track   struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []struct {
+				Latitude    float64  `xml:"lat,attr"`
+				Longitude   float64  `xml:"lon,attr"`
+				Elevation   *float64 `xml:"ele"`
+				Time        string   `xml:"time"`
+				Description string   `xml:"desc"`
+				Type        string   `xml:"type"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+func TestGPXWriter(t *testing.T) {
+	locations := trackLocations()
+	var document gpxDocument
+	if err := xml.Unmarshal(writeTrack(t, FormatGPX, locations), &document); err != nil {
+		t.Fatalf("failed to parse GPX: %v", err)
+	}
+	if document.Version != "1.1" || document.Track.Name != trackName {
+		t.Errorf("expected a GPX 1.1 track named %q, got %q named %q", trackName, document.Version,
+			document.Track.Name)
+	}
+
+	// The invalid location gets a segment of its own, so it is not connected to the track
+	segments := document.Track.Segments
+	if len(segments) != 3 || len(segments[0].Points) != 2 || len(segments[1].Points) != 1 ||
+		len(segments[2].Points) != 2 {
+		t.Fatalf("expected segments of 2, 1 and 2 points, got %+v", segments)
+	}
+	var index int
+	for _, segment := range segments {
+		for _, point := range segment.Points {
+			location := locations[index]
+			index++
+			if point.Latitude != location.Latitude || point.Longitude != location.Longitude ||
+				point.Time != location.CreatedAt.Format("2006-01-02T15:04:05Z") {
+				t.Errorf("expected point %d at %v,%v at %s, got %+v", location.ID, location.Latitude,
+					location.Longitude, location.CreatedAt, point)
+			}
+			if !location.IsValid && (point.Type != "invalid" || point.Description != invalidReason) {
+				t.Errorf("expected the invalid point to be typed and described with %q, got %+v", invalidReason, point)
+			}
+			if location.IsValid && (point.Type != "" || point.Description != "") {
+				t.Errorf("expected valid point %d without type and description, got %+v", location.ID, point)
+			}
+		}
+	}
+	if elevation := segments[0].Points[0].Elevation; elevation == nil || *elevation != *locations[0].Altitude {
+		t.Errorf("expected the altitude as elevation, got %v", elevation)
+	}
+	if segments[0].Points[1].Elevation != nil {
+		t.Errorf("expected no elevation without altitude, got %v", *segments[0].Points[1].Elevation)
+	}
+}
+
+func TestGPXWriterWithoutLocations(t *testing.T) {
+	var document gpxDocument
+	if err := xml.Unmarshal(writeTrack(t, FormatGPX, nil), &document); err != nil {
+		t.Fatalf("failed to parse GPX: %v", err)
+	}
+	if len(document.Track.Segments) != 1 || len(document.Track.Segments[0].Points) != 0 {
+		t.Errorf("expected an empty track segment, got %+v", document.Track.Segments)
+	}
+}
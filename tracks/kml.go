@@ -0,0 +1,141 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kmlHeader = xml.Header + `<kml xmlns="http://www.opengis.net/kml/2.2"><Document>`
+	kmlFooter = "</Document></kml>\n"
+)
+
+type kmlPlacemark struct {
+	XMLName     xml.Name     `xml:"Placemark"`
+	Name        string       `xml:"name"`
+	Description string       `xml:"description,omitempty"`
+	TimeStamp   kmlTimeStamp `xml:"TimeStamp"`
+	Point       kmlPoint     `xml:"Point"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// KMLWriter writes locations as a KML document. The valid track is a LineString placemark, invalid points are point
+// placemarks described with the validation reason. Coordinates are written as they come, so arbitrarily long
+// histories can be streamed.
+type KMLWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	lines   lineBuilder
+}
+
+func NewKMLWriter(w io.Writer, name string) (*KMLWriter, error) {
+	var escapedName strings.Builder
+	if err := xml.EscapeText(&escapedName, []byte(name)); err != nil {
+		return nil, fmt.Errorf("failed to escape kml document name: %w", err)
+	}
+	_, err := io.WriteString(w, kmlHeader+"<name>"+escapedName.String()+"</name>\n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write kml header: %w", err)
+	}
+	k := &KMLWriter{w: w, encoder: xml.NewEncoder(w)}
+	k.lines.format = k
+	return k, nil
+}
+
+func (k *KMLWriter) WriteLocation(location models.LocationFromDB) error {
+	return k.lines.add(location)
+}
+
+func (k *KMLWriter) Close() error {
+	if err := k.lines.finish(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(k.w, kmlFooter); err != nil {
+		return fmt.Errorf("failed to write kml footer: %w", err)
+	}
+	return nil
+}
+
+func (k *KMLWriter) startLine(first models.LocationFromDB) error {
+	// The name is the start of the line, KML wants the time span before the geometry and the end is not known yet
+	err := k.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Placemark"}})
+	if err == nil {
+		err = k.encoder.EncodeElement("Track from "+first.CreatedAt.UTC().Format(time.RFC3339),
+			xml.StartElement{Name: xml.Name{Local: "name"}})
+	}
+	if err == nil {
+		err = k.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "LineString"}})
+	}
+	if err == nil {
+		err = k.encoder.EncodeElement(1, xml.StartElement{Name: xml.Name{Local: "tessellate"}})
+	}
+	if err == nil {
+		err = k.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "coordinates"}})
+	}
+	if err == nil {
+		err = k.encoder.EncodeToken(xml.CharData(kmlCoordinates(first)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write kml line: %w", err)
+	}
+	return nil
+}
+
+func (k *KMLWriter) extendLine(location models.LocationFromDB) error {
+	if err := k.encoder.EncodeToken(xml.CharData(" " + kmlCoordinates(location))); err != nil {
+		return fmt.Errorf("failed to write kml coordinates: %w", err)
+	}
+	return nil
+}
+
+func (k *KMLWriter) endLine(_ models.LocationFromDB, _ models.LocationFromDB) error {
+	for _, name := range []string{"coordinates", "LineString", "Placemark"} {
+		if err := k.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return fmt.Errorf("failed to write kml line: %w", err)
+		}
+	}
+	// The encoder buffers, it has to be flushed before anything is written around it
+	if err := k.encoder.Flush(); err != nil {
+		return fmt.Errorf("failed to flush kml line: %w", err)
+	}
+	if _, err := io.WriteString(k.w, "\n"); err != nil {
+		return fmt.Errorf("failed to write kml line: %w", err)
+	}
+	return nil
+}
+
+func (k *KMLWriter) writePoint(location models.LocationFromDB) error {
+	placemark := kmlPlacemark{
+		Name:      "Location",
+		TimeStamp: kmlTimeStamp{When: location.CreatedAt.UTC().Format(time.RFC3339)},
+		Point:     kmlPoint{Coordinates: kmlCoordinates(location)},
+	}
+	if !location.IsValid {
+		placemark.Name = "Invalid location"
+		placemark.Description = location.ValidationReason
+	}
+	if err := k.encoder.Encode(placemark); err != nil {
+		return fmt.Errorf("failed to write kml point: %w", err)
+	}
+	if _, err := io.WriteString(k.w, "\n"); err != nil {
+		return fmt.Errorf("failed to write kml point: %w", err)
+	}
+	return nil
+}
+
+// kmlCoordinates formats the location as a KML coordinate tuple, which puts the longitude first
+func kmlCoordinates(location models.LocationFromDB) string {
+	return strconv.FormatFloat(location.Longitude, 'f', -1, 64) + "," + strconv.FormatFloat(location.Latitude, 'f', -1, 64)
+}
@@ -0,0 +1,80 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document struct {
+		Name       string `xml:"name"`
+		Placemarks []struct {
+			Name        string `xml:"name"`
+			Description string `xml:"description"`
+			When        string `xml:"TimeStamp>when"`
+			Point       string `xml:"Point>coordinates"`
+			LineString  *struct {
+				Tessellate  int    `xml:"tessellate"`
+				Coordinates string `xml:"coordinates"`
+			} `xml:"LineString"`
+		} `xml:"Placemark"`
+	} `xml:"Document"`
+}
+
+func parseKML(t *testing.T, locations []models.LocationFromDB) kmlDocument {
+	t.Helper()
+	var document kmlDocument
+	if err := xml.Unmarshal(writeTrack(t, FormatKML, locations), &document); err != nil {
+		t.Fatalf("failed to parse KML: %v", err)
+	}
+	if document.Document.Name != trackName {
+		t.Errorf("expected the document to be named %q, got %q", trackName, document.Document.Name)
+	}
+	return document
+}
+
+func TestKMLWriter(t *testing.T) {
+	locations := trackLocations()
+	placemarks := parseKML(t, locations).Document.Placemarks
+	if len(placemarks) != 3 {
+		t.Fatalf("expected a line, the invalid point and another line, got %+v", placemarks)
+	}
+
+	first, invalid, second := placemarks[0], placemarks[1], placemarks[2]
+	if first.LineString == nil || first.LineString.Tessellate != 1 || first.Name != "Track from 2025-06-01T12:00:00Z" {
+		t.Errorf("expected a line from the first location, got %+v", first)
+	} else if first.LineString.Coordinates != kmlCoordinates(locations[0])+" "+kmlCoordinates(locations[1]) {
+		t.Errorf("expected the line through locations 1 and 2, got %q", first.LineString.Coordinates)
+	}
+
+	if invalid.LineString != nil || invalid.Name != "Invalid location" || invalid.Description != invalidReason {
+		t.Errorf("expected an invalid point described with %q, got %+v", invalidReason, invalid)
+	}
+	if invalid.Point != "13.405,52.52" || invalid.When != "2025-06-01T12:02:00Z" {
+		t.Errorf("expected the invalid point at 13.405,52.52 at 12:02, got %q at %s", invalid.Point, invalid.When)
+	}
+
+	// The track stays connected around the invalid point
+	if second.LineString == nil {
+		t.Fatalf("expected a second line, got %+v", second)
+	}
+	coordinates := strings.Fields(second.LineString.Coordinates)
+	expected := []string{kmlCoordinates(locations[1]), kmlCoordinates(locations[3]), kmlCoordinates(locations[4])}
+	if strings.Join(coordinates, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected the second line through locations 2, 4 and 5, got %v", coordinates)
+	}
+}
+
+func TestKMLWriterWithSingleLocation(t *testing.T) {
+	location := trackLocations()[0]
+	placemarks := parseKML(t, []models.LocationFromDB{location}).Document.Placemarks
+	if len(placemarks) != 1 || placemarks[0].LineString != nil || placemarks[0].Name != "Location" {
+		t.Fatalf("expected a single point, got %+v", placemarks)
+	}
+	if placemarks[0].Point != "11.5755,48.1374" || placemarks[0].Description != "" {
+		t.Errorf("expected the point at 11.5755,48.1374 without description, got %+v", placemarks[0])
+	}
+}
@@ -0,0 +1,79 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+)
+
+// lineFormat is implemented by formats that draw the valid track as lines and mark single points separately
+type lineFormat interface {
+	startLine(first models.LocationFromDB) error
+	extendLine(location models.LocationFromDB) error
+	endLine(first models.LocationFromDB, last models.LocationFromDB) error
+	writePoint(location models.LocationFromDB) error
+}
+
+// lineBuilder splits the locations into lines of valid points with the invalid points written as single points in
+// between. Lines are only started once they have two points, after an invalid point the next line starts at the last
+// valid point so the track stays connected. A lone valid point is written as a single point.
+type lineBuilder struct {
+	format lineFormat
+	// pending is the valid point the next line starts with
+	pending *models.LocationFromDB
+	first   models.LocationFromDB
+	last    *models.LocationFromDB
+	open    bool
+	lines   int
+}
+
+func (b *lineBuilder) add(location models.LocationFromDB) error {
+	if !location.IsValid {
+		if err := b.closeLine(); err != nil {
+			return err
+		}
+		if b.last != nil {
+			b.pending = b.last
+		}
+		return b.format.writePoint(location)
+	}
+
+	switch {
+	case b.open:
+		if err := b.format.extendLine(location); err != nil {
+			return err
+		}
+	case b.pending != nil:
+		if err := b.format.startLine(*b.pending); err != nil {
+			return err
+		}
+		if err := b.format.extendLine(location); err != nil {
+			return err
+		}
+		b.first = *b.pending
+		b.open = true
+		b.pending = nil
+	default:
+		b.pending = &location
+	}
+	b.last = &location
+	return nil
+}
+
+func (b *lineBuilder) closeLine() error {
+	if !b.open {
+		return nil
+	}
+	b.open = false
+	b.lines++
+	return b.format.endLine(b.first, *b.last)
+}
+
+// finish ends the open line, or writes the only valid point if there never was a line
+func (b *lineBuilder) finish() error {
+	if err := b.closeLine(); err != nil {
+		return err
+	}
+	if b.lines == 0 && b.pending != nil {
+		return b.format.writePoint(*b.pending)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package tracks writes location histories in formats other tools understand
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"errors"
+	"io"
+)
+
+const (
+	FormatGPX     = "gpx"
+	FormatGeoJSON = "geojson"
+	FormatKML     = "kml"
+)
+
+var ErrUnknownFormat = errors.New("format must be gpx, geojson or kml")
+
+// Writer is implemented by every track format. Locations must be written oldest first and Close must be called to
+// finish the document.
+type Writer interface {
+	WriteLocation(location models.LocationFromDB) error
+	Close() error
+}
+
+// NewWriter returns a writer for one of the track formats, the name ends up as the name of the track or document
+func NewWriter(w io.Writer, format string, name string) (Writer, error) {
+	switch format {
+	case FormatGPX:
+		return NewGPXWriter(w, name)
+	case FormatGeoJSON:
+		return NewGeoJSONWriter(w, name)
+	case FormatKML:
+		return NewKMLWriter(w, name)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatGeoJSON:
+		return "application/geo+json"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	}
+	return "application/octet-stream"
+}
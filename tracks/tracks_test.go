@@ -0,0 +1,63 @@
+package tracks
+
+import (
+	"DistanceTrackerServer/models"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// trackName and invalidReason need escaping in every format
+const (
+	trackName     = `Alice & Bob's <"track">`
+	invalidReason = `speed: 9000 km/h is <unreasonably> high & "spoofed", probably`
+)
+
+var trackStart = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// trackLocations are a walk through Munich with an invalid jump in the middle: locations 1 and 2 are valid, 3 is
+// invalid, 4 and 5 are valid again
+func trackLocations() []models.LocationFromDB {
+	altitude := 519.5
+	locations := make([]models.LocationFromDB, 5)
+	for i := range locations {
+		locations[i] = models.LocationFromDB{
+			ID:        i + 1,
+			Latitude:  48.1374 + float64(i)/1000,
+			Longitude: 11.5755,
+			CreatedAt: trackStart.Add(time.Duration(i) * time.Minute),
+			IsValid:   true,
+		}
+	}
+	locations[0].Altitude = &altitude
+	locations[2].Latitude, locations[2].Longitude = 52.52, 13.405
+	locations[2].IsValid = false
+	locations[2].ValidationReason = invalidReason
+	return locations
+}
+
+// writeTrack writes the locations in the format and returns the document
+func writeTrack(t *testing.T, format string, locations []models.LocationFromDB) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, format, trackName)
+	if err != nil {
+		t.Fatalf("failed to create %s writer: %v", format, err)
+	}
+	for _, location := range locations {
+		if err := writer.WriteLocation(location); err != nil {
+			t.Fatalf("failed to write location %d: %v", location.ID, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close %s writer: %v", format, err)
+	}
+	return buffer.Bytes()
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, "shp", trackName); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
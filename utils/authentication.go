@@ -2,11 +2,14 @@ package utils
 
 import (
 	"DistanceTrackerServer/constants"
+	"DistanceTrackerServer/models"
+	"DistanceTrackerServer/store"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"time"
 )
 
 func EmailFromContext(ctx *gin.Context) (string, error) {
@@ -23,43 +26,59 @@ func EmailFromContext(ctx *gin.Context) (string, error) {
 	return emailStr, nil
 }
 
-func GetUserIdByEmail(dbConn *sql.DB, email string) (int, error) {
-	var userID int
-	err := dbConn.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("user with email %s not found", email)
-		}
-		return 0, fmt.Errorf("failed to query user ID by email: %w", err)
+func ClaimsFromContext(ctx *gin.Context) (*models.Claims, error) {
+	claims, ok := ctx.Get("claims")
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve claims from context")
 	}
-	return userID, nil
+
+	typedClaims, ok := claims.(*models.Claims)
+	if !ok || typedClaims == nil {
+		return nil, fmt.Errorf("claims in context are not valid")
+	}
+
+	return typedClaims, nil
 }
 
-func LogRejectedRequest(ctx *gin.Context, sugar *zap.SugaredLogger, statusCode int, reason string, user string) error {
-	sugar.Infow("Logging Rejected Request", user, reason)
-	dbConn, err := DBConnFromContext(ctx)
+func UserIdFromContext(ctx *gin.Context) (int, error) {
+	claims, err := ClaimsFromContext(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve database connection: %w", err)
+		return 0, err
+	}
+	return claims.UserID(), nil
+}
+
+func SessionIdFromContext(ctx *gin.Context) (string, error) {
+	sessionId, ok := ctx.Get("session_id")
+	if !ok {
+		return "", fmt.Errorf("failed to retrieve session ID from context")
+	}
+
+	sessionIdStr, ok := sessionId.(string)
+	if !ok {
+		return "", fmt.Errorf("session ID in context is not a string")
 	}
 
+	return sessionIdStr, nil
+}
+
+func LogRejectedRequest(ctx *gin.Context, bans store.BanStore, sugar *zap.SugaredLogger, statusCode int, reason string, user string) error {
+	sugar.Infow("Logging Rejected Request", user, reason)
+
 	clientIp := ctx.ClientIP()
-	loggingQuery := `INSERT INTO rejected_requests(user_email, status_code, reason, ip_address) VALUES (?, ?, ?, ?)`
-	_, err = dbConn.Exec(loggingQuery, user, statusCode, reason, clientIp)
+	err := bans.LogRejectedRequest(user, statusCode, reason, clientIp)
 	if err != nil {
-		return fmt.Errorf("failed to log rejected request: %w", err)
+		return err
 	}
 
 	// View how often the current ip address has been rejected within the last 24 hours and ban if necessary
-	var count int
-
-	countRejectionQuery := `SELECT COUNT(*) FROM rejected_requests WHERE ip_address = ? AND created_at >= datetime('now', '-24 hours')`
-	err = dbConn.QueryRow(countRejectionQuery, clientIp).Scan(&count)
+	count, err := bans.CountRecentRejections(clientIp, 24*time.Hour)
 	if err != nil {
-		return fmt.Errorf("failed to count rejected requests for IP %s: %w", clientIp, err)
+		return err
 	}
 
 	if count >= constants.RequestsUntilBan {
-		err = BanRequestIp(dbConn, sugar, clientIp, count)
+		err = BanRequestIp(bans, sugar, clientIp, count)
 		if err != nil {
 			return fmt.Errorf("failed to ban IP %s after too many rejected requests: %w", clientIp, err)
 		}
@@ -69,65 +88,35 @@ func LogRejectedRequest(ctx *gin.Context, sugar *zap.SugaredLogger, statusCode i
 	return nil
 }
 
-func BanRequestIp(dbConn *sql.DB, sugar *zap.SugaredLogger, clientIp string, count int) error {
+func BanRequestIp(bans store.BanStore, sugar *zap.SugaredLogger, clientIp string, count int) error {
 	sugar.Infow("Attempting to ban IP", "ip", clientIp, "failed_requests", count)
 
-	// Check if the IP has already been banned before and if so how many times
-	var alreadyBanned bool
-	checkBanQuery := `SELECT EXISTS(SELECT 1 FROM banned_ips WHERE ip_address = ?)`
-	err := dbConn.QueryRow(checkBanQuery, clientIp).Scan(&alreadyBanned)
+	// New IPs are banned for 15 minutes, IPs that have been banned before get their previous ban length doubled
+	reason := fmt.Sprintf("Too many rejected requests - %d failed requests", count)
+	newBanLength, bannedTimes, err := bans.BanIp(clientIp, reason, 15*time.Minute)
 	if err != nil {
-		return fmt.Errorf("failed to check if IP %s is already banned: %w", clientIp, err)
+		return err
 	}
 
-	// Create a new ban entry if the IP is not already banned
-	if !alreadyBanned {
-		banQuery := `INSERT INTO banned_ips (ip_address, reason, banned_length, banned_until) VALUES (?, ?, 0.25, datetime('now', '+15 minutes'))` // 0.25 hours = 15 minutes
-		_, err = dbConn.Exec(banQuery, clientIp, fmt.Sprintf("Too many rejected requests - %d failed requests", count))
-		if err != nil {
-			return fmt.Errorf("failed to ban IP %s: %w", clientIp, err)
-		}
+	if bannedTimes == 1 {
 		sugar.Warnf("Initially Banned IP %s due to too many rejected requests - 15 minute ban", clientIp)
 		return nil
 	}
-
-	// If the IP is already banned, update the ban length and increment the ban count
-	var newBanLength float64
-	updateBanQuery := `UPDATE banned_ips SET 
-                      banned_length = banned_length * 2, 
-                      banned_times = banned_times + 1, 
-                      last_banned_at = datetime('now'),
-                      banned_until = datetime('now', '+' || (banned_length * 2) || ' hours'),
-                      reason = reason || ' | Banned again due to too many rejected requests - ' || ? || ' failed requests'
-                  WHERE ip_address = ?
-                  RETURNING banned_length`
-	err = dbConn.QueryRow(updateBanQuery, count, clientIp).Scan(&newBanLength)
-	if err != nil {
-		return fmt.Errorf("failed to update ban for IP %s: %w", clientIp, err)
-	}
 	sugar.Warnf("Updated ban for IP %s due to too many rejected requests - new ban length: %f hours", clientIp, newBanLength)
 	return nil
 }
 
-func IsIpBanned(ctx *gin.Context, ip string) (bool, sql.NullTime, error) {
+func IsIpBanned(bans store.BanStore, ip string) (bool, sql.NullTime, error) {
 	var bannedUntil sql.NullTime
 
-	dbConn, err := DBConnFromContext(ctx)
+	until, err := bans.ActiveBanUntil(ip)
 	if err != nil {
-		return false, bannedUntil, fmt.Errorf("failed to retrieve database connection: %w", err)
-	}
-
-	query := `SELECT banned_until FROM banned_ips WHERE ip_address = ? AND banned_until > datetime('now') LIMIT 1`
-	queryErr := dbConn.QueryRow(query, ip).Scan(&bannedUntil)
-	if queryErr != nil {
-		if errors.Is(queryErr, sql.ErrNoRows) {
+		if errors.Is(err, store.ErrNotFound) {
 			return false, bannedUntil, nil // IP is not banned
 		}
-		return false, bannedUntil, fmt.Errorf("failed to check if IP %s is banned: %w", ip, queryErr)
+		return false, bannedUntil, err
 	}
 
-	if !bannedUntil.Valid {
-		return false, bannedUntil, fmt.Errorf("banned_until field is not valid for IP %s", ip)
-	}
+	bannedUntil = sql.NullTime{Time: until, Valid: true}
 	return true, bannedUntil, nil // IP is banned until the specified time
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Short codes are 8 characters of Crockford's base32, shown as two groups of four. They are used for link codes and
+// circle invites. Their 40 random bits cannot be guessed before the IP bans for unknown codes kick in.
+const ShortCodeLength = 8
+
+var (
+	shortCodeEncoding = base32.NewEncoding("0123456789ABCDEFGHJKMNPQRSTVWXYZ").WithPadding(base32.NoPadding)
+	// Crockford's base32 leaves out letters that are easily confused with digits, read them as the digit
+	shortCodeReplacer = strings.NewReplacer("-", "", " ", "", "I", "1", "L", "1", "O", "0")
+
+	ErrInvalidShortCode = errors.New("invalid code")
+)
+
+func GenerateShortCode() (string, error) {
+	b := make([]byte, ShortCodeLength*5/8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate short code: %w", err)
+	}
+	return shortCodeEncoding.EncodeToString(b), nil
+}
+
+// NormalizeShortCode accepts a code the way people type it, in any case and with or without the separator
+func NormalizeShortCode(code string) (string, error) {
+	code = shortCodeReplacer.Replace(strings.ToUpper(strings.TrimSpace(code)))
+	if len(code) != ShortCodeLength {
+		return "", ErrInvalidShortCode
+	}
+	if _, err := shortCodeEncoding.DecodeString(code); err != nil {
+		return "", ErrInvalidShortCode
+	}
+	return code, nil
+}
+
+func FormatShortCode(code string) string {
+	if len(code) != ShortCodeLength {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}